@@ -0,0 +1,57 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deleteNamespace  string
+	deleteKubeconfig string
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a sonobuoy run and everything it created",
+		Long:  "Deletes the sonobuoy master and its namespace, the cluster RBAC created for it, and the resources of its plugins in whichever namespace they run. Runs in other namespaces are left alone; use gc for plugin resources whose master is already gone.",
+		Run:   runDelete,
+	}
+	AddNamespaceFlag(cmd, &deleteNamespace)
+	AddKubeconfigFlag(cmd, &deleteKubeconfig)
+	RootCmd.AddCommand(cmd)
+}
+
+func runDelete(cmd *cobra.Command, args []string) {
+	kubeClient, err := client.NewKubeClient(deleteKubeconfig)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+
+	if errs := client.Delete(kubeClient, deleteNamespace); len(errs) > 0 {
+		for _, err := range errs {
+			glog.Error(err)
+		}
+		os.Exit(1)
+	}
+}
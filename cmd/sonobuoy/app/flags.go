@@ -0,0 +1,67 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// AddGenFlags adds the flags controlling manifest generation to the given
+// command, storing them in cfg.
+func AddGenFlags(cmd *cobra.Command, cfg *client.GenConfig) {
+	cmd.Flags().StringVarP(
+		&cfg.Namespace, "namespace", "n", cfg.Namespace,
+		"The namespace to run sonobuoy and its plugins in",
+	)
+	cmd.Flags().StringVar(
+		&cfg.Image, "image", cfg.Image,
+		"The sonobuoy image used by the master and plugin workers",
+	)
+	cmd.Flags().StringSliceVar(
+		&cfg.Plugins, "plugin", cfg.Plugins,
+		"The plugins to run (may be given more than once)",
+	)
+	cmd.Flags().StringSliceVar(
+		&cfg.Resources, "resources", cfg.Resources,
+		"The resources to collect",
+	)
+	cmd.Flags().StringVar(
+		&cfg.E2EFocus, "e2e-focus", cfg.E2EFocus,
+		"Regular expression selecting the e2e tests to run (defaults to the e2e plugin's default)",
+	)
+	cmd.Flags().StringVar(
+		&cfg.E2ESkip, "e2e-skip", cfg.E2ESkip,
+		"Regular expression selecting e2e tests to skip",
+	)
+}
+
+// AddKubeconfigFlag adds a flag selecting the cluster to talk to.
+func AddKubeconfigFlag(cmd *cobra.Command, kubeconfig *string) {
+	cmd.Flags().StringVar(
+		kubeconfig, "kubeconfig", "",
+		"Path to the kubeconfig file to use (defaults to $KUBECONFIG, then ~/.kube/config)",
+	)
+}
+
+// AddNamespaceFlag adds a flag selecting the namespace sonobuoy runs in.
+func AddNamespaceFlag(cmd *cobra.Command, namespace *string) {
+	cmd.Flags().StringVarP(
+		namespace, "namespace", "n", client.DefaultNamespace,
+		"The namespace sonobuoy runs in",
+	)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcKubeconfig string
+	gcOptions    client.GCOptions
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Delete plugin resources left behind by old sonobuoy runs",
+		Long:  "Finds the resources created by sonobuoy plugins in every namespace, and deletes those whose run's master is no longer running, along with any older than --older-than. Runs whose master doesn't run in a pod can't be told apart from finished ones, so use --dry-run to check first.",
+		Run:   runGC,
+	}
+	AddKubeconfigFlag(cmd, &gcKubeconfig)
+	cmd.Flags().DurationVar(
+		&gcOptions.OlderThan, "older-than", 0,
+		"Also delete plugin resources older than this, even if their run is still active",
+	)
+	cmd.Flags().BoolVar(
+		&gcOptions.DryRun, "dry-run", false,
+		"Only list the resources that would be deleted",
+	)
+	RootCmd.AddCommand(cmd)
+}
+
+func runGC(cmd *cobra.Command, args []string) {
+	kubeClient, err := client.NewKubeClient(gcKubeconfig)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+
+	resources, errs := client.GarbageCollect(kubeClient, gcOptions)
+
+	if len(resources) > 0 {
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tPLUGIN\tSESSION\tAGE\tRUN\tACTION")
+		for _, r := range resources {
+			run := "orphaned"
+			if r.Active {
+				run = "active"
+			}
+			action := "kept"
+			if r.Collect {
+				action = "deleted"
+				if gcOptions.DryRun {
+					action = "would delete"
+				}
+			}
+			plugin, session := r.Plugin, r.Session
+			if session == "" {
+				// The ConfigMap tracking a master's plugins
+				plugin, session = "-", "-"
+			}
+			age := now.Sub(r.Created) / time.Second * time.Second
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", r.Kind, r.Namespace, r.Name, plugin, session, age, run, action)
+		}
+		w.Flush()
+	} else if len(errs) == 0 {
+		fmt.Println("No plugin resources found.")
+	}
+
+	if len(errs) > 0 {
+		for _, err := range errs {
+			glog.Error(err)
+		}
+		os.Exit(1)
+	}
+}
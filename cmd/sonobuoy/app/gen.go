@@ -0,0 +1,47 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var genFlags = client.NewGenConfig()
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "gen",
+		Short: "Generate the manifests to run sonobuoy on a cluster",
+		Long:  "Prints the namespace, RBAC, configuration and master pod needed to run sonobuoy as a YAML stream, suitable for kubectl apply -f -",
+		Run:   runGen,
+	}
+	AddGenFlags(cmd, genFlags)
+	RootCmd.AddCommand(cmd)
+}
+
+func runGen(cmd *cobra.Command, args []string) {
+	manifest, err := client.GenerateManifest(genFlags)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(manifest)
+}
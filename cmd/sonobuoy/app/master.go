@@ -17,15 +17,25 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"encoding/json"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/heptio/sonobuoy/pkg/config"
 	"github.com/heptio/sonobuoy/pkg/discovery"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
 )
 
-var noExit bool
+var (
+	noExit              bool
+	dryRun              bool
+	shutdownGracePeriod time.Duration
+)
 
 func init() {
 	cmd := &cobra.Command{
@@ -38,6 +48,14 @@ func init() {
 		&noExit, "no-exit", false,
 		"Use this if you want sonobuoy to block and not exit. Useful when you want to explicitly grab results.tar.gz",
 	)
+	cmd.PersistentFlags().DurationVar(
+		&shutdownGracePeriod, "shutdown-grace-period", 25*time.Second,
+		"How long to spend cleaning up and saving partial results after SIGINT or SIGTERM before exiting anyway. Keep it under the master pod's terminationGracePeriodSeconds.",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&dryRun, "dry-run", false,
+		"Print the resources each plugin would create, the results it would be expected to submit, and the queries that would be made, as JSON, then exit without running anything.",
+	)
 	RootCmd.AddCommand(cmd)
 }
 
@@ -57,8 +75,16 @@ func runMaster(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if dryRun {
+		os.Exit(runDryRun(kubeClient, cfg))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleSignals(cancel)
+
 	// Run Discovery (gather API data, run plugins)
-	if errlist := discovery.Run(kubeClient, cfg); errlist != nil {
+	if errlist := discovery.Run(ctx, kubeClient, cfg); errlist != nil {
 		for _, err := range errlist {
 			if err != nil {
 				glog.Error(err)
@@ -67,10 +93,51 @@ func runMaster(cmd *cobra.Command, args []string) {
 		exit = 1
 	}
 
-	if noExit {
+	if noExit && ctx.Err() == nil {
 		glog.Info("no-exit was specified, sonobuoy is now blocking")
 		select {}
 	}
 
 	os.Exit(exit)
 }
+
+// runDryRun prints what a run with the given config would do, returning the
+// exit code.
+func runDryRun(kubeClient kubernetes.Interface, cfg *config.Config) int {
+	plan, err := discovery.DryRun(kubeClient, cfg)
+	if err != nil {
+		glog.Error(err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(plan); err != nil {
+		glog.Error(err)
+		return 1
+	}
+	return 0
+}
+
+// handleSignals cancels the run on SIGINT or SIGTERM, so that the plugins are
+// cleaned up and the results so far are saved. If that takes longer than
+// shutdownGracePeriod, or a second signal comes in, it exits right away.
+func handleSignals(cancel context.CancelFunc) {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigCh
+		glog.Warningf("Received %v, cleaning up and saving partial results (signal again to exit right away)", sig)
+		cancel()
+
+		select {
+		case sig = <-sigCh:
+			glog.Errorf("Received %v again, exiting without finishing cleanup", sig)
+		case <-time.After(shutdownGracePeriod):
+			glog.Errorf("Cleanup didn't finish within %v, exiting", shutdownGracePeriod)
+		}
+		glog.Flush()
+		os.Exit(1)
+	}()
+}
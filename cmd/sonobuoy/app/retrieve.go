@@ -0,0 +1,63 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	retrieveNamespace  string
+	retrieveKubeconfig string
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "retrieve [output directory]",
+		Short: "Copy the results of a finished sonobuoy run to a local directory",
+		Long:  "Copies the results tarball out of the sonobuoy master into the given directory (the current directory by default). Like kubectl cp, this runs tar in the master pod, so it needs permission to exec into pods in the sonobuoy namespace.",
+		Run:   runRetrieve,
+	}
+	AddNamespaceFlag(cmd, &retrieveNamespace)
+	AddKubeconfigFlag(cmd, &retrieveKubeconfig)
+	RootCmd.AddCommand(cmd)
+}
+
+func runRetrieve(cmd *cobra.Command, args []string) {
+	outdir := "."
+	if len(args) > 0 {
+		outdir = args[0]
+	}
+
+	restConfig, err := client.NewRESTConfig(retrieveKubeconfig)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+
+	path, err := client.RetrieveResults(restConfig, retrieveNamespace, outdir)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+	fmt.Println(path)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	runFlags      = client.NewGenConfig()
+	runKubeconfig string
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Start a sonobuoy run on your cluster",
+		Long:  "Creates the objects printed by sonobuoy gen, launching a sonobuoy master which runs the selected plugins and collects results",
+		Run:   runRun,
+	}
+	AddGenFlags(cmd, runFlags)
+	AddKubeconfigFlag(cmd, &runKubeconfig)
+	RootCmd.AddCommand(cmd)
+}
+
+func runRun(cmd *cobra.Command, args []string) {
+	kubeClient, err := client.NewKubeClient(runKubeconfig)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+
+	if err = client.Run(kubeClient, runFlags); err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Sonobuoy is running in namespace %v. Check on it with: sonobuoy status -n %v\n", runFlags.Namespace, runFlags.Namespace)
+}
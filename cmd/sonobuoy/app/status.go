@@ -0,0 +1,106 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	statusNamespace  string
+	statusKubeconfig string
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Report the progress of a sonobuoy run",
+		Run:   runStatus,
+	}
+	AddNamespaceFlag(cmd, &statusNamespace)
+	AddKubeconfigFlag(cmd, &statusKubeconfig)
+	RootCmd.AddCommand(cmd)
+}
+
+func runStatus(cmd *cobra.Command, args []string) {
+	kubeClient, err := client.NewKubeClient(statusKubeconfig)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+
+	status, err := client.GetStatus(kubeClient, statusNamespace)
+	if err != nil {
+		glog.Error(err)
+		os.Exit(1)
+	}
+
+	if status.AwaitingRelease {
+		fmt.Println("The sonobuoy master stopped without cleaning up after its plugins, so its pod is kept until they're cleaned up. Run sonobuoy delete or sonobuoy gc to clean them up and release it.")
+	}
+
+	switch {
+	case status.Complete && status.Run.Phase == discovery.PhaseIncomplete:
+		fmt.Printf("Sonobuoy was interrupted. Partial results are at %v, use sonobuoy retrieve to fetch them.\n", status.Tarball)
+	case status.Complete:
+		fmt.Printf("Sonobuoy has completed. Results are at %v, use sonobuoy retrieve to fetch them.\n", status.Tarball)
+	case status.Run != nil && status.Run.Phase == discovery.PhaseFailed:
+		fmt.Printf("Sonobuoy failed to write its results, check the master's logs for errors.\n")
+	case status.MasterPhase == v1.PodFailed || status.MasterPhase == v1.PodSucceeded:
+		fmt.Printf("Sonobuoy master exited (%v) without completing, check its logs for errors.\n", status.MasterPhase)
+	case status.Run != nil:
+		fmt.Printf("Sonobuoy is still running (%v).\n", status.Run.Phase)
+	default:
+		fmt.Printf("Sonobuoy is still running (master pod is %v).\n", status.MasterPhase)
+	}
+
+	// Prefer the live numbers from the aggregation server, falling back to
+	// the summary the master last wrote to its pod.
+	var summaries []discovery.PluginSummary
+	if status.Aggregation != nil {
+		summaries = discovery.SummarizePlugins(status.Aggregation)
+	} else if status.Run != nil {
+		summaries = status.Run.Plugins
+	}
+	if len(summaries) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "PLUGIN\tCOMPLETE\tFAILED\tPENDING")
+		for _, p := range summaries {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", p.Plugin, p.Completed, p.Failed, p.Pending)
+		}
+		w.Flush()
+	}
+
+	if len(status.Plugins) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "PLUGIN\tPOD\tNODE\tPHASE")
+		for _, p := range status.Plugins {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", p.Plugin, p.Pod, p.Node, p.Phase)
+		}
+		w.Flush()
+	}
+}
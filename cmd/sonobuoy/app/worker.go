@@ -91,10 +91,16 @@ func runGatherSingleNode(cmd *cobra.Command, args []string) {
 	}
 
 	// A single-node results URL looks like:
-	// http://sonobuoy-master:8080/api/v1/results/by-node/node1/systemd_logs
+	// https://sonobuoy-master:8080/api/v1/results/by-node/node1/systemd_logs
 	url := cfg.MasterURL + "/" + cfg.NodeName + "/" + cfg.ResultType
 
-	err = worker.GatherResults(cfg.ResultsDir+"/done", url)
+	client, err := worker.NewHTTPClient(cfg)
+	if err != nil {
+		glog.Errorf("could not create results client: %v", err)
+		os.Exit(1)
+	}
+
+	err = worker.GatherResults(cfg.ResultsDir+"/done", url, client, cfg.Token)
 	if err != nil {
 		glog.Errorln(err)
 		os.Exit(1)
@@ -110,10 +116,16 @@ func runGatherGlobal(cmd *cobra.Command, args []string) {
 	}
 
 	// A global results URL looks like:
-	// http://sonobuoy-master:8080/api/v1/results/global/systemd_logs
+	// https://sonobuoy-master:8080/api/v1/results/global/systemd_logs
 	url := cfg.MasterURL + "/" + cfg.ResultType
 
-	err = worker.GatherResults(cfg.ResultsDir+"/done", url)
+	client, err := worker.NewHTTPClient(cfg)
+	if err != nil {
+		glog.Errorf("could not create results client: %v", err)
+		os.Exit(1)
+	}
+
+	err = worker.GatherResults(cfg.ResultsDir+"/done", url, client, cfg.Token)
 	if err != nil {
 		glog.Errorln(err)
 		os.Exit(1)
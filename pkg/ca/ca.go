@@ -0,0 +1,167 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ca is a minimal certificate authority, used to secure the
+// connections between sonobuoy workers and the aggregation server. A new
+// authority is created for every run, and its key never leaves the master.
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// validity is how long certificates are valid for. Runs are expected
+	// to finish well within this.
+	validity = 7 * 24 * time.Hour
+	// clockSkew is how far back certificates are valid from, in case node
+	// clocks are behind the master's.
+	clockSkew = time.Hour
+)
+
+// Authority issues the certificates used by a sonobuoy run.
+type Authority struct {
+	privKey *ecdsa.PrivateKey
+	cert    *x509.Certificate
+
+	serialMutex sync.Mutex
+	lastSerial  int64
+}
+
+// NewAuthority creates a new, self-signed certificate authority.
+func NewAuthority() (*Authority, error) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Authority{privKey: privKey}
+	tmpl := a.template("sonobuoy-ca")
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, privKey.Public(), privKey)
+	if err != nil {
+		return nil, err
+	}
+	if a.cert, err = x509.ParseCertificate(der); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// CACert returns the authority's own certificate.
+func (a *Authority) CACert() *x509.Certificate {
+	return a.cert
+}
+
+// CACertPEM returns the authority's own certificate, PEM encoded.
+func (a *Authority) CACertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.cert.Raw})
+}
+
+// CertPool returns a pool trusting only this authority.
+func (a *Authority) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.cert)
+	return pool
+}
+
+// ServerCertificate issues a certificate for a server reachable at the given
+// host names or IP addresses.
+func (a *Authority) ServerCertificate(hosts ...string) (*tls.Certificate, error) {
+	tmpl := a.template("sonobuoy-master")
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+
+	certPEM, keyPEM, err := a.issue(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ClientCertificate issues a client certificate with the given common name,
+// returning the PEM encoded certificate and private key.
+func (a *Authority) ClientCertificate(commonName string) (certPEM, keyPEM []byte, err error) {
+	tmpl := a.template(commonName)
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	return a.issue(tmpl)
+}
+
+// template returns a certificate template with the fields common to every
+// certificate the authority issues filled in.
+func (a *Authority) template(commonName string) *x509.Certificate {
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: a.nextSerial(),
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"sonobuoy"},
+		},
+		NotBefore: now.Add(-clockSkew),
+		NotAfter:  now.Add(validity),
+		KeyUsage:  x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+}
+
+// issue generates a key and signs a certificate for it from tmpl.
+func (a *Authority) issue(tmpl *x509.Certificate) (certPEM, keyPEM []byte, err error) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, privKey.Public(), a.privKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(privKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func (a *Authority) nextSerial() *big.Int {
+	a.serialMutex.Lock()
+	defer a.serialMutex.Unlock()
+	a.lastSerial++
+	return big.NewInt(a.lastSerial)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+func TestAuthority(t *testing.T) {
+	authority, err := NewAuthority()
+	if err != nil {
+		t.Fatalf("Could not create authority: %v", err)
+	}
+
+	server, err := authority.ServerCertificate("sonobuoy-master", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Could not issue server certificate: %v", err)
+	}
+	serverCert, err := x509.ParseCertificate(server.Certificate[0])
+	if err != nil {
+		t.Fatalf("Could not parse server certificate: %v", err)
+	}
+	for _, host := range []string{"sonobuoy-master", "10.0.0.1"} {
+		_, err = serverCert.Verify(x509.VerifyOptions{
+			DNSName:   host,
+			Roots:     authority.CertPool(),
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if err != nil {
+			t.Errorf("Server certificate not valid for %v: %v", host, err)
+		}
+	}
+	if _, err = serverCert.Verify(x509.VerifyOptions{DNSName: "elsewhere", Roots: authority.CertPool()}); err == nil {
+		t.Errorf("Server certificate should not be valid for other hosts")
+	}
+
+	certPEM, keyPEM, err := authority.ClientCertificate("e2e")
+	if err != nil {
+		t.Fatalf("Could not issue client certificate: %v", err)
+	}
+	client, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Could not load client certificate: %v", err)
+	}
+	clientCert, err := x509.ParseCertificate(client.Certificate[0])
+	if err != nil {
+		t.Fatalf("Could not parse client certificate: %v", err)
+	}
+	if clientCert.Subject.CommonName != "e2e" {
+		t.Errorf("Expected client certificate for e2e, got %v", clientCert.Subject.CommonName)
+	}
+	_, err = clientCert.Verify(x509.VerifyOptions{
+		Roots:     authority.CertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Errorf("Client certificate not valid for client auth: %v", err)
+	}
+
+	// Certificates from another run's authority must not be trusted
+	other, err := NewAuthority()
+	if err != nil {
+		t.Fatalf("Could not create authority: %v", err)
+	}
+	if _, err = clientCert.Verify(x509.VerifyOptions{Roots: other.CertPool()}); err == nil {
+		t.Errorf("Client certificate should not be trusted by another authority")
+	}
+}
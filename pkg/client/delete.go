@@ -0,0 +1,179 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// componentSelector selects everything sonobuoy creates, both for the
+// master and for plugins
+const componentSelector = "component=sonobuoy"
+
+// Delete tears down the sonobuoy run in the given namespace: its master, the
+// resources of its plugins (in whichever namespace they run) and the cluster
+// RBAC objects created for it. Other runs, in other namespaces, are left
+// alone. The namespace itself is only deleted if sonobuoy created it;
+// otherwise just the sonobuoy objects within it are.
+//
+// Plugin resources are found through their owner: the master pod, or the
+// tracking ConfigMaps labelled with its UID (see discovery.MasterUIDLabel)
+// if the plugins ran in another namespace. Resources of runs whose master is
+// already gone can be cleaned up with GarbageCollect.
+func Delete(kubeClient kubernetes.Interface, namespace string) []error {
+	var errs []error
+	gracePeriod := int64(1)
+	deletionPolicy := metav1.DeletePropagationBackground
+	deleteOptions := &metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &deletionPolicy,
+	}
+	logErr := func(what string, err error) {
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("error deleting %v: %v", what, err))
+		}
+	}
+
+	master, err := kubeClient.CoreV1().Pods(namespace).Get(MasterPodName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		glog.Infof("No sonobuoy master in namespace %v, use sonobuoy gc to clean up the resources of its plugins", namespace)
+	case err != nil:
+		errs = append(errs, fmt.Errorf("could not get master pod: %v", err))
+	default:
+		errs = append(errs, deletePluginResources(kubeClient, master, deleteOptions)...)
+		// Let the master pod go, now its plugins' resources are gone.
+		// This also deletes its tracking ConfigMaps, if it has any.
+		errs = append(errs, discovery.ReleaseMaster(kubeClient, master)...)
+	}
+
+	rbacName := clusterRBACName(namespace)
+	logErr("cluster role binding "+rbacName, kubeClient.RbacV1beta1().ClusterRoleBindings().Delete(rbacName, deleteOptions))
+	logErr("cluster role "+rbacName, kubeClient.RbacV1beta1().ClusterRoles().Delete(rbacName, deleteOptions))
+
+	ns, err := kubeClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		logErr("namespace "+namespace, err)
+		return errs
+	}
+	if ns.Labels["component"] == "sonobuoy" {
+		glog.V(2).Infof("Deleting namespace %v", namespace)
+		logErr("namespace "+namespace, kubeClient.CoreV1().Namespaces().Delete(namespace, deleteOptions))
+		return errs
+	}
+
+	componentOpts := metav1.ListOptions{LabelSelector: componentSelector}
+	// The API server doesn't support deleting services as a collection
+	if svcs, err := kubeClient.CoreV1().Services(namespace).List(componentOpts); err != nil {
+		logErr("services", err)
+	} else {
+		for _, svc := range svcs.Items {
+			logErr("service "+svc.Name, kubeClient.CoreV1().Services(namespace).Delete(svc.Name, deleteOptions))
+		}
+	}
+	logErr("pods", kubeClient.CoreV1().Pods(namespace).DeleteCollection(deleteOptions, componentOpts))
+	logErr("config maps", kubeClient.CoreV1().ConfigMaps(namespace).DeleteCollection(deleteOptions, componentOpts))
+	logErr("service accounts", kubeClient.CoreV1().ServiceAccounts(namespace).DeleteCollection(deleteOptions, componentOpts))
+
+	return errs
+}
+
+// deletePluginResources deletes the resources created by the plugins of the
+// given master, which are owned by the master pod or by one of its tracking
+// ConfigMaps. Kubernetes' garbage collector would get to them eventually
+// once their owner is gone, but this doesn't leave them running meanwhile.
+func deletePluginResources(kubeClient kubernetes.Interface, master *v1.Pod, deleteOptions *metav1.DeleteOptions) []error {
+	var errs []error
+	logErr := func(what string, err error) {
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("error deleting %v: %v", what, err))
+		}
+	}
+
+	owners := map[types.UID]bool{master.UID: true}
+	trackers, err := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: discovery.MasterUIDLabel + "=" + string(master.UID),
+	})
+	if err != nil {
+		return append(errs, fmt.Errorf("could not list tracking config maps: %v", err))
+	}
+	for _, cm := range trackers.Items {
+		owners[cm.UID] = true
+	}
+	ownedByRun := func(meta metav1.ObjectMeta) bool {
+		for _, ref := range meta.OwnerReferences {
+			if owners[ref.UID] {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Plugins may have been run in another namespace, and collections can't
+	// be deleted across namespaces, so find and delete each object.
+	pluginOpts := metav1.ListOptions{LabelSelector: gcSelector}
+	if dsets, err := kubeClient.ExtensionsV1beta1().DaemonSets(metav1.NamespaceAll).List(pluginOpts); err != nil {
+		logErr("plugin daemonsets", err)
+	} else {
+		for _, ds := range dsets.Items {
+			if ownedByRun(ds.ObjectMeta) {
+				glog.V(2).Infof("Deleting daemonset %v/%v", ds.Namespace, ds.Name)
+				logErr("daemonset "+ds.Name, kubeClient.ExtensionsV1beta1().DaemonSets(ds.Namespace).Delete(ds.Name, deleteOptions))
+			}
+		}
+	}
+	if pods, err := kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(pluginOpts); err != nil {
+		logErr("plugin pods", err)
+	} else {
+		for _, pod := range pods.Items {
+			if ownedByRun(pod.ObjectMeta) {
+				glog.V(2).Infof("Deleting pod %v/%v", pod.Namespace, pod.Name)
+				logErr("pod "+pod.Name, kubeClient.CoreV1().Pods(pod.Namespace).Delete(pod.Name, deleteOptions))
+			}
+		}
+	}
+	if cms, err := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(pluginOpts); err != nil {
+		logErr("plugin config maps", err)
+	} else {
+		for _, cm := range cms.Items {
+			if ownedByRun(cm.ObjectMeta) {
+				glog.V(2).Infof("Deleting config map %v/%v", cm.Namespace, cm.Name)
+				logErr("config map "+cm.Name, kubeClient.CoreV1().ConfigMaps(cm.Namespace).Delete(cm.Name, deleteOptions))
+			}
+		}
+	}
+	if secrets, err := kubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(pluginOpts); err != nil {
+		logErr("plugin secrets", err)
+	} else {
+		for _, secret := range secrets.Items {
+			if ownedByRun(secret.ObjectMeta) {
+				glog.V(2).Infof("Deleting secret %v/%v", secret.Namespace, secret.Name)
+				logErr("secret "+secret.Name, kubeClient.CoreV1().Secrets(secret.Namespace).Delete(secret.Name, deleteOptions))
+			}
+		}
+	}
+
+	return errs
+}
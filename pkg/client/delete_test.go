@@ -0,0 +1,125 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeRun returns the objects of a sonobuoy run in namespace, whose plugins
+// ran in pluginNamespace and so are owned by a tracking ConfigMap.
+func fakeRun(namespace, pluginNamespace string) []runtime.Object {
+	masterUID := types.UID("master-" + namespace)
+	trackerUID := types.UID("tracker-" + namespace)
+	owned := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:      name,
+			Namespace: pluginNamespace,
+			Labels: map[string]string{
+				"component":         "sonobuoy",
+				plugin.SessionLabel: "session-" + namespace,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Name:       "sonobuoy-run-" + string(masterUID),
+				UID:        trackerUID,
+			}},
+		}
+	}
+
+	return []runtime.Object{
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:       MasterPodName,
+			Namespace:  namespace,
+			UID:        masterUID,
+			Labels:     labels(),
+			Finalizers: []string{discovery.CleanupFinalizer},
+		}},
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      "sonobuoy-run-" + string(masterUID),
+			Namespace: pluginNamespace,
+			UID:       trackerUID,
+			Labels: map[string]string{
+				"component":              "sonobuoy",
+				discovery.MasterUIDLabel: string(masterUID),
+			},
+		}},
+		&v1.Pod{ObjectMeta: owned("sonobuoy-e2e-job-" + namespace)},
+		&v1.ConfigMap{ObjectMeta: owned("sonobuoy-e2e-config-" + namespace)},
+		&v1.Secret{ObjectMeta: owned("sonobuoy-e2e-credentials-" + namespace)},
+		&rbacv1beta1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: clusterRBACName(namespace), Labels: labels()}},
+		&rbacv1beta1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: clusterRBACName(namespace), Labels: labels()}},
+	}
+}
+
+func TestDeleteOnlyTouchesItsRun(t *testing.T) {
+	objs := append(fakeRun("run-a", "plugins"), fakeRun("run-b", "plugins")...)
+	kubeClient := fake.NewSimpleClientset(objs...)
+
+	if errs := Delete(kubeClient, "run-a"); len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+
+	pods, err := kubeClient.CoreV1().Pods("plugins").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Name != "sonobuoy-e2e-job-run-b" {
+		t.Errorf("Expected only run-b's plugin pod to be left, got %v", pods.Items)
+	}
+
+	cms, err := kubeClient.CoreV1().ConfigMaps("plugins").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, cm := range cms.Items {
+		if cm.Name == "sonobuoy-e2e-config-run-a" || cm.Name == "sonobuoy-run-master-run-a" {
+			t.Errorf("Expected config map %v of run-a to be deleted", cm.Name)
+		}
+	}
+	if len(cms.Items) != 2 {
+		t.Errorf("Expected run-b's config maps to be left, got %v", cms.Items)
+	}
+
+	secrets, err := kubeClient.CoreV1().Secrets("plugins").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(secrets.Items) != 1 || secrets.Items[0].Name != "sonobuoy-e2e-credentials-run-b" {
+		t.Errorf("Expected only run-b's credentials to be left, got %v", secrets.Items)
+	}
+
+	if _, err = kubeClient.RbacV1beta1().ClusterRoles().Get(clusterRBACName("run-a"), metav1.GetOptions{}); err == nil {
+		t.Errorf("Expected run-a's cluster role to be deleted")
+	}
+	if _, err = kubeClient.RbacV1beta1().ClusterRoles().Get(clusterRBACName("run-b"), metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected run-b's cluster role to be left: %v", err)
+	}
+	if _, err = kubeClient.RbacV1beta1().ClusterRoleBindings().Get(clusterRBACName("run-b"), metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected run-b's cluster role binding to be left: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gcSelector selects the resources created by plugins, in any session
+const gcSelector = componentSelector + "," + plugin.SessionLabel
+
+// PluginResource is an object created by a plugin, as found by
+// GarbageCollect.
+type PluginResource struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Plugin is the name of the plugin that created the resource
+	Plugin string
+	// Session is the session ID of the plugin, from its SessionLabel. It's
+	// empty for the ConfigMaps tracking the resources of a master's
+	// plugins in another namespace, see discovery.MasterUIDLabel.
+	Session string
+	Created time.Time
+	// Active is whether a sonobuoy master that's still running claims the
+	// resource's session
+	Active bool
+	// Collect is whether the resource is (or, in a dry run, would be)
+	// deleted
+	Collect bool
+
+	// masterUID is the UID of the master a tracking ConfigMap is for
+	masterUID types.UID
+}
+
+// GCOptions controls which plugin resources GarbageCollect deletes.
+type GCOptions struct {
+	// OlderThan, if set, also collects resources older than this, even if
+	// their run is still active
+	OlderThan time.Duration
+	// DryRun only reports what would be deleted
+	DryRun bool
+}
+
+// collectable returns whether a resource should be collected: if no running
+// master claims it, or it's older than opts.OlderThan.
+func collectable(r *PluginResource, opts GCOptions, now time.Time) bool {
+	if !r.Active {
+		return true
+	}
+	return opts.OlderThan > 0 && now.Sub(r.Created) > opts.OlderThan
+}
+
+// GarbageCollect finds the resources plugins have created in every
+// namespace, and deletes those left behind by runs whose master is no longer
+// running, along with any older than opts.OlderThan. Every resource found is
+// returned, whether collected or not. Masters that are gone, but still have
+// the discovery.CleanupFinalizer, are released.
+//
+// A run's resources are only known to be active if its master runs in a pod
+// and reports its status there, so runs whose master runs elsewhere look
+// orphaned; use opts.DryRun to check first.
+func GarbageCollect(kubeClient kubernetes.Interface, opts GCOptions) ([]PluginResource, []error) {
+	var errs []error
+
+	masters, err := findMasters(kubeClient)
+	if err != nil {
+		return nil, append(errs, err)
+	}
+
+	resources, errs := listPluginResources(kubeClient)
+	now := time.Now()
+	for i := range resources {
+		r := &resources[i]
+		if r.Session != "" {
+			r.Active = masters.sessions[r.Session]
+		} else {
+			r.Active = masters.uids[r.masterUID]
+		}
+		r.Collect = collectable(r, opts, now)
+	}
+
+	if opts.DryRun {
+		return resources, errs
+	}
+
+	gracePeriod := int64(1)
+	deletionPolicy := metav1.DeletePropagationBackground
+	deleteOptions := &metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &deletionPolicy,
+	}
+	for _, r := range resources {
+		if !r.Collect {
+			continue
+		}
+
+		glog.V(2).Infof("Deleting %v %v/%v", r.Kind, r.Namespace, r.Name)
+		var err error
+		switch r.Kind {
+		case "DaemonSet":
+			err = kubeClient.ExtensionsV1beta1().DaemonSets(r.Namespace).Delete(r.Name, deleteOptions)
+		case "Pod":
+			err = kubeClient.CoreV1().Pods(r.Namespace).Delete(r.Name, deleteOptions)
+		case "ConfigMap":
+			err = kubeClient.CoreV1().ConfigMaps(r.Namespace).Delete(r.Name, deleteOptions)
+		case "Secret":
+			err = kubeClient.CoreV1().Secrets(r.Namespace).Delete(r.Name, deleteOptions)
+		}
+		// Pods of a DaemonSet may already be gone with it
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("error deleting %v %v/%v: %v", r.Kind, r.Namespace, r.Name, err))
+		}
+	}
+
+	for i := range masters.released {
+		errs = append(errs, discovery.ReleaseMaster(kubeClient, &masters.released[i])...)
+	}
+
+	return resources, errs
+}
+
+// masterSet is the sonobuoy masters found in the cluster.
+type masterSet struct {
+	// sessions are the plugin sessions claimed by running masters
+	sessions map[string]bool
+	// uids are the UIDs of the running masters
+	uids map[types.UID]bool
+	// released are the masters that are finished or being deleted, but
+	// still hold the discovery.CleanupFinalizer
+	released []v1.Pod
+}
+
+// findMasters finds the sonobuoy masters in every namespace.
+func findMasters(kubeClient kubernetes.Interface) (*masterSet, error) {
+	pods, err := kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: componentSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list sonobuoy masters: %v", err)
+	}
+
+	found := &masterSet{
+		sessions: make(map[string]bool),
+		uids:     make(map[types.UID]bool),
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			if discovery.HasCleanupFinalizer(&pod) {
+				found.released = append(found.released, pod)
+			}
+			continue
+		}
+		found.uids[pod.UID] = true
+
+		blob, ok := pod.Annotations[discovery.StatusAnnotation]
+		if !ok {
+			continue
+		}
+
+		var run discovery.RunStatus
+		if err = json.Unmarshal([]byte(blob), &run); err != nil {
+			glog.Warningf("Could not parse the %v annotation of pod %v/%v: %v", discovery.StatusAnnotation, pod.Namespace, pod.Name, err)
+			continue
+		}
+		for _, session := range run.Sessions {
+			found.sessions[session] = true
+		}
+	}
+
+	return found, nil
+}
+
+// listPluginResources lists the resources of every kind the plugin drivers
+// create, sorted by session.
+func listPluginResources(kubeClient kubernetes.Interface) ([]PluginResource, []error) {
+	var resources []PluginResource
+	var errs []error
+	opts := metav1.ListOptions{LabelSelector: gcSelector}
+	add := func(kind string, meta metav1.ObjectMeta) {
+		resources = append(resources, PluginResource{
+			Kind:      kind,
+			Namespace: meta.Namespace,
+			Name:      meta.Name,
+			Plugin:    meta.Labels["sonobuoy-plugin"],
+			Session:   meta.Labels[plugin.SessionLabel],
+			Created:   meta.CreationTimestamp.Time,
+		})
+	}
+
+	if dsets, err := kubeClient.ExtensionsV1beta1().DaemonSets(metav1.NamespaceAll).List(opts); err != nil {
+		errs = append(errs, fmt.Errorf("could not list plugin daemonsets: %v", err))
+	} else {
+		for _, ds := range dsets.Items {
+			add("DaemonSet", ds.ObjectMeta)
+		}
+	}
+	if pods, err := kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(opts); err != nil {
+		errs = append(errs, fmt.Errorf("could not list plugin pods: %v", err))
+	} else {
+		for _, pod := range pods.Items {
+			add("Pod", pod.ObjectMeta)
+		}
+	}
+	if cms, err := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(opts); err != nil {
+		errs = append(errs, fmt.Errorf("could not list plugin config maps: %v", err))
+	} else {
+		for _, cm := range cms.Items {
+			add("ConfigMap", cm.ObjectMeta)
+		}
+	}
+	if secrets, err := kubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(opts); err != nil {
+		errs = append(errs, fmt.Errorf("could not list plugin secrets: %v", err))
+	} else {
+		for _, secret := range secrets.Items {
+			add("Secret", secret.ObjectMeta)
+		}
+	}
+
+	trackers, err := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: discovery.MasterUIDLabel,
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not list tracking config maps: %v", err))
+	} else {
+		for _, cm := range trackers.Items {
+			add("ConfigMap", cm.ObjectMeta)
+			resources[len(resources)-1].masterUID = types.UID(cm.Labels[discovery.MasterUIDLabel])
+		}
+	}
+
+	sort.SliceStable(resources, func(i, j int) bool {
+		return resources[i].Session < resources[j].Session
+	})
+
+	return resources, errs
+}
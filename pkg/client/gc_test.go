@@ -0,0 +1,91 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCollectable(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		active    bool
+		age       time.Duration
+		olderThan time.Duration
+		collect   bool
+	}{
+		{name: "orphaned", age: time.Minute, collect: true},
+		{name: "active", active: true, age: 48 * time.Hour},
+		{name: "active and young", active: true, age: time.Hour, olderThan: 24 * time.Hour},
+		{name: "active and old", active: true, age: 48 * time.Hour, olderThan: 24 * time.Hour, collect: true},
+		{name: "orphaned and young", age: time.Hour, olderThan: 24 * time.Hour, collect: true},
+	}
+
+	for _, test := range tests {
+		r := &PluginResource{Active: test.active, Created: now.Add(-test.age)}
+		if collect := collectable(r, GCOptions{OlderThan: test.olderThan}, now); collect != test.collect {
+			t.Errorf("%v: expected collect %v, got %v", test.name, test.collect, collect)
+		}
+	}
+}
+
+func TestGarbageCollectReleasesCrashedMaster(t *testing.T) {
+	objs := fakeRun("run-a", "plugins")
+	master := objs[0].(*v1.Pod)
+	master.Status.Phase = v1.PodFailed
+	kubeClient := fake.NewSimpleClientset(objs...)
+
+	// The fake clientset doesn't apply patches, so record them
+	var patches []string
+	kubeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches = append(patches, string(action.(k8stesting.PatchAction).GetPatch()))
+		return true, master, nil
+	})
+
+	status, err := GetStatus(kubeClient, "run-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !status.AwaitingRelease {
+		t.Errorf("Expected the crashed master to be reported as awaiting release")
+	}
+
+	if _, errs := GarbageCollect(kubeClient, GCOptions{}); len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+
+	cms, err := kubeClient.CoreV1().ConfigMaps("plugins").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cms.Items) != 0 {
+		t.Errorf("Expected the tracking and plugin config maps to be deleted, got %v", cms.Items)
+	}
+	if len(patches) != 1 || !strings.Contains(patches[0], `"op":"remove"`) || !strings.Contains(patches[0], discovery.CleanupFinalizer) {
+		t.Errorf("Expected the finalizer to be removed from the master, got patches %v", patches)
+	}
+}
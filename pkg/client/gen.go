@@ -0,0 +1,339 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/loader"
+	v1 "k8s.io/api/core/v1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// DefaultNamespace is the namespace the sonobuoy master runs in
+	DefaultNamespace = "heptio-sonobuoy"
+	// MasterPodName is the name of the sonobuoy master pod
+	MasterPodName = "sonobuoy"
+	// MasterContainerName is the name of the container running sonobuoy in
+	// the master pod
+	MasterContainerName = "kube-sonobuoy"
+	// MasterServiceName is the name of the service workers report results to
+	MasterServiceName = "sonobuoy-master"
+	// MasterResultsPath is where the master writes results within its pod
+	MasterResultsPath = "/tmp/sonobuoy"
+
+	serviceAccountName   = "sonobuoy-serviceaccount"
+	configConfigMapName  = "sonobuoy-config-cm"
+	pluginsConfigMapName = "sonobuoy-plugins-cm"
+	masterPort           = 8080
+)
+
+// DefaultPlugins are the plugins run when none are given
+var DefaultPlugins = []string{"e2e", "systemd_logs"}
+
+// GenConfig holds the settings used to generate the manifests for a sonobuoy
+// run.
+type GenConfig struct {
+	// Namespace is the namespace to run the master (and plugins) in
+	Namespace string
+	// Image is the sonobuoy image used by the master and plugin workers
+	Image string
+	// Plugins are the names of the plugins to run
+	Plugins []string
+	// Resources are the resources to collect, see config.Config.Resources
+	Resources []string
+	// E2EFocus and E2ESkip are regular expressions selecting which e2e
+	// tests to run, if the e2e plugin is selected. When empty, the e2e
+	// plugin's defaults are used.
+	E2EFocus string
+	E2ESkip  string
+}
+
+// NewGenConfig returns a GenConfig with default values.
+func NewGenConfig() *GenConfig {
+	return &GenConfig{
+		Namespace: DefaultNamespace,
+		Image:     DefaultImage(),
+		Plugins:   DefaultPlugins,
+		Resources: config.NewWithDefaults().Resources,
+	}
+}
+
+// DefaultImage returns the sonobuoy image matching this build, falling back
+// to the latest published image for builds that don't set one.
+func DefaultImage() string {
+	if buildinfo.DockerImage == "" {
+		return "gcr.io/heptio-images/sonobuoy:latest"
+	}
+	if buildinfo.Version == "" {
+		return buildinfo.DockerImage + ":latest"
+	}
+	return buildinfo.DockerImage + ":" + buildinfo.Version
+}
+
+// Labels are applied to everything generated, so that it can all be found
+// (and torn down) together.
+func labels() map[string]string {
+	return map[string]string{"component": "sonobuoy"}
+}
+
+// MasterConfig returns the config.json the master will run with.
+func (cfg *GenConfig) MasterConfig() *config.Config {
+	mcfg := config.NewWithDefaults()
+	mcfg.Description = "Generated by sonobuoy gen"
+	// Leave the UUID out, so that each run of the master picks its own
+	// rather than every run from this manifest sharing one.
+	mcfg.UUID = ""
+	mcfg.ResultsDir = MasterResultsPath
+	mcfg.Resources = cfg.Resources
+	mcfg.PluginNamespace = cfg.Namespace
+	mcfg.Aggregation.AdvertiseAddress = fmt.Sprintf("%v:%d", MasterServiceName, masterPort)
+	mcfg.Aggregation.BindPort = masterPort
+	mcfg.PluginSelections = nil
+	for _, name := range cfg.Plugins {
+		mcfg.PluginSelections = append(mcfg.PluginSelections, plugin.Selection{
+			Name:   name,
+			Config: cfg.pluginConfig(name),
+		})
+	}
+	return mcfg
+}
+
+// GenerateObjects returns every object needed to launch a sonobuoy run, in
+// the order they should be created.
+func GenerateObjects(cfg *GenConfig) ([]runtime.Object, error) {
+	configJSON, err := json.MarshalIndent(cfg.MasterConfig(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	builtins, err := builtinPlugins()
+	if err != nil {
+		return nil, err
+	}
+	pluginDefinitions := make(map[string]string, len(cfg.Plugins))
+	for _, name := range cfg.Plugins {
+		p, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown plugin %q, must be one of %v", name, pluginNames(builtins))
+		}
+		// Catch bad parameters now, rather than when the master loads them
+		if _, err = loader.LoadDefinition(p.file, []byte(p.raw), cfg.pluginConfig(name)); err != nil {
+			return nil, fmt.Errorf("invalid settings for plugin %v: %v", name, err)
+		}
+		pluginDefinitions[p.file] = p.raw
+	}
+
+	objectMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace, Labels: labels()}
+	}
+	masterLabels := labels()
+	masterLabels["run"] = MasterServiceName
+	masterMeta := objectMeta(MasterPodName)
+	masterMeta.Labels = masterLabels
+
+	return []runtime.Object{
+		&v1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: cfg.Namespace, Labels: labels()},
+		},
+		&v1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: objectMeta(serviceAccountName),
+		},
+		&rbacv1beta1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: clusterRBACName(cfg.Namespace), Labels: labels()},
+			Rules: []rbacv1beta1.PolicyRule{{
+				APIGroups: []string{"*"},
+				Resources: []string{"*"},
+				Verbs:     []string{"*"},
+			}},
+		},
+		&rbacv1beta1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: clusterRBACName(cfg.Namespace), Labels: labels()},
+			RoleRef: rbacv1beta1.RoleRef{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "ClusterRole",
+				Name:     clusterRBACName(cfg.Namespace),
+			},
+			Subjects: []rbacv1beta1.Subject{{
+				Kind:      "ServiceAccount",
+				Name:      serviceAccountName,
+				Namespace: cfg.Namespace,
+			}},
+		},
+		&v1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: objectMeta(configConfigMapName),
+			Data:       map[string]string{"config.json": string(configJSON)},
+		},
+		&v1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: objectMeta(pluginsConfigMapName),
+			Data:       pluginDefinitions,
+		},
+		&v1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: masterMeta,
+			Spec:       masterPodSpec(cfg),
+		},
+		&v1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: objectMeta(MasterServiceName),
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{{
+					Port:       masterPort,
+					Protocol:   v1.ProtocolTCP,
+					TargetPort: intstr.FromInt(masterPort),
+				}},
+				Selector: map[string]string{"run": MasterServiceName},
+				Type:     v1.ServiceTypeClusterIP,
+			},
+		},
+	}, nil
+}
+
+// GenerateManifest renders the objects from GenerateObjects as a stream of
+// YAML documents, suitable for kubectl apply -f.
+func GenerateManifest(cfg *GenConfig) ([]byte, error) {
+	objs, err := GenerateObjects(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return marshalYAML(objs)
+}
+
+// GenerateConfigMaps renders just the ConfigMaps from GenerateObjects, which
+// hold the master's config.json and the plugin definitions, as a stream of
+// YAML documents. The quickstart example's 10-configmaps.yaml is generated
+// from this, see quickstart_generate.go.
+func GenerateConfigMaps(cfg *GenConfig) ([]byte, error) {
+	objs, err := GenerateObjects(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var configMaps []runtime.Object
+	for _, obj := range objs {
+		if _, ok := obj.(*v1.ConfigMap); ok {
+			configMaps = append(configMaps, obj)
+		}
+	}
+	return marshalYAML(configMaps)
+}
+
+func marshalYAML(objs []runtime.Object) ([]byte, error) {
+	var b bytes.Buffer
+	for _, obj := range objs {
+		y, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString("---\n")
+		b.Write(y)
+	}
+	return b.Bytes(), nil
+}
+
+// clusterRBACName is the name of the cluster-scoped RBAC objects. These
+// aren't namespaced, so the namespace is part of the name to keep runs in
+// different namespaces from clobbering each other.
+func clusterRBACName(namespace string) string {
+	if namespace == DefaultNamespace {
+		return serviceAccountName
+	}
+	return serviceAccountName + "-" + namespace
+}
+
+func masterPodSpec(cfg *GenConfig) v1.PodSpec {
+	return v1.PodSpec{
+		RestartPolicy:      v1.RestartPolicyNever,
+		ServiceAccountName: serviceAccountName,
+		Containers: []v1.Container{{
+			Name:            MasterContainerName,
+			Image:           cfg.Image,
+			ImagePullPolicy: v1.PullAlways,
+			// no-exit keeps the pod around once the run is done, so the
+			// results can be copied out of it.
+			Command: []string{
+				"/bin/bash",
+				"-c",
+				"/sonobuoy master --no-exit=true -v 3 --logtostderr",
+			},
+			Env: []v1.EnvVar{
+				{
+					Name: "SONOBUOY_ADVERTISE_IP",
+					ValueFrom: &v1.EnvVarSource{
+						FieldRef: &v1.ObjectFieldSelector{FieldPath: "status.podIP"},
+					},
+				},
+				{
+					Name: discovery.PodNameEnv,
+					ValueFrom: &v1.EnvVarSource{
+						FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"},
+					},
+				},
+				{
+					Name: discovery.PodNamespaceEnv,
+					ValueFrom: &v1.EnvVarSource{
+						FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+					},
+				},
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{Name: "sonobuoy-config-volume", MountPath: "/etc/sonobuoy"},
+				{Name: "sonobuoy-plugins-volume", MountPath: "/etc/sonobuoy/plugins.d"},
+				{Name: "output-volume", MountPath: MasterResultsPath},
+			},
+		}},
+		Volumes: []v1.Volume{
+			{
+				Name: "sonobuoy-config-volume",
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{
+						LocalObjectReference: v1.LocalObjectReference{Name: configConfigMapName},
+					},
+				},
+			},
+			{
+				Name: "sonobuoy-plugins-volume",
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{
+						LocalObjectReference: v1.LocalObjectReference{Name: pluginsConfigMapName},
+					},
+				},
+			},
+			{
+				Name:         "output-volume",
+				VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+			},
+		},
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/loader"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGenerateManifest(t *testing.T) {
+	cfg := NewGenConfig()
+	cfg.Namespace = "sonobuoy-test"
+	cfg.Image = "example.com/sonobuoy:test"
+	cfg.E2ESkip = "Serial|Disruptive"
+
+	manifest, err := GenerateManifest(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	docs := strings.Split(string(manifest), "---\n")[1:]
+	expectedKinds := []string{"Namespace", "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "ConfigMap", "ConfigMap", "Pod", "Service"}
+	if len(docs) != len(expectedKinds) {
+		t.Fatalf("Expected %v documents, got %v", len(expectedKinds), len(docs))
+	}
+
+	var configMaps []v1.ConfigMap
+	for i, doc := range docs {
+		var obj struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		}
+		if err = yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			t.Fatalf("Could not parse document %v: %v", i, err)
+		}
+		if obj.Kind != expectedKinds[i] {
+			t.Errorf("Expected document %v to be a %v, got %v", i, expectedKinds[i], obj.Kind)
+		}
+		if obj.Metadata.Labels["component"] != "sonobuoy" {
+			t.Errorf("Expected %v to be labelled component=sonobuoy, got %v", obj.Kind, obj.Metadata.Labels)
+		}
+		if obj.Kind == "ConfigMap" {
+			var cm v1.ConfigMap
+			if err = yaml.Unmarshal([]byte(doc), &cm); err != nil {
+				t.Fatalf("Could not parse ConfigMap: %v", err)
+			}
+			configMaps = append(configMaps, cm)
+		}
+	}
+
+	var mcfg config.Config
+	if err = json.Unmarshal([]byte(configMaps[0].Data["config.json"]), &mcfg); err != nil {
+		t.Fatalf("Could not parse config.json: %v", err)
+	}
+	if mcfg.PluginNamespace != cfg.Namespace {
+		t.Errorf("Expected plugin namespace %v, got %v", cfg.Namespace, mcfg.PluginNamespace)
+	}
+	if len(mcfg.PluginSelections) != len(DefaultPlugins) {
+		t.Errorf("Expected plugin selections for %v, got %v", DefaultPlugins, mcfg.PluginSelections)
+	}
+
+	// The plugin definitions are shipped as is, with gen's settings passed
+	// through the selections' config, so render them as the master would.
+	selections := make(map[string]plugin.Selection, len(mcfg.PluginSelections))
+	for _, selection := range mcfg.PluginSelections {
+		selections[selection.Name] = selection
+	}
+	if configMaps[1].Data["e2e.yaml"] != pluginFiles["e2e.yaml"] {
+		t.Errorf("Expected the e2e plugin definition from plugins.d")
+	}
+	e2e, err := loader.LoadDefinition("e2e.yaml", []byte(configMaps[1].Data["e2e.yaml"]), selections["e2e"].Config)
+	if err != nil {
+		t.Fatalf("Could not load e2e plugin definition: %v", err)
+	}
+	if e2e.Name != "e2e" || e2e.Driver != "Job" {
+		t.Errorf("Unexpected e2e plugin definition: %+v", e2e)
+	}
+	env := map[string]string{}
+	for _, container := range e2e.PodSpec.Containers {
+		for _, e := range container.Env {
+			env[e.Name] = e.Value
+		}
+	}
+	if env["E2E_SKIP"] != cfg.E2ESkip {
+		t.Errorf("Expected E2E_SKIP %q, got %q", cfg.E2ESkip, env["E2E_SKIP"])
+	}
+	if env["E2E_FOCUS"] == "" {
+		t.Errorf("Expected the e2e plugin's default E2E_FOCUS")
+	}
+	if image := e2e.PodSpec.Containers[1].Image; image != cfg.Image {
+		t.Errorf("Expected worker image %v, got %v", cfg.Image, image)
+	}
+	if _, ok := configMaps[1].Data["systemdlogs.yaml"]; !ok {
+		t.Errorf("Expected a systemd_logs plugin definition")
+	}
+}
+
+func TestGenerateInvalidPluginSettings(t *testing.T) {
+	cfg := NewGenConfig()
+	cfg.Plugins = []string{"systemd_logs"}
+	cfg.E2EFocus = "Conformance"
+	if _, err := GenerateObjects(cfg); err != nil {
+		t.Errorf("E2E settings should be ignored without the e2e plugin, got %v", err)
+	}
+
+	// Every built in plugin has to take the parameters gen gives it
+	builtins, err := builtinPlugins()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg.Plugins = pluginNames(builtins)
+	if _, err = GenerateObjects(cfg); err != nil {
+		t.Errorf("Unexpected error generating all built in plugins: %v", err)
+	}
+}
+
+func TestGenerateUnknownPlugin(t *testing.T) {
+	cfg := NewGenConfig()
+	cfg.Plugins = []string{"e2e", "nonexistent"}
+	if _, err := GenerateObjects(cfg); err == nil {
+		t.Errorf("Expected an error for an unknown plugin")
+	}
+}
+
+func TestQuickstartConfigMapsUpToDate(t *testing.T) {
+	manifest, err := GenerateConfigMaps(NewGenConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	quickstart, err := ioutil.ReadFile("../../examples/quickstart/10-configmaps.yaml")
+	if err != nil {
+		t.Fatalf("Could not read the quickstart ConfigMaps: %v", err)
+	}
+	if !bytes.HasSuffix(quickstart, manifest) {
+		t.Errorf("examples/quickstart/10-configmaps.yaml is out of date, run go generate ./pkg/client")
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/loader"
+)
+
+//go:generate go run plugins_generate.go
+//go:generate go run quickstart_generate.go
+
+// builtinPlugin is one of the plugin definitions shipped in plugins.d, which
+// sonobuoy gen knows how to emit. Definitions are embedded verbatim (see
+// plugins_data.go) and rendered by the master with each selection's config,
+// so gen never has its own copy of them.
+type builtinPlugin struct {
+	// file is the name the definition has in plugins.d, which it keeps in
+	// the plugins ConfigMap
+	file string
+	raw  string
+}
+
+// builtinPlugins returns the plugin definitions embedded from plugins.d,
+// keyed by plugin name.
+func builtinPlugins() (map[string]builtinPlugin, error) {
+	plugins := make(map[string]builtinPlugin, len(pluginFiles))
+	for file, raw := range pluginFiles {
+		dfn, err := loader.LoadDefinition(file, []byte(raw), nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not load built in plugin %v: %v", file, err)
+		}
+		plugins[dfn.Name] = builtinPlugin{file: file, raw: raw}
+	}
+	return plugins, nil
+}
+
+// pluginConfig returns the parameters gen passes to the named plugin through
+// its selection in config.json.
+func (cfg *GenConfig) pluginConfig(name string) map[string]interface{} {
+	config := map[string]interface{}{"SONOBUOY_IMAGE": cfg.Image}
+	if name == "e2e" {
+		if cfg.E2EFocus != "" {
+			config["E2E_FOCUS"] = cfg.E2EFocus
+		}
+		if cfg.E2ESkip != "" {
+			config["E2E_SKIP"] = cfg.E2ESkip
+		}
+	}
+	return config
+}
+
+func pluginNames(plugins map[string]builtinPlugin) []string {
+	var names []string
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,105 @@
+//go:build ignore
+// +build ignore
+
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// plugins_generate.go embeds the plugin definitions in plugins.d into
+// plugins_data.go, so that sonobuoy gen emits exactly the definitions that
+// ship with sonobuoy. Run it with go generate after changing plugins.d.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	pluginsDir = "../../plugins.d"
+	outputFile = "plugins_data.go"
+	headerFile = "plugins_generate.go"
+)
+
+func main() {
+	if err := generate(); err != nil {
+		fmt.Fprintf(os.Stderr, "error generating %v: %v\n", outputFile, err)
+		os.Exit(1)
+	}
+}
+
+func generate() error {
+	files, err := filepath.Glob(filepath.Join(pluginsDir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	license, err := licenseHeader()
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(license)
+	b.WriteString("\n// Code generated by plugins_generate.go from plugins.d. DO NOT EDIT.\n\n")
+	b.WriteString("package client\n\n")
+	b.WriteString("// pluginFiles are the plugin definitions in plugins.d, keyed by file name.\n")
+	b.WriteString("var pluginFiles = map[string]string{\n")
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%q: %v,\n", filepath.Base(file), literal(string(contents)))
+	}
+	b.WriteString("}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputFile, src, 0644)
+}
+
+// literal returns s as a raw string literal if it can be written as one, so
+// that the definitions are readable in the generated file.
+func literal(s string) string {
+	if strings.Contains(s, "`") || strings.Contains(s, "\r") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// licenseHeader returns the license comment at the top of this file.
+func licenseHeader() (string, error) {
+	src, err := ioutil.ReadFile(headerFile)
+	if err != nil {
+		return "", err
+	}
+	start := bytes.Index(src, []byte("/*"))
+	end := bytes.Index(src, []byte("*/\n"))
+	if start < 0 || end < start {
+		return "", fmt.Errorf("no license header in %v", headerFile)
+	}
+	return string(src[start : end+3]), nil
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPluginFilesUpToDate(t *testing.T) {
+	files, err := filepath.Glob("../../plugins.d/*.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != len(pluginFiles) {
+		t.Errorf("Expected %v embedded plugin definitions, got %v", len(files), len(pluginFiles))
+	}
+
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if pluginFiles[filepath.Base(file)] != string(contents) {
+			t.Errorf("plugins_data.go is out of date for %v, run go generate ./pkg/client", file)
+		}
+	}
+}
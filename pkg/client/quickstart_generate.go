@@ -0,0 +1,71 @@
+//go:build ignore
+// +build ignore
+
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// quickstart_generate.go writes the quickstart example's ConfigMaps, holding
+// the master's config.json and the plugin definitions, from what sonobuoy gen
+// emits by default. That way the example uses the definitions in plugins.d
+// rather than a copy of its own. Run it with go generate after changing
+// plugins.d or gen.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/heptio/sonobuoy/pkg/client"
+)
+
+const outputFile = "../../examples/quickstart/10-configmaps.yaml"
+
+const header = `# Copyright 2017 Heptio Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Generated from plugins.d by go generate ./pkg/client. To change this file
+# in the repo, change plugins.d or sonobuoy gen instead.
+#
+# Plugin settings, like the e2e plugin's E2E_FOCUS, go in the plugin's
+# "config" in config.json below, eg.
+#   {"name": "e2e", "config": {"E2E_FOCUS": "Conformance"}}
+`
+
+func main() {
+	manifest, err := client.GenerateConfigMaps(client.NewGenConfig())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error generating %v: %v\n", outputFile, err)
+		os.Exit(1)
+	}
+
+	contents := append([]byte(header), manifest...)
+	if err = ioutil.WriteFile(outputFile, contents, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing %v: %v\n", outputFile, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// RetrieveResults copies the results tarball of the finished sonobuoy run in
+// the given namespace into outdir, returning the path it was written to.
+// Like kubectl cp, it streams the tarball out of the master pod with tar over
+// pods/exec, so it takes the same RBAC permissions as kubectl cp would.
+func RetrieveResults(restConfig *rest.Config, namespace, outdir string) (string, error) {
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := GetStatus(kubeClient, namespace)
+	if err != nil {
+		return "", err
+	}
+	if !status.Complete || status.Tarball == "" {
+		return "", fmt.Errorf("sonobuoy run in namespace %v has not finished yet", namespace)
+	}
+
+	if err = os.MkdirAll(outdir, 0755); err != nil {
+		return "", err
+	}
+
+	reader, writer := io.Pipe()
+	execErr := make(chan error, 1)
+	go func() {
+		err := execTar(restConfig, kubeClient, namespace, status.Tarball, writer)
+		writer.CloseWithError(err)
+		execErr <- err
+	}()
+
+	outfile, copyErr := copyFromTar(reader, path.Base(status.Tarball), outdir)
+	// Let tar finish writing, whatever we made of it
+	io.Copy(ioutil.Discard, reader)
+
+	// If tar failed, that's likely why the copy did too
+	if err = <-execErr; err == nil {
+		err = copyErr
+	}
+	if err != nil {
+		if outfile != "" {
+			os.Remove(outfile)
+		}
+		return "", fmt.Errorf("could not copy results out of the master pod: %v", err)
+	}
+	return outfile, nil
+}
+
+// execTar runs tar in the master pod's sonobuoy container, writing an archive
+// holding just the file at the given path to w.
+func execTar(restConfig *rest.Config, kubeClient kubernetes.Interface, namespace, file string, w io.Writer) error {
+	req := kubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(MasterPodName).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: MasterContainerName,
+			Command:   []string{"tar", "cf", "-", "-C", path.Dir(file), path.Base(file)},
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(restConfig, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	if err = exec.Stream(remotecommand.StreamOptions{Stdout: w, Stderr: &stderr}); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %v", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// copyFromTar reads a tar archive from r, writing the regular file in it
+// with the given name to outdir and returning the path it was written to.
+// Anything else in the archive is ignored.
+func copyFromTar(r io.Reader, name, outdir string) (string, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("%v not found in archive", name)
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Clean(hdr.Name) != name {
+			continue
+		}
+
+		outfile := filepath.Join(outdir, name)
+		f, err := os.Create(outfile)
+		if err != nil {
+			return "", err
+		}
+		if _, err = io.Copy(f, tr); err != nil {
+			f.Close()
+			os.Remove(outfile)
+			return "", err
+		}
+		return outfile, f.Close()
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFromTar(t *testing.T) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	files := []struct {
+		name     string
+		contents string
+	}{
+		{"../201710171200_sonobuoy_abc.tar.gz", "escaped"},
+		{"other.txt", "other"},
+		{"201710171200_sonobuoy_abc.tar.gz", "results"},
+	}
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.contents)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := tw.Write([]byte(file.contents)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outdir, err := ioutil.TempDir("", "sonobuoy-retrieve")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	outfile, err := copyFromTar(bytes.NewReader(b.Bytes()), "201710171200_sonobuoy_abc.tar.gz", outdir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := filepath.Join(outdir, "201710171200_sonobuoy_abc.tar.gz"); outfile != expected {
+		t.Errorf("Expected results at %v, got %v", expected, outfile)
+	}
+	contents, err := ioutil.ReadFile(outfile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(contents) != "results" {
+		t.Errorf("Expected the results file's contents, got %q", contents)
+	}
+
+	if _, err = copyFromTar(bytes.NewReader(b.Bytes()), "missing.tar.gz", outdir); err == nil {
+		t.Errorf("Expected an error for a file missing from the archive")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Run launches a sonobuoy run by creating the objects from GenerateObjects.
+// The namespace and cluster RBAC may already exist (eg. from a previous run
+// that was retrieved but not deleted), but anything else existing is an
+// error, since it most likely belongs to a run that's still going.
+func Run(kubeClient kubernetes.Interface, cfg *GenConfig) error {
+	objs, err := GenerateObjects(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		name, shared, err := createObject(kubeClient, obj)
+		if err != nil {
+			if shared && errors.IsAlreadyExists(err) {
+				glog.V(2).Infof("%v already exists, reusing it", name)
+				continue
+			}
+			return fmt.Errorf("could not create %v: %v", name, err)
+		}
+		glog.V(2).Infof("Created %v", name)
+	}
+	return nil
+}
+
+// createObject creates one of the objects from GenerateObjects, returning a
+// description of it for messages and whether it can safely be shared
+// between runs.
+func createObject(kubeClient kubernetes.Interface, obj runtime.Object) (name string, shared bool, err error) {
+	switch o := obj.(type) {
+	case *v1.Namespace:
+		_, err = kubeClient.CoreV1().Namespaces().Create(o)
+		return "namespace " + o.Name, true, err
+	case *v1.ServiceAccount:
+		_, err = kubeClient.CoreV1().ServiceAccounts(o.Namespace).Create(o)
+		return "service account " + o.Name, true, err
+	case *rbacv1beta1.ClusterRole:
+		_, err = kubeClient.RbacV1beta1().ClusterRoles().Create(o)
+		return "cluster role " + o.Name, true, err
+	case *rbacv1beta1.ClusterRoleBinding:
+		_, err = kubeClient.RbacV1beta1().ClusterRoleBindings().Create(o)
+		return "cluster role binding " + o.Name, true, err
+	case *v1.ConfigMap:
+		_, err = kubeClient.CoreV1().ConfigMaps(o.Namespace).Create(o)
+		return "config map " + o.Name, false, err
+	case *v1.Pod:
+		_, err = kubeClient.CoreV1().Pods(o.Namespace).Create(o)
+		return "pod " + o.Name, false, err
+	case *v1.Service:
+		_, err = kubeClient.CoreV1().Services(o.Namespace).Create(o)
+		return "service " + o.Name, false, err
+	default:
+		return "", false, fmt.Errorf("don't know how to create %T", obj)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Status is the progress of a sonobuoy run.
+type Status struct {
+	// MasterPhase is the phase of the master pod
+	MasterPhase v1.PodPhase
+	// AwaitingRelease is whether the master has exited or is being deleted
+	// without having released its pod from discovery.CleanupFinalizer, most
+	// likely because it crashed. The pod is kept until `sonobuoy gc` or
+	// `sonobuoy delete` cleans up its plugins' resources and releases it.
+	AwaitingRelease bool
+	// Complete is whether the master has finished and written its results,
+	// which may be incomplete if the run was interrupted (see Run.Phase)
+	Complete bool
+	// Tarball is the path of the results tarball within the master pod,
+	// once the run is complete
+	Tarball string
+	// Plugins are the pods launched by plugins that haven't yet been
+	// cleaned up
+	Plugins []PluginPodStatus
+	// Run is the summary the master writes onto its pod, if it has written
+	// one yet
+	Run *discovery.RunStatus
+	// Aggregation is the progress reported by the aggregation server, if it
+	// is running
+	Aggregation *aggregation.Status
+}
+
+// PluginPodStatus is the status of a single pod launched by a plugin.
+type PluginPodStatus struct {
+	Plugin string
+	Pod    string
+	Node   string
+	Phase  v1.PodPhase
+}
+
+// GetStatus reports on the progress of the sonobuoy run in the given
+// namespace, as the master reports it in its pod's StatusAnnotation.
+func GetStatus(kubeClient kubernetes.Interface, namespace string) (*Status, error) {
+	pod, err := kubeClient.CoreV1().Pods(namespace).Get(MasterPodName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("no sonobuoy run found in namespace %v", namespace)
+		}
+		return nil, err
+	}
+
+	status := &Status{MasterPhase: pod.Status.Phase}
+	stopped := pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+	status.AwaitingRelease = stopped && discovery.HasCleanupFinalizer(pod)
+
+	if blob, ok := pod.Annotations[discovery.StatusAnnotation]; ok {
+		var run discovery.RunStatus
+		if err = json.Unmarshal([]byte(blob), &run); err != nil {
+			glog.Warningf("Could not parse the master's %v annotation: %v", discovery.StatusAnnotation, err)
+		} else {
+			status.Run = &run
+			status.Complete = runComplete(&run)
+			status.Tarball = run.Tarball
+		}
+	}
+
+	// The aggregation server only runs while plugins are, so failing to
+	// reach it isn't an error.
+	if pod.Status.Phase == v1.PodRunning && !status.Complete {
+		status.Aggregation, err = getAggregationStatus(kubeClient, namespace)
+		if err != nil {
+			glog.V(2).Infof("Could not get status from the aggregation server: %v", err)
+		}
+	}
+
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: plugin.SessionLabel,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pods.Items {
+		status.Plugins = append(status.Plugins, PluginPodStatus{
+			Plugin: p.Labels["sonobuoy-plugin"],
+			Pod:    p.Name,
+			Node:   p.Spec.NodeName,
+			Phase:  p.Status.Phase,
+		})
+	}
+	sort.Slice(status.Plugins, func(i, j int) bool {
+		a, b := status.Plugins[i], status.Plugins[j]
+		if a.Plugin != b.Plugin {
+			return a.Plugin < b.Plugin
+		}
+		return a.Pod < b.Pod
+	})
+
+	return status, nil
+}
+
+// getAggregationStatus reads the status API of the aggregation server through
+// the API server's service proxy.
+func getAggregationStatus(kubeClient kubernetes.Interface, namespace string) (*aggregation.Status, error) {
+	body, err := kubeClient.CoreV1().Services(namespace).ProxyGet(
+		// The aggregation server only speaks TLS, with a certificate from the
+		// run's own authority, which the API server doesn't verify.
+		"https", MasterServiceName, strconv.Itoa(masterPort), aggregation.StatusPath, nil,
+	).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var status aggregation.Status
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// runComplete returns whether the run has finished and written its results
+// tarball, even if they're incomplete because the run was interrupted.
+func runComplete(run *discovery.RunStatus) bool {
+	switch run.Phase {
+	case discovery.PhaseComplete, discovery.PhaseIncomplete:
+		return run.Tarball != ""
+	}
+	return false
+}
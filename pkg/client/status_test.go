@@ -0,0 +1,109 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// unreachable is the response of an aggregation server that isn't running.
+type unreachable struct{}
+
+func (unreachable) DoRaw() ([]byte, error)         { return nil, errors.New("unreachable") }
+func (unreachable) Stream() (io.ReadCloser, error) { return nil, errors.New("unreachable") }
+
+func TestGetStatus(t *testing.T) {
+	const tarball = "/tmp/sonobuoy/201710171030_sonobuoy_abc.tar.gz"
+
+	tests := []struct {
+		name     string
+		run      *discovery.RunStatus
+		complete bool
+		tarball  string
+	}{
+		{
+			name: "not yet reported",
+		},
+		{
+			name: "running",
+			run:  &discovery.RunStatus{Phase: discovery.PhaseRunningPlugins},
+		},
+		{
+			name: "collecting",
+			run:  &discovery.RunStatus{Phase: discovery.PhaseCollecting},
+		},
+		{
+			name:     "complete",
+			run:      &discovery.RunStatus{Phase: discovery.PhaseComplete, Tarball: tarball},
+			complete: true,
+			tarball:  tarball,
+		},
+		{
+			name:     "incomplete",
+			run:      &discovery.RunStatus{Phase: discovery.PhaseIncomplete, Tarball: tarball},
+			complete: true,
+			tarball:  tarball,
+		},
+		{
+			name: "failed",
+			run:  &discovery.RunStatus{Phase: discovery.PhaseFailed},
+		},
+	}
+
+	for _, test := range tests {
+		master := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: MasterPodName, Namespace: "heptio-sonobuoy"},
+			Status:     v1.PodStatus{Phase: v1.PodRunning},
+		}
+		if test.run != nil {
+			blob, err := json.Marshal(test.run)
+			if err != nil {
+				t.Fatal(err)
+			}
+			master.Annotations = map[string]string{discovery.StatusAnnotation: string(blob)}
+		}
+
+		kubeClient := fake.NewSimpleClientset(master)
+		kubeClient.PrependProxyReactor("services", func(k8stesting.Action) (bool, rest.ResponseWrapper, error) {
+			return true, unreachable{}, nil
+		})
+
+		status, err := GetStatus(kubeClient, "heptio-sonobuoy")
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if status.Complete != test.complete || status.Tarball != test.tarball {
+			t.Errorf("%v: expected (%v, %q), got (%v, %q)", test.name, test.complete, test.tarball, status.Complete, status.Tarball)
+		}
+		if (status.Run == nil) != (test.run == nil) {
+			t.Errorf("%v: expected run status %v, got %v", test.name, test.run, status.Run)
+		} else if status.Run != nil && status.Run.Phase != test.run.Phase {
+			t.Errorf("%v: expected phase %q, got %q", test.name, test.run.Phase, status.Run.Phase)
+		}
+	}
+}
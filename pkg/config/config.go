@@ -25,13 +25,16 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// ClusterResources is the list of API resources that are scoped to the entire
-// cluster (ie. not to any particular namespace)
+// ClusterResources is the default list of API resources that are scoped to
+// the entire cluster (ie. not to any particular namespace). Any other resource
+// advertised by the API server, including custom resources, can be collected
+// by adding its name to Resources.
 var ClusterResources = []string{
 	"CertificateSigningRequests",
 	"ClusterRoleBindings",
 	"ClusterRoles",
 	"ComponentStatuses",
+	"CustomResourceDefinitions",
 	"Nodes",
 	"PersistentVolumes",
 	"PodSecurityPolicies",
@@ -40,8 +43,8 @@ var ClusterResources = []string{
 	"ThirdPartyResources",
 }
 
-// NamespacedResources is the list of API resources that are scoped to a
-// kubernetes namespace.
+// NamespacedResources is the default list of API resources that are scoped to
+// a kubernetes namespace.
 var NamespacedResources = []string{
 	"ConfigMaps",
 	//"CronJobs",
@@ -53,6 +56,7 @@ var NamespacedResources = []string{
 	"Ingresses",
 	"Jobs",
 	"LimitRanges",
+	"NetworkPolicies",
 	"PersistentVolumeClaims",
 	"PodDisruptionBudgets",
 	"PodLogs",
@@ -76,6 +80,46 @@ type FilterOptions struct {
 	LabelSelector string `json:"LabelSelector"`
 }
 
+// LimitOptions control how hard sonobuoy queries the API server
+type LimitOptions struct {
+	// Concurrency is the maximum number of queries in flight at once
+	Concurrency int `json:"Concurrency"`
+	// QPS is the sustained rate of requests per second allowed to the API server
+	QPS float32 `json:"QPS"`
+	// Burst is the number of requests allowed above QPS for short periods
+	Burst int `json:"Burst"`
+	// PageSize is the number of objects fetched per list request, so that
+	// large lists are never held in memory all at once. 0 disables paging.
+	PageSize int64 `json:"PageSize"`
+}
+
+// RedactionOptions control how sensitive values are scrubbed from collected
+// resources before they are written to the results tarball.
+type RedactionOptions struct {
+	// Enabled turns redaction on. When enabled, the values of every Secret's
+	// data and stringData, and its last-applied-configuration annotation,
+	// are always replaced by hashes.
+	Enabled bool `json:"Enabled"`
+	// EnvPatterns are regular expressions matched against "NAME=value" for
+	// each container environment variable; the values of any that match are
+	// redacted.
+	EnvPatterns []string `json:"EnvPatterns"`
+	// Annotations are the annotation keys whose values are redacted.
+	Annotations []string `json:"Annotations"`
+	// Rules are additional fields to redact.
+	Rules []RedactionRule `json:"Rules"`
+}
+
+// RedactionRule selects fields to redact with a JSONPath-style expression,
+// such as "data.*" or "spec.containers[*].args".
+type RedactionRule struct {
+	// Resources limits the rule to the named resources, matched the same way
+	// as Config.Resources. The rule applies to every resource if empty.
+	Resources []string `json:"Resources"`
+	// Path is the path of the fields to redact.
+	Path string `json:"Path"`
+}
+
 // Config is the input struct used to determine what data to collect.
 type Config struct {
 	// NOTE: viper uses "mapstructure" as the tag for config
@@ -90,7 +134,7 @@ type Config struct {
 	// Meta-Data collection options
 	///////////////////////////////////////////////
 	Description string `json:"Description" mapstructure:"Description"`
-	UUID        string `json:"UUID" mapstructure:"UUID"`
+	UUID        string `json:"UUID,omitempty" mapstructure:"UUID"`
 	Version     string `json:"Version" mapstructure:"Version"`
 	ResultsDir  string `json:"ResultsDir" mapstructure:"ResultsDir"`
 	Kubeconfig  string `json:"Kubeconfig" mapstructure:"Kubeconfig"`
@@ -105,6 +149,16 @@ type Config struct {
 	///////////////////////////////////////////////
 	Filters FilterOptions `json:"Filters" mapstructure:"Filters"`
 
+	///////////////////////////////////////////////
+	// Query limit options
+	///////////////////////////////////////////////
+	Limits LimitOptions `json:"Limits" mapstructure:"Limits"`
+
+	///////////////////////////////////////////////
+	// Redaction options
+	///////////////////////////////////////////////
+	Redaction RedactionOptions `json:"Redaction" mapstructure:"Redaction"`
+
 	///////////////////////////////////////////////
 	// plugin configurations settings
 	///////////////////////////////////////////////
@@ -112,7 +166,7 @@ type Config struct {
 	PluginSelections []plugin.Selection       `json:"Plugins" mapstructure:"Plugins"`
 	PluginSearchPath []string                 `json:"PluginSearchPath" mapstructure:"PluginSearchPath"`
 	PluginNamespace  string                   `json:"PluginNamespace" mapstructure:"PluginNamespace"`
-	LoadedPlugins    []plugin.Interface       // this is assigned when plugins are loaded.
+	LoadedPlugins    []plugin.Interface       `json:"-" mapstructure:"-"` // this is assigned when plugins are loaded.
 }
 
 // FilterResources is a utility function used to parse Resources
@@ -145,6 +199,19 @@ func NewWithDefaults() *Config {
 
 	cfg.Filters.Namespaces = ".*"
 
+	cfg.Limits.Concurrency = 10
+	cfg.Limits.QPS = 30
+	cfg.Limits.Burst = 50
+	cfg.Limits.PageSize = 500
+
+	cfg.Redaction.Enabled = true
+	cfg.Redaction.EnvPatterns = []string{
+		"(?i)(password|passwd|secret|token|credential|api_?key)[^=]*=",
+	}
+	cfg.Redaction.Annotations = []string{
+		"kubectl.kubernetes.io/last-applied-configuration",
+	}
+
 	cfg.Resources = ClusterResources
 	cfg.Resources = append(cfg.Resources, NamespacedResources...)
 
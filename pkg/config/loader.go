@@ -85,6 +85,14 @@ func LoadConfig() (*Config, error) {
 	if viper.IsSet("Resources") {
 		cfg.Resources = viper.GetStringSlice("Resources")
 	}
+	// Likewise for the redaction lists, which are easy to accidentally
+	// extend rather than replace.
+	if viper.IsSet("Redaction.EnvPatterns") {
+		cfg.Redaction.EnvPatterns = viper.GetStringSlice("Redaction.EnvPatterns")
+	}
+	if viper.IsSet("Redaction.Annotations") {
+		cfg.Redaction.Annotations = viper.GetStringSlice("Redaction.Annotations")
+	}
 
 	// 5 - Load any plugins we have
 	err = loadAllPlugins(cfg)
@@ -108,6 +116,8 @@ func LoadClient(cfg *Config) (kubernetes.Interface, error) {
 	if err != nil {
 		return nil, err
 	}
+	config.QPS = cfg.Limits.QPS
+	config.Burst = cfg.Limits.Burst
 
 	// 2 - creates the clientset from kubeconfig
 	clientset, err := kubernetes.NewForConfig(config)
@@ -124,7 +134,7 @@ func loadAllPlugins(cfg *Config) error {
 	var plugins []plugin.Interface
 
 	// Load all Plugins
-	plugins, err := pluginloader.LoadAllPlugins(cfg.PluginNamespace, cfg.PluginSearchPath, cfg.PluginSelections, cfg.Aggregation.AdvertiseAddress)
+	plugins, err := pluginloader.LoadAllPlugins(cfg.PluginNamespace, cfg.PluginSearchPath, cfg.PluginSelections, cfg.Aggregation.AdvertiseAddress, cfg.OutputDir())
 	if err != nil {
 		return err
 	}
@@ -133,7 +143,7 @@ func loadAllPlugins(cfg *Config) error {
 	for _, sel := range cfg.PluginSelections {
 		found := false
 		for _, p := range plugins {
-			if p.GetName() == sel.Name {
+			if p.GetName() == sel.InstanceName() {
 				found = true
 			}
 		}
@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
 )
 
 func TestSaveAndLoad(t *testing.T) {
@@ -37,7 +38,7 @@ func TestSaveAndLoad(t *testing.T) {
 		}
 		defer os.Remove("./config.json")
 	} else {
-		t.Fatalf("Failed to serialize ", err)
+		t.Fatalf("Failed to serialize: %v", err)
 	}
 
 	cfg2, err := LoadConfig()
@@ -145,7 +146,7 @@ func TestLoadAllPlugins(t *testing.T) {
 	}
 
 	if len(dsplugin.GetPodSpec().Containers) != 2 {
-		t.Fatalf("JobPlugin should have 1 container, got 2", len(jobplugin.GetPodSpec().Containers))
+		t.Fatalf("JobPlugin should have 1 container, got %v", len(jobplugin.GetPodSpec().Containers))
 	}
 
 	firstContainerName = jobplugin.GetPodSpec().Containers[0].Name
@@ -153,3 +154,123 @@ func TestLoadAllPlugins(t *testing.T) {
 		t.Fatalf("e2e plugin had unexpected container name (%v != %v)", firstContainerName, "e2e")
 	}
 }
+
+func TestLoadAllPlugins_config(t *testing.T) {
+	oldwd, _ := os.Getwd()
+	os.Chdir("../..")
+	defer os.Chdir(oldwd)
+
+	env := func(c v1.Container) map[string]string {
+		ret := make(map[string]string)
+		for _, e := range c.Env {
+			ret[e.Name] = e.Value
+		}
+		return ret
+	}
+
+	// Defaults
+	cfg := &Config{
+		PluginSearchPath: []string{"./plugins.d"},
+		PluginSelections: []plugin.Selection{plugin.Selection{Name: "e2e"}},
+	}
+	if err := loadAllPlugins(cfg); err != nil {
+		t.Fatal(err.Error())
+	}
+	spec := cfg.getPlugins()[0].GetPodSpec()
+	if focus := env(spec.Containers[0])["E2E_FOCUS"]; focus != "Pods should be submitted and removed" {
+		t.Errorf("Expected the default E2E_FOCUS, got %q", focus)
+	}
+	if _, ok := env(spec.Containers[0])["E2E_SKIP"]; ok {
+		t.Error("Expected E2E_SKIP not to be set")
+	}
+	if len(spec.Tolerations) != 2 {
+		t.Errorf("Expected the 2 default tolerations, got %v", spec.Tolerations)
+	}
+
+	// Config from the selection, with keys lowercased like viper does
+	cfg = &Config{
+		PluginSearchPath: []string{"./plugins.d"},
+		PluginSelections: []plugin.Selection{plugin.Selection{Name: "e2e", Config: map[string]interface{}{
+			"e2e_focus":   `\[Conformance\]`,
+			"e2e_skip":    "Serial",
+			"image":       "example.com/conformance:v1",
+			"tolerations": []interface{}{map[string]interface{}{"operator": "Exists"}},
+		}}},
+	}
+	if err := loadAllPlugins(cfg); err != nil {
+		t.Fatal(err.Error())
+	}
+	spec = cfg.getPlugins()[0].GetPodSpec()
+	if focus := env(spec.Containers[0])["E2E_FOCUS"]; focus != `\[Conformance\]` {
+		t.Errorf("Expected E2E_FOCUS to be set from the config, got %q", focus)
+	}
+	if skip := env(spec.Containers[0])["E2E_SKIP"]; skip != "Serial" {
+		t.Errorf("Expected E2E_SKIP to be set from the config, got %q", skip)
+	}
+	if image := spec.Containers[0].Image; image != "example.com/conformance:v1" {
+		t.Errorf("Expected the image to be set from the config, got %q", image)
+	}
+	if len(spec.Tolerations) != 1 || spec.Tolerations[0].Operator != v1.TolerationOpExists {
+		t.Errorf("Expected tolerations to be set from the config, got %v", spec.Tolerations)
+	}
+
+	// Bad config
+	for _, config := range []map[string]interface{}{
+		{"E2E_FOCUS": 3},
+		{"tolerations": "none"},
+		{"E2E_FOKUS": "typo"},
+	} {
+		cfg = &Config{
+			PluginSearchPath: []string{"./plugins.d"},
+			PluginSelections: []plugin.Selection{plugin.Selection{Name: "e2e", Config: config}},
+		}
+		if err := loadAllPlugins(cfg); err == nil {
+			t.Errorf("Expected config %v to fail to load", config)
+		}
+	}
+}
+
+func TestLoadAllPlugins_alias(t *testing.T) {
+	oldwd, _ := os.Getwd()
+	os.Chdir("../..")
+	defer os.Chdir(oldwd)
+
+	cfg := &Config{
+		PluginSearchPath: []string{"./plugins.d"},
+		PluginSelections: []plugin.Selection{
+			plugin.Selection{Name: "e2e", Alias: "conformance", Config: map[string]interface{}{"E2E_FOCUS": "Conformance"}},
+			plugin.Selection{Name: "e2e", Alias: "storage", Config: map[string]interface{}{"E2E_FOCUS": "Storage"}},
+			plugin.Selection{Name: "e2e"},
+		},
+	}
+	if err := loadAllPlugins(cfg); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	plugins := cfg.getPlugins()
+	if len(plugins) != 3 {
+		t.Fatalf("Should have constructed 3 plugins, got %v", len(plugins))
+	}
+	for i, expected := range []string{"conformance", "storage", "e2e"} {
+		if name := plugins[i].GetName(); name != expected {
+			t.Errorf("Expected plugin %v to be named %v, got %v", i, expected, name)
+		}
+		if resultType := plugins[i].GetResultType(); resultType != expected {
+			t.Errorf("Expected plugin %v to have result type %v, got %v", i, expected, resultType)
+		}
+	}
+
+	for _, selections := range [][]plugin.Selection{
+		{{Name: "e2e"}, {Name: "e2e"}},
+		{{Name: "e2e", Alias: "systemd_logs"}, {Name: "systemd_logs"}},
+		{{Name: "e2e", Alias: "Not Valid"}},
+	} {
+		cfg = &Config{
+			PluginSearchPath: []string{"./plugins.d"},
+			PluginSelections: selections,
+		}
+		if err := loadAllPlugins(cfg); err == nil {
+			t.Errorf("Expected selections %+v to fail to load", selections)
+		}
+	}
+}
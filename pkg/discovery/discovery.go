@@ -17,9 +17,12 @@ limitations under the License.
 package discovery
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -29,8 +32,18 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-// Run is the main entrypoint for discovery
-func Run(kubeClient kubernetes.Interface, cfg *config.Config) []error {
+// IncompleteFile is written into the results of a run that was interrupted,
+// saying why, since they only hold what was gathered before then.
+const IncompleteFile = "INCOMPLETE"
+
+// ConfigFile is the file in the results holding the config of the run.
+const ConfigFile = "config.json"
+
+// Run is the main entrypoint for discovery. If ctx is done before the run
+// finishes, the plugins are cleaned up, no more data is gathered, and
+// whatever was gathered so far is still put in the tarball, marked with an
+// IncompleteFile.
+func Run(ctx context.Context, kubeClient kubernetes.Interface, cfg *config.Config) []error {
 	var errlst []error
 
 	t := time.Now()
@@ -46,35 +59,97 @@ func Run(kubeClient kubernetes.Interface, cfg *config.Config) []error {
 
 	// 3. Dump the config.json we used to run our test
 	if blob, err := json.Marshal(cfg); err == nil {
-		if err = ioutil.WriteFile(outpath+"/config.json", blob, 0644); err != nil {
+		if err = ioutil.WriteFile(outpath+"/"+ConfigFile, blob, 0644); err != nil {
 			panic(err.Error())
 		}
 	}
 
-	// closure used to collect and report errors.
+	// closure used to collect and report errors, safe to call concurrently.
+	var errMutex sync.Mutex
 	rollup := func(err []error) {
+		errMutex.Lock()
+		defer errMutex.Unlock()
 		if err != nil {
 			errlst = append(errlst, err...)
 		}
 	}
 
-	// 4. Run the plugin aggregator
-	errlst = append(errlst, pluginaggregation.Run(kubeClient, cfg.LoadedPlugins, cfg.Aggregation, outpath)...)
+	// 4. Run the plugin aggregator, reporting progress on the master pod.
+	// Each plugin is cleaned up as soon as it's done.
+	// Plugin resources belong to the run, so Kubernetes deletes them if the
+	// master pod is deleted before it cleans them up.
+	status := newStatusReporter(kubeClient)
+	status.start(PhaseRunningPlugins, cfg.LoadedPlugins)
+	owner, err := newRunOwner(kubeClient, cfg.PluginNamespace)
+	if err != nil {
+		// The plugins can still be cleaned up as usual
+		glog.Warningf("Plugin resources won't be deleted along with the run: %v", err)
+	}
+	errlst = append(errlst, pluginaggregation.Run(ctx, kubeClient, cfg.PluginNamespace, cfg.LoadedPlugins, cfg.Aggregation, owner.reference(), cfg.UUID, outpath, status.watchAggregator)...)
+	rollup(owner.release(kubeClient))
+	status.setPhase(PhaseCollecting)
+
+	// 5. Run the queries against every selected resource the API server
+	// knows about, working through namespaces in parallel.
+	// Sensitive values are redacted as objects are written, so if the
+	// redaction config is bad we can't collect anything safely.
+	nsResources, clusterResources, err := DiscoverResources(kubeClient, cfg.Resources)
+	redactor, rerr := NewRedactor(cfg.Redaction)
+	if ctx.Err() != nil {
+		glog.Warningf("Skipping resource queries: %v", ctx.Err())
+	} else if err != nil {
+		errlst = append(errlst, err)
+	} else if rerr != nil {
+		errlst = append(errlst, rerr)
+	} else {
+		throttle := NewThrottle(cfg.Limits.Concurrency)
+		rollup(QueryClusterResources(ctx, kubeClient, clusterResources, throttle, redactor, cfg))
+
+		nsCh := make(chan string, len(nslist))
+		for _, ns := range nslist {
+			nsCh <- ns
+		}
+		close(nsCh)
+
+		var wg sync.WaitGroup
+		for i := 0; i < cap(throttle) && i < len(nslist); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ns := range nsCh {
+					if ctx.Err() != nil {
+						continue
+					}
+					rollup(QueryNSResources(ctx, kubeClient, ns, nsResources, throttle, redactor, cfg))
+				}
+			}()
+		}
+		wg.Wait()
 
-	// 5. Run the queries
-	rollup(QueryClusterResources(kubeClient, cfg))
-	for _, ns := range nslist {
-		rollup(QueryNSResources(kubeClient, ns, cfg))
+		if err = redactor.WriteReport(outpath); err != nil {
+			errlst = append(errlst, err)
+		}
 	}
 
-	// 6. Clean up after the plugins
-	errlst = append(errlst, pluginaggregation.Cleanup(kubeClient, cfg.LoadedPlugins)...)
+	// Mark the results of an interrupted run, which are still worth keeping
+	finalPhase := PhaseComplete
+	if ctx.Err() != nil {
+		finalPhase = PhaseIncomplete
+		errlst = append(errlst, fmt.Errorf("run interrupted: %v", ctx.Err()))
+		reason := fmt.Sprintf("Run was interrupted at %v (%v), so these results are incomplete.\n", time.Now().UTC().Format(time.RFC3339), ctx.Err())
+		if err = ioutil.WriteFile(outpath+"/"+IncompleteFile, []byte(reason), 0644); err != nil {
+			errlst = append(errlst, err)
+		}
+	}
 
-	// 7. tarball up results YYYYMMDDHHMM_sonobuoy_UID.tar.gz
+	// 6. tarball up results YYYYMMDDHHMM_sonobuoy_UID.tar.gz
 	tb := cfg.ResultsDir + "/" + t.Format("200601021504") + "_sonobuoy_" + cfg.UUID + ".tar.gz"
 	err = tarx.Compress(tb, outpath, &tarx.CompressOptions{Compression: tarx.Gzip})
 	if err == nil {
+		status.stop(finalPhase, tb)
 		err = os.RemoveAll(outpath)
+	} else {
+		status.stop(PhaseFailed, "")
 	}
 	if err != nil {
 		errlst = append(errlst, err)
@@ -0,0 +1,224 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	pluginaggregation "github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Query is a request to the API server that a run would make, as reported by
+// a dry run.
+type Query struct {
+	// Name is the name the query's results are saved under, eg. "Pods" or
+	// "configz".
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Node      string `json:"node,omitempty"`
+	// Path is the path requested. Pod logs are fetched pod by pod and
+	// container by container, so their path has a "*" in place of each.
+	Path          string `json:"path"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+}
+
+// PodPatch is a patch a run would make to the master pod, as reported by a
+// dry run.
+type PodPatch struct {
+	// When is the point in the run at which the patch is made.
+	When  string          `json:"when"`
+	Type  types.PatchType `json:"type"`
+	Patch json.RawMessage `json:"patch"`
+}
+
+// MasterPlan is what a run would do on behalf of the master pod itself: the
+// tracking ConfigMap it would create if the plugins run in another
+// namespace, and the patches it would make to the pod.
+type MasterPlan struct {
+	Pod       string           `json:"pod"`
+	Resources []runtime.Object `json:"resources,omitempty"`
+	Patches   []PodPatch       `json:"patches"`
+}
+
+// DryRunPlan is what a run would do: the plugins it would run, the queries
+// it would make, and the changes it would make for the master pod. Master
+// is nil if the master isn't running in a pod, since a run then has nothing
+// to own the plugins' resources or report its status on.
+type DryRunPlan struct {
+	Plugins []pluginaggregation.PluginPlan `json:"plugins"`
+	Queries []Query                        `json:"queries"`
+	Master  *MasterPlan                    `json:"master,omitempty"`
+}
+
+// DryRun works out what Run would do with the given config, without creating
+// anything or gathering any data. The plugins' resources and expected
+// results are resolved against the cluster's current nodes.
+func DryRun(kubeClient kubernetes.Interface, cfg *config.Config) (*DryRunPlan, error) {
+	nodes, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list nodes: %v", err)
+	}
+
+	plugins, err := pluginaggregation.Plan(cfg.LoadedPlugins, nodes.Items)
+	if err != nil {
+		return nil, err
+	}
+	queries, err := PlanQueries(kubeClient, cfg, nodes.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	master, err := planMaster(kubeClient, cfg, plugins)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DryRunPlan{Plugins: plugins, Queries: queries, Master: master}, nil
+}
+
+// planMaster works out the tracking ConfigMap and pod patches of a run in
+// the master pod named by PodNameEnv and PodNamespaceEnv, or returns nil if
+// they aren't set. The status patches are those of a run that completes;
+// the tarball's timestamp isn't known ahead of time, so it's a "*".
+func planMaster(kubeClient kubernetes.Interface, cfg *config.Config, plugins []pluginaggregation.PluginPlan) (*MasterPlan, error) {
+	name, namespace := os.Getenv(PodNameEnv), os.Getenv(PodNamespaceEnv)
+	if name == "" || namespace == "" {
+		return nil, nil
+	}
+	pod, err := kubeClient.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get master pod %v/%v: %v", namespace, name, err)
+	}
+
+	plan := &MasterPlan{Pod: namespace + "/" + name}
+	var errs []error
+	addPatch := func(when string, patchType types.PatchType, patch interface{}) {
+		raw, err := json.Marshal(patch)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		plan.Patches = append(plan.Patches, PodPatch{When: when, Type: patchType, Patch: raw})
+	}
+	addStatus := func(when string, status RunStatus) {
+		raw, err := statusPatch(status)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		plan.Patches = append(plan.Patches, PodPatch{When: when, Type: types.MergePatchType, Patch: raw})
+	}
+
+	status := RunStatus{Phase: PhaseRunningPlugins}
+	for _, p := range cfg.LoadedPlugins {
+		status.Sessions = append(status.Sessions, p.GetSessionID())
+	}
+	addStatus("start", status)
+
+	tracked := cfg.PluginNamespace != pod.Namespace
+	if tracked {
+		addPatch("start", types.JSONPatchType, addCleanupFinalizer(pod))
+		plan.Resources = append(plan.Resources, buildTracker(pod, cfg.PluginNamespace))
+	}
+
+	for _, p := range plugins {
+		status.Plugins = append(status.Plugins, PluginSummary{Plugin: p.ResultType, Pending: len(p.ExpectedResults)})
+	}
+	addStatus(fmt.Sprintf("every %v while plugins run", statusUpdateInterval), status)
+
+	if tracked {
+		released := pod.DeepCopy()
+		released.Finalizers = append(released.Finalizers, CleanupFinalizer)
+		addPatch("plugins done", types.JSONPatchType, removeCleanupFinalizer(released))
+	}
+
+	status.Phase = PhaseCollecting
+	addStatus("plugins done", status)
+
+	status.Phase = PhaseComplete
+	status.Tarball = cfg.ResultsDir + "/*_sonobuoy_" + cfg.UUID + ".tar.gz"
+	addStatus("end", status)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("could not serialize master pod patches: %v", errs[0])
+	}
+	return plan, nil
+}
+
+// PlanQueries returns the queries Run would make with the given config, in
+// the order it makes them (although namespaces are queried in parallel.)
+func PlanQueries(kubeClient kubernetes.Interface, cfg *config.Config, nodes []v1.Node) ([]Query, error) {
+	if _, err := NewRedactor(cfg.Redaction); err != nil {
+		return nil, err
+	}
+	nsResources, clusterResources, err := DiscoverResources(kubeClient, cfg.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []Query
+	gatherNodes := false
+	for _, r := range clusterResources {
+		queries = append(queries, Query{Name: r.FileName(), Path: path.Join(r.path("")...)})
+		if r.GroupVersion.Group == "" && r.Name == "nodes" {
+			gatherNodes = true
+		}
+	}
+	if isSelectedName(cfg.Resources, ServerVersionResource) {
+		queries = append(queries, Query{Name: "serverversion", Path: "/version"})
+	}
+	if gatherNodes {
+		for _, node := range nodes {
+			proxypath := "/api/v1/proxy/nodes/" + node.Name
+			queries = append(queries,
+				Query{Name: "configz", Node: node.Name, Path: proxypath + "/configz"},
+				Query{Name: "healthz", Node: node.Name, Path: proxypath + "/healthz"},
+			)
+		}
+	}
+
+	opts := nsListOptions(cfg)
+	for _, ns := range FilterNamespaces(kubeClient, cfg.Filters.Namespaces) {
+		for _, r := range nsResources {
+			queries = append(queries, Query{
+				Name:          r.FileName(),
+				Namespace:     ns,
+				Path:          path.Join(r.path(ns)...),
+				LabelSelector: opts.LabelSelector,
+			})
+		}
+		if isSelectedName(cfg.Resources, PodLogsResource) {
+			queries = append(queries, Query{
+				Name:          "podlogs",
+				Namespace:     ns,
+				Path:          path.Join("/api/v1/namespaces", ns, "pods/*/log?container=*"),
+				LabelSelector: opts.LabelSelector,
+			})
+		}
+	}
+
+	return queries, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	pluginaggregation "github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPlanMaster(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sonobuoy", Namespace: "heptio-sonobuoy", UID: "pod-uid", ResourceVersion: "42"}}
+	plugins := []pluginaggregation.PluginPlan{{
+		Name:            "e2e",
+		ResultType:      "e2e",
+		ExpectedResults: []plugin.ExpectedResult{{ResultType: "e2e"}},
+	}}
+	defer os.Unsetenv(PodNameEnv)
+	defer os.Unsetenv(PodNamespaceEnv)
+
+	os.Unsetenv(PodNameEnv)
+	os.Unsetenv(PodNamespaceEnv)
+	plan, err := planMaster(fake.NewSimpleClientset(pod), &config.Config{PluginNamespace: "heptio-sonobuoy"}, plugins)
+	if err != nil || plan != nil {
+		t.Errorf("expected no plan outside a pod, got %v, %v", plan, err)
+	}
+
+	os.Setenv(PodNameEnv, pod.Name)
+	os.Setenv(PodNamespaceEnv, pod.Namespace)
+	tests := []struct {
+		name            string
+		pluginNamespace string
+		tracked         bool
+		patchTypes      []types.PatchType
+	}{
+		{
+			name:            "plugins in the master's namespace",
+			pluginNamespace: "heptio-sonobuoy",
+			patchTypes:      []types.PatchType{types.MergePatchType, types.MergePatchType, types.MergePatchType, types.MergePatchType},
+		},
+		{
+			name:            "plugins in another namespace",
+			pluginNamespace: "kube-system",
+			tracked:         true,
+			patchTypes: []types.PatchType{
+				types.MergePatchType, types.JSONPatchType, types.MergePatchType,
+				types.JSONPatchType, types.MergePatchType, types.MergePatchType,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		cfg := &config.Config{PluginNamespace: test.pluginNamespace, ResultsDir: "/tmp/sonobuoy", UUID: "run-uuid"}
+		plan, err := planMaster(fake.NewSimpleClientset(pod), cfg, plugins)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if plan.Pod != "heptio-sonobuoy/sonobuoy" {
+			t.Errorf("%v: expected the master pod, got %v", test.name, plan.Pod)
+		}
+
+		if !test.tracked && len(plan.Resources) != 0 {
+			t.Errorf("%v: expected no resources, got %v", test.name, plan.Resources)
+		}
+		if test.tracked {
+			cm, ok := plan.Resources[0].(*v1.ConfigMap)
+			if len(plan.Resources) != 1 || !ok || cm.Name != "sonobuoy-run-pod-uid" || cm.Namespace != "kube-system" {
+				t.Errorf("%v: expected the tracking ConfigMap, got %v", test.name, plan.Resources)
+			}
+		}
+
+		if len(plan.Patches) != len(test.patchTypes) {
+			t.Errorf("%v: expected %d patches, got %d", test.name, len(test.patchTypes), len(plan.Patches))
+			continue
+		}
+		for i, patch := range plan.Patches {
+			if patch.Type != test.patchTypes[i] {
+				t.Errorf("%v: expected patch %d to be a %v, got %v", test.name, i, test.patchTypes[i], patch.Type)
+			}
+		}
+		if test.tracked {
+			var ops []jsonPatchOp
+			if err = json.Unmarshal(plan.Patches[3].Patch, &ops); err != nil || len(ops) != 2 || ops[1].Op != "remove" || ops[1].Path != "/metadata/finalizers/0" {
+				t.Errorf("%v: expected the finalizer to be removed, got %s", test.name, plan.Patches[3].Patch)
+			}
+		}
+
+		var final struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		var status RunStatus
+		if err = json.Unmarshal(plan.Patches[len(plan.Patches)-1].Patch, &final); err == nil {
+			err = json.Unmarshal([]byte(final.Metadata.Annotations[StatusAnnotation]), &status)
+		}
+		if err != nil {
+			t.Errorf("%v: could not read final status: %v", test.name, err)
+			continue
+		}
+		if status.Phase != PhaseComplete || status.Tarball != "/tmp/sonobuoy/*_sonobuoy_run-uuid.tar.gz" {
+			t.Errorf("%v: expected a complete run with a tarball, got %+v", test.name, status)
+		}
+		if len(status.Plugins) != 1 || status.Plugins[0].Pending != 1 {
+			t.Errorf("%v: expected the plugin's results to be pending, got %+v", test.name, status.Plugins)
+		}
+	}
+}
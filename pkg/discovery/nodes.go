@@ -17,6 +17,7 @@ limitations under the License.
 package discovery
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path"
@@ -37,7 +38,7 @@ type nodeData struct {
 // gatherNodeData collects non-resource information about a node through the
 // kubernetes API.  That is, its `healthz` and `configz` endpoints, which are
 // not "resources" per se, although they are accessible through the apiserver.
-func gatherNodeData(kubeClient kubernetes.Interface, cfg *config.Config) error {
+func gatherNodeData(ctx context.Context, kubeClient kubernetes.Interface, cfg *config.Config) error {
 	glog.Info("Collecting Node Configuration and Health...")
 
 	nodelist, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
@@ -46,6 +47,10 @@ func gatherNodeData(kubeClient kubernetes.Interface, cfg *config.Config) error {
 	}
 
 	for _, node := range nodelist.Items {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
 		// We hit the master on /api/v1/proxy/nodes/<node> to gather node
 		// information without having to reinvent auth
 		proxypath := "/api/v1/proxy/nodes/" + node.Name
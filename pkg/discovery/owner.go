@@ -0,0 +1,263 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CleanupFinalizer is put on the master pod while its plugins run in
+	// another namespace, so that the pod isn't deleted until their tracking
+	// ConfigMap is, taking the plugins' resources with it.
+	CleanupFinalizer = "sonobuoy.hept.io/plugin-cleanup"
+
+	// MasterUIDLabel labels a tracking ConfigMap with the UID of the master
+	// pod it stands in for.
+	MasterUIDLabel = "sonobuoy-master-uid"
+
+	// finalizerPatchAttempts is how many times patching the master pod's
+	// finalizers is tried, since the pod may change in between reading it
+	// and patching it.
+	finalizerPatchAttempts = 5
+)
+
+// runOwner is what the resources created by a run's plugins belong to, so
+// that Kubernetes deletes them along with the run.
+//
+// Owner references can't cross namespaces, so if the plugins run in the
+// master's namespace their resources belong to the master pod. Otherwise
+// they belong to a tracking ConfigMap in the plugins' namespace, which is
+// deleted (by release, or failing that `sonobuoy gc` or `sonobuoy delete`)
+// before the CleanupFinalizer lets the master pod go.
+//
+// If the master dies without releasing the pod, the pod is left Terminating
+// once it's deleted, until `sonobuoy gc` or `sonobuoy delete` releases it,
+// which `sonobuoy status` points out.
+type runOwner struct {
+	pod *v1.Pod
+	// tracker is the tracking ConfigMap, if there is one
+	tracker *v1.ConfigMap
+}
+
+// newRunOwner finds the master pod named by PodNameEnv and PodNamespaceEnv,
+// and sets up the owner of the resources of plugins in the given namespace.
+// If the master isn't running in a pod, there is nothing to own them and it
+// returns nil.
+func newRunOwner(kubeClient kubernetes.Interface, pluginNamespace string) (*runOwner, error) {
+	name, namespace := os.Getenv(PodNameEnv), os.Getenv(PodNamespaceEnv)
+	if name == "" || namespace == "" {
+		glog.Infof("%v and %v not set, plugin resources won't have an owner", PodNameEnv, PodNamespaceEnv)
+		return nil, nil
+	}
+
+	pod, err := kubeClient.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get master pod %v/%v: %v", namespace, name, err)
+	}
+	owner := &runOwner{pod: pod}
+	if pluginNamespace == pod.Namespace {
+		return owner, nil
+	}
+
+	// Hold on to the pod before anything depends on the tracker, so the
+	// tracker is never left without a way to be cleaned up.
+	if err = patchFinalizers(kubeClient, pod, addCleanupFinalizer); err != nil {
+		return nil, fmt.Errorf("could not add finalizer to master pod: %v", err)
+	}
+
+	owner.tracker, err = kubeClient.CoreV1().ConfigMaps(pluginNamespace).Create(buildTracker(pod, pluginNamespace))
+	if err != nil {
+		for _, rerr := range ReleaseMaster(kubeClient, pod) {
+			glog.Warning(rerr)
+		}
+		return nil, fmt.Errorf("could not create tracking ConfigMap in namespace %v: %v", pluginNamespace, err)
+	}
+
+	return owner, nil
+}
+
+// buildTracker returns the tracking ConfigMap standing in for the master pod
+// in the given namespace.
+func buildTracker(pod *v1.Pod, namespace string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sonobuoy-run-" + string(pod.UID),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"component":    "sonobuoy",
+				MasterUIDLabel: string(pod.UID),
+			},
+		},
+		Data: map[string]string{
+			"master": pod.Namespace + "/" + pod.Name,
+		},
+	}
+}
+
+// reference returns the owner reference for plugin resources, or nil if
+// there's no owner.
+func (o *runOwner) reference() *metav1.OwnerReference {
+	if o == nil {
+		return nil
+	}
+	if o.tracker != nil {
+		return &metav1.OwnerReference{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Name:       o.tracker.Name,
+			UID:        o.tracker.UID,
+		}
+	}
+	return &metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       o.pod.Name,
+		UID:        o.pod.UID,
+	}
+}
+
+// release deletes the tracking ConfigMap, if there is one, along with
+// anything left that it owns, and lets the master pod be deleted.
+func (o *runOwner) release(kubeClient kubernetes.Interface) []error {
+	if o == nil || o.tracker == nil {
+		return nil
+	}
+	return ReleaseMaster(kubeClient, o.pod)
+}
+
+// ReleaseMaster deletes the tracking ConfigMaps of the given master pod,
+// which deletes the resources of its plugins, and removes its
+// CleanupFinalizer.
+func ReleaseMaster(kubeClient kubernetes.Interface, pod *v1.Pod) []error {
+	var errs []error
+	deletionPolicy := metav1.DeletePropagationBackground
+	deleteOptions := &metav1.DeleteOptions{PropagationPolicy: &deletionPolicy}
+
+	trackers, err := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: MasterUIDLabel + "=" + string(pod.UID),
+	})
+	if err != nil {
+		return append(errs, fmt.Errorf("could not list tracking ConfigMaps of master pod %v/%v: %v", pod.Namespace, pod.Name, err))
+	}
+	for _, cm := range trackers.Items {
+		glog.V(2).Infof("Deleting tracking ConfigMap %v/%v", cm.Namespace, cm.Name)
+		if err = kubeClient.CoreV1().ConfigMaps(cm.Namespace).Delete(cm.Name, deleteOptions); err != nil && !errors.IsNotFound(err) {
+			// Keep the finalizer, so this can be retried
+			return append(errs, fmt.Errorf("could not delete tracking ConfigMap %v/%v: %v", cm.Namespace, cm.Name, err))
+		}
+	}
+
+	if err = patchFinalizers(kubeClient, pod, removeCleanupFinalizer); err != nil && !errors.IsNotFound(err) {
+		errs = append(errs, fmt.Errorf("could not remove finalizer from master pod %v/%v: %v", pod.Namespace, pod.Name, err))
+	}
+
+	return errs
+}
+
+// jsonPatchOp is an operation of a JSON patch (RFC 6902).
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// patchFinalizers changes the finalizers of the master pod with the JSON
+// patch that ops makes from the pod as it currently is. The patch tests what
+// it changes, so that it's never applied to a different list of finalizers
+// than it was made for; if the test fails, the pod is read again and the
+// patch remade, up to finalizerPatchAttempts times. If ops returns nothing,
+// there's nothing to change.
+func patchFinalizers(kubeClient kubernetes.Interface, pod *v1.Pod, ops func(*v1.Pod) []jsonPatchOp) error {
+	pods := kubeClient.CoreV1().Pods(pod.Namespace)
+	var lastErr error
+	for attempt := 0; attempt < finalizerPatchAttempts; attempt++ {
+		current, err := pods.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		patch := ops(current)
+		if len(patch) == 0 {
+			return nil
+		}
+		raw, err := json.Marshal(patch)
+		if err != nil {
+			return err
+		}
+		if _, err = pods.Patch(pod.Name, types.JSONPatchType, raw); err == nil || errors.IsNotFound(err) {
+			return err
+		}
+		glog.V(2).Infof("Could not patch finalizers of pod %v/%v, retrying: %v", pod.Namespace, pod.Name, err)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// addCleanupFinalizer returns the patch adding the CleanupFinalizer to the
+// pod, as long as the pod hasn't changed since it was read.
+func addCleanupFinalizer(pod *v1.Pod) []jsonPatchOp {
+	if HasCleanupFinalizer(pod) {
+		return nil
+	}
+
+	patch := []jsonPatchOp{{Op: "test", Path: "/metadata/resourceVersion", Value: pod.ResourceVersion}}
+	// The list can only be appended to if it's there
+	if len(pod.Finalizers) == 0 {
+		return append(patch, jsonPatchOp{Op: "add", Path: "/metadata/finalizers", Value: []string{CleanupFinalizer}})
+	}
+	return append(patch, jsonPatchOp{Op: "add", Path: "/metadata/finalizers/-", Value: CleanupFinalizer})
+}
+
+// removeCleanupFinalizer returns the patch removing the CleanupFinalizer
+// from the pod, as long as it's still where it was when the pod was read.
+func removeCleanupFinalizer(pod *v1.Pod) []jsonPatchOp {
+	for i, f := range pod.Finalizers {
+		if f == CleanupFinalizer {
+			path := fmt.Sprintf("/metadata/finalizers/%d", i)
+			return []jsonPatchOp{
+				{Op: "test", Path: path, Value: CleanupFinalizer},
+				{Op: "remove", Path: path},
+			}
+		}
+	}
+	return nil
+}
+
+// HasCleanupFinalizer returns whether the pod is a master holding on to the
+// resources of plugins in another namespace.
+func HasCleanupFinalizer(pod *v1.Pod) bool {
+	for _, f := range pod.Finalizers {
+		if f == CleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRunOwnerReference(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sonobuoy", Namespace: "heptio-sonobuoy", UID: "pod-uid"}}
+	tracker := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "sonobuoy-run-pod-uid", Namespace: "kube-system", UID: "cm-uid"}}
+
+	var none *runOwner
+	if ref := none.reference(); ref != nil {
+		t.Errorf("expected no owner reference without an owner, got %v", ref)
+	}
+
+	ref := (&runOwner{pod: pod}).reference()
+	if ref == nil || ref.Kind != "Pod" || ref.Name != pod.Name || ref.UID != pod.UID {
+		t.Errorf("expected a reference to the master pod, got %v", ref)
+	}
+
+	ref = (&runOwner{pod: pod, tracker: tracker}).reference()
+	if ref == nil || ref.Kind != "ConfigMap" || ref.Name != tracker.Name || ref.UID != tracker.UID {
+		t.Errorf("expected a reference to the tracking ConfigMap, got %v", ref)
+	}
+}
+
+func TestHasCleanupFinalizer(t *testing.T) {
+	pod := &v1.Pod{}
+	if HasCleanupFinalizer(pod) {
+		t.Errorf("expected no finalizer")
+	}
+	pod.Finalizers = []string{"other", CleanupFinalizer}
+	if !HasCleanupFinalizer(pod) {
+		t.Errorf("expected the cleanup finalizer to be found")
+	}
+}
+
+func TestCleanupFinalizerPatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		finalizers []string
+		ops        func(*v1.Pod) []jsonPatchOp
+		expected   []jsonPatchOp
+	}{
+		{
+			name:     "add to no finalizers",
+			ops:      addCleanupFinalizer,
+			expected: []jsonPatchOp{{"test", "/metadata/resourceVersion", "42"}, {"add", "/metadata/finalizers", []string{CleanupFinalizer}}},
+		},
+		{
+			name:       "add to other finalizers",
+			finalizers: []string{"other"},
+			ops:        addCleanupFinalizer,
+			expected:   []jsonPatchOp{{"test", "/metadata/resourceVersion", "42"}, {"add", "/metadata/finalizers/-", CleanupFinalizer}},
+		},
+		{
+			name:       "add when already there",
+			finalizers: []string{CleanupFinalizer},
+			ops:        addCleanupFinalizer,
+		},
+		{
+			name:       "remove",
+			finalizers: []string{"other", CleanupFinalizer},
+			ops:        removeCleanupFinalizer,
+			expected:   []jsonPatchOp{{"test", "/metadata/finalizers/1", CleanupFinalizer}, {"remove", "/metadata/finalizers/1", nil}},
+		},
+		{
+			name:       "remove when not there",
+			finalizers: []string{"other"},
+			ops:        removeCleanupFinalizer,
+		},
+	}
+
+	for _, test := range tests {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "42", Finalizers: test.finalizers}}
+		if patch := test.ops(pod); !reflect.DeepEqual(patch, test.expected) {
+			t.Errorf("%v: expected patch %v, got %v", test.name, test.expected, patch)
+		}
+	}
+}
+
+func TestPatchFinalizersRetries(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sonobuoy", Namespace: "heptio-sonobuoy", ResourceVersion: "1"}}
+	kubeClient := fake.NewSimpleClientset(pod)
+
+	// The pod changes under the first patch, so its test fails
+	var patches [][]jsonPatchOp
+	kubeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var patch []jsonPatchOp
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &patch); err != nil {
+			t.Fatalf("Could not parse patch: %v", err)
+		}
+		patches = append(patches, patch)
+		if len(patches) == 1 {
+			return true, nil, errors.New("the server rejected our request: test operation failed")
+		}
+		return true, pod, nil
+	})
+
+	if err := patchFinalizers(kubeClient, pod, addCleanupFinalizer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("Expected the patch to be retried once, got %v", patches)
+	}
+	if patches[1][0].Op != "test" || patches[1][0].Path != "/metadata/resourceVersion" {
+		t.Errorf("Expected the retry to be guarded by the resource version, got %v", patches[1])
+	}
+}
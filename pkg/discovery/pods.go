@@ -17,9 +17,11 @@ limitations under the License.
 package discovery
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 
 	"github.com/golang/glog"
 	"github.com/heptio/sonobuoy/pkg/config"
@@ -34,12 +36,25 @@ const (
 	PodsLocation = "pods"
 )
 
-// gatherPodLogs will loop through collecting pod logs and placing them into a directory tree
-func gatherPodLogs(kubeClient kubernetes.Interface, ns string, opts metav1.ListOptions, cfg *config.Config) []error {
+// gatherPodLogs will collect the logs of every container in the namespace,
+// fetching them concurrently (bounded by throttle) and placing them into a
+// directory tree. Logs that haven't been fetched by the time ctx is done are
+// skipped.
+func gatherPodLogs(ctx context.Context, kubeClient kubernetes.Interface, ns string, opts metav1.ListOptions, throttle Throttle, cfg *config.Config) []error {
 	var errs []error
+	var errsMutex sync.Mutex
+	addErr := func(err error) {
+		errsMutex.Lock()
+		defer errsMutex.Unlock()
+		errs = append(errs, err)
+	}
 
 	// 1 - Collect the list of pods
-	podlist, err := kubeClient.CoreV1().Pods(ns).List(opts)
+	var podlist *v1.PodList
+	var err error
+	throttle.Do(func() {
+		podlist, err = kubeClient.CoreV1().Pods(ns).List(opts)
+	})
 	if err != nil {
 		errs = append(errs, err)
 		return errs
@@ -49,30 +64,46 @@ func gatherPodLogs(kubeClient kubernetes.Interface, ns string, opts metav1.ListO
 
 	// 2 - Foreach pod, dump each of its containers' logs in a tree in the following location:
 	//   pods/:podname/logs/:containername.txt
+	var wg sync.WaitGroup
 	for _, pod := range podlist.Items {
 		for _, container := range pod.Spec.Containers {
-			body, err := kubeClient.CoreV1().Pods(ns).GetLogs(
-				pod.Name,
-				&v1.PodLogOptions{
-					Container: container.Name,
-				},
-			).Do().Raw()
-
-			if err == nil {
-				outdir := path.Join(cfg.OutputDir(), NSResourceLocation, ns, PodsLocation, pod.Name, "logs")
-				if err = os.MkdirAll(outdir, 0755); err != nil {
-					errs = append(errs, err)
-				}
-
-				outfile := path.Join(outdir, container.Name) + ".txt"
-				if err = ioutil.WriteFile(outfile, body, 0644); err != nil {
-					errs = append(errs, err)
-				}
-			} else {
-				errs = append(errs, err)
-			}
+			wg.Add(1)
+			go func(podName, containerName string) {
+				defer wg.Done()
+				throttle.Do(func() {
+					if ctx.Err() != nil {
+						return
+					}
+					if err := gatherContainerLog(kubeClient, ns, podName, containerName, cfg); err != nil {
+						addErr(err)
+					}
+				})
+			}(pod.Name, container.Name)
 		}
 	}
+	wg.Wait()
 
 	return errs
 }
+
+// gatherContainerLog fetches the log of a single container and writes it to
+// pods/:podname/logs/:containername.txt
+func gatherContainerLog(kubeClient kubernetes.Interface, ns, podName, containerName string, cfg *config.Config) error {
+	body, err := kubeClient.CoreV1().Pods(ns).GetLogs(
+		podName,
+		&v1.PodLogOptions{
+			Container: containerName,
+		},
+	).Do().Raw()
+	if err != nil {
+		return err
+	}
+
+	outdir := path.Join(cfg.OutputDir(), NSResourceLocation, ns, PodsLocation, podName, "logs")
+	if err = os.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+
+	outfile := path.Join(outdir, containerName) + ".txt"
+	return ioutil.WriteFile(outfile, body, 0644)
+}
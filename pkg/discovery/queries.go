@@ -17,23 +17,24 @@ limitations under the License.
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/heptio/sonobuoy/pkg/config"
-	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 )
 
-// ObjQuery is a query function that returns a kubernetes object
-type ObjQuery func() (runtime.Object, error)
+// PagedQuery is a query function that returns the page of a list of
+// kubernetes objects starting at the given continue token
+type PagedQuery func(continueToken string) (*unstructured.UnstructuredList, error)
 
 // UntypedQuery is a query function that return an untyped array of objs
 type UntypedQuery func() (interface{}, error)
@@ -48,6 +49,8 @@ const (
 	NonNSResourceLocation = "resources/non-ns"
 	// HostsLocation is the place under which host information (configz, healthz) is stored
 	HostsLocation = "hosts"
+	// ServerVersionLocation is the place under which the API server's version is stored
+	ServerVersionLocation = "serverversion"
 )
 
 // queryData captures the results of the run for post-processing
@@ -57,25 +60,51 @@ type queryData struct {
 	Error       error  `json:"error,omitempty"`
 }
 
-// objListQuery performs a list query and serialize the results
-func objListQuery(outpath string, file string, f ObjQuery) (time.Duration, error) {
-	start := time.Now()
-	listObj, err := f()
-	duration := time.Since(start)
-	if err != nil {
-		return duration, err
-	}
-	if listObj == nil {
-		return duration, fmt.Errorf("got invalid response from API server")
-	}
-	if listPtr, err := meta.GetItemsPtr(listObj); err == nil {
-		if items, err := conversion.EnforcePtr(listPtr); err == nil {
-			if items.Len() > 0 {
-				err = SerializeObj(listPtr, outpath, file)
+// pagedListQuery performs a list query one page at a time, streaming each
+// page's items out as a single JSON array so that large lists are never held
+// in memory all at once. Each item is passed through transform (if not nil)
+// before being written. Nothing is written if the list is empty.  The
+// returned duration is the time spent querying, not writing.
+func pagedListQuery(outpath string, file string, f PagedQuery, transform func(obj map[string]interface{})) (duration time.Duration, err error) {
+	var out *arrayWriter
+	defer func() {
+		if out != nil {
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}()
+
+	continueToken := ""
+	for {
+		start := time.Now()
+		list, err := f(continueToken)
+		duration += time.Since(start)
+		if err != nil {
+			return duration, err
+		}
+		if list == nil {
+			return duration, fmt.Errorf("got invalid response from API server")
+		}
+
+		for i := range list.Items {
+			if out == nil {
+				if out, err = newArrayWriter(outpath, file); err != nil {
+					return duration, err
+				}
+			}
+			if transform != nil {
+				transform(list.Items[i].Object)
+			}
+			if err = out.Write(list.Items[i].Object); err != nil {
+				return duration, err
 			}
 		}
+
+		if continueToken = listContinue(list); continueToken == "" {
+			return duration, nil
+		}
 	}
-	return duration, err
 }
 
 // untypedQuery performs a untyped query and serialize the results
@@ -113,104 +142,54 @@ func recordResults(f *os.File, name string, duration time.Duration, recerr error
 	return nil
 }
 
-// timedQuery Wraps the execution of the function with a recorded timed snapshot
-func timedQuery(f *os.File, name string, errs []error, fn func() (time.Duration, error)) {
-	duration, err := fn()
-	if err != nil {
-		glog.Warningf("Failed query on resource: %v, error:%v", name, err)
-		errs = append(errs, err)
-	}
-	if err = recordResults(f, name, duration, err); err != nil {
-		errs = append(errs, err)
-	}
+// timedQuery is a query to run, along with the name its execution time and
+// outcome are recorded under in the results summary.
+type timedQuery struct {
+	name string
+	fn   func() (time.Duration, error)
 }
 
-// queryNsResource performs the appropriate namespace-scoped query according to its input args
-func queryNsResource(ns string, resourceKind string, opts metav1.ListOptions, kubeClient kubernetes.Interface) (runtime.Object, error) {
-	switch resourceKind {
-	case "ConfigMaps":
-		return kubeClient.CoreV1().ConfigMaps(ns).List(opts)
-	case "CronJobs":
-		return kubeClient.BatchV2alpha1().CronJobs(ns).List(opts)
-	case "DaemonSets":
-		return kubeClient.Extensions().DaemonSets(ns).List(opts)
-	case "Deployments":
-		return kubeClient.Apps().Deployments(ns).List(opts)
-	case "Endpoints":
-		return kubeClient.CoreV1().Endpoints(ns).List(opts)
-	case "Events":
-		return kubeClient.CoreV1().Events(ns).List(opts)
-	case "HorizontalPodAutoscalers":
-		return kubeClient.Autoscaling().HorizontalPodAutoscalers(ns).List(opts)
-	case "Ingresses":
-		return kubeClient.Extensions().Ingresses(ns).List(opts)
-	case "Jobs":
-		return kubeClient.Batch().Jobs(ns).List(opts)
-	case "LimitRanges":
-		return kubeClient.CoreV1().LimitRanges(ns).List(opts)
-	case "PersistentVolumeClaims":
-		return kubeClient.CoreV1().PersistentVolumeClaims(ns).List(opts)
-	case "Pods":
-		return kubeClient.CoreV1().Pods(ns).List(opts)
-	case "PodDisruptionBudgets":
-		return kubeClient.Policy().PodDisruptionBudgets(ns).List(opts)
-	case "PodPresets":
-		return kubeClient.Settings().PodPresets(ns).List(opts)
-	case "PodTemplates":
-		return kubeClient.CoreV1().PodTemplates(ns).List(opts)
-	case "ReplicaSets":
-		return kubeClient.Extensions().ReplicaSets(ns).List(opts)
-	case "ReplicationControllers":
-		return kubeClient.CoreV1().ReplicationControllers(ns).List(opts)
-	case "ResourceQuotas":
-		return kubeClient.CoreV1().ResourceQuotas(ns).List(opts)
-	case "RoleBindings":
-		return kubeClient.Rbac().RoleBindings(ns).List(opts)
-	case "Roles":
-		return kubeClient.Rbac().Roles(ns).List(opts)
-	case "Secrets":
-		return kubeClient.CoreV1().Secrets(ns).List(opts)
-	case "ServiceAccounts":
-		return kubeClient.CoreV1().ServiceAccounts(ns).List(opts)
-	case "Services":
-		return kubeClient.CoreV1().Services(ns).List(opts)
-	case "StatefulSets":
-		return kubeClient.Apps().StatefulSets(ns).List(opts)
-	default:
-		return nil, fmt.Errorf("don't know how to handle namespaced resource %v", resourceKind)
+// runQueries executes the given queries concurrently, bounded by throttle,
+// then records each one's outcome to f in the order the queries were given,
+// so that the summary doesn't depend on which query finished first. Queries
+// that haven't started by the time ctx is done are skipped, and recorded as
+// failing with ctx's error.
+func runQueries(ctx context.Context, f *os.File, throttle Throttle, queries []timedQuery) []error {
+	var errs []error
+	durations := make([]time.Duration, len(queries))
+	qerrs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			throttle.Do(func() {
+				if qerrs[i] = ctx.Err(); qerrs[i] == nil {
+					durations[i], qerrs[i] = queries[i].fn()
+				}
+			})
+		}(i)
 	}
-}
+	wg.Wait()
 
-// queryNonNsResource performs the appropriate non-namespace-scoped query according to its input args
-func queryNonNsResource(resourceKind string, kubeClient kubernetes.Interface) (runtime.Object, error) {
-	switch resourceKind {
-	case "CertificateSigningRequests":
-		return kubeClient.Certificates().CertificateSigningRequests().List(metav1.ListOptions{})
-	case "ClusterRoleBindings":
-		return kubeClient.Rbac().ClusterRoleBindings().List(metav1.ListOptions{})
-	case "ClusterRoles":
-		return kubeClient.Rbac().ClusterRoles().List(metav1.ListOptions{})
-	case "ComponentStatuses":
-		return kubeClient.CoreV1().ComponentStatuses().List(metav1.ListOptions{})
-	case "Nodes":
-		return kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
-	case "PersistentVolumes":
-		return kubeClient.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
-	case "PodSecurityPolicies":
-		return kubeClient.Extensions().PodSecurityPolicies().List(metav1.ListOptions{})
-	case "StorageClasses":
-		return kubeClient.Storage().StorageClasses().List(metav1.ListOptions{})
-	case "ThirdPartyResources":
-		return kubeClient.Extensions().ThirdPartyResources().List(metav1.ListOptions{})
-	default:
-		return nil, fmt.Errorf("don't know how to handle non-namespaced resource %v", resourceKind)
+	for i, query := range queries {
+		if qerrs[i] != nil && qerrs[i] != ctx.Err() {
+			glog.Warningf("Failed query on resource: %v, error:%v", query.name, qerrs[i])
+			errs = append(errs, qerrs[i])
+		}
+		if err := recordResults(f, query.name, durations[i], qerrs[i]); err != nil {
+			errs = append(errs, err)
+		}
 	}
+
+	return errs
 }
 
-// QueryNSResources will query namespace-specific resources in the cluster,
-// writing them out to <resultsdir>/resources/ns/<ns>/*.json
+// QueryNSResources will query the given namespace-scoped resources in the
+// cluster, writing them out to <resultsdir>/resources/ns/<ns>/*.json
 // TODO: Eliminate dependencies from config.Config and pass in data
-func QueryNSResources(kubeClient kubernetes.Interface, ns string, cfg *config.Config) []error {
+func QueryNSResources(ctx context.Context, kubeClient kubernetes.Interface, ns string, resources []APIResource, throttle Throttle, redactor *Redactor, cfg *config.Config) []error {
 	var errs []error
 	glog.Infof("Running ns query (%v)", ns)
 
@@ -239,59 +218,79 @@ func QueryNSResources(kubeClient kubernetes.Interface, ns string, cfg *config.Co
 	}
 
 	// 3. Setup label filter if there is one.
-	opts := metav1.ListOptions{}
-	if len(cfg.Filters.LabelSelector) > 0 {
-		if _, err := labels.Parse(cfg.Filters.LabelSelector); err != nil {
-			glog.Warningf("Labelselector %v failed to parse with error %v", cfg.Filters.LabelSelector, err)
-		} else {
-			opts.LabelSelector = cfg.Filters.LabelSelector
+	opts := nsListOptions(cfg)
+
+	// 4. Gather pod logs alongside the ns-query. Log fetches take their own
+	// slots from the throttle, so this doesn't hold one while it waits.
+	var podLogErrs []error
+	var podLogDuration time.Duration
+	podLogsDone := make(chan struct{})
+	go func() {
+		defer close(podLogsDone)
+		if isSelectedName(cfg.Resources, PodLogsResource) {
+			start := time.Now()
+			podLogErrs = gatherPodLogs(ctx, kubeClient, ns, opts, throttle, cfg)
+			podLogDuration = time.Since(start)
 		}
-	}
-
-	resources := cfg.FilterResources(config.NamespacedResources)
+	}()
 
-	// 4. Execute the ns-query
-	for resourceKind := range resources {
-		// We use annotations to tag resources as being namespaced vs not, skip any
-		// that aren't "ns"
-		if resourceKind != "PodLogs" {
-			lister := func() (runtime.Object, error) { return queryNsResource(ns, resourceKind, opts, kubeClient) }
-			query := func() (time.Duration, error) { return objListQuery(outdir+"/", resourceKind+".json", lister) }
-			timedQuery(f, resourceKind, errs, query)
+	// 5. Execute the ns-query
+	queries := make([]timedQuery, 0, len(resources))
+	for i := range resources {
+		r := &resources[i]
+		redact := func(obj map[string]interface{}) { redactor.Redact(r, obj) }
+		lister := func(continueToken string) (*unstructured.UnstructuredList, error) {
+			return queryResource(kubeClient, r, ns, opts, cfg.Limits.PageSize, continueToken)
 		}
+		queries = append(queries, timedQuery{
+			name: r.FileName(),
+			fn: func() (time.Duration, error) {
+				return pagedListQuery(outdir+"/", r.FileName()+".json", lister, redact)
+			},
+		})
 	}
+	errs = append(errs, runQueries(ctx, f, throttle, queries)...)
 
-	if resources["PodLogs"] {
+	<-podLogsDone
+	if isSelectedName(cfg.Resources, PodLogsResource) {
 		// NOTE: pod log collection is an aggregated time b/c propagating that detail back up
 		// is odd and would pollute some of the output.
-		start := time.Now()
-		if errlst := gatherPodLogs(kubeClient, ns, opts, cfg); errlst != nil {
-			err = errlst[0]
-			errs = append(errs, errlst...)
+		if podLogErrs != nil {
+			err = podLogErrs[0]
+			errs = append(errs, podLogErrs...)
 		}
-		duration := time.Since(start)
-		recordResults(f, "podlogs", duration, err)
+		recordResults(f, "podlogs", podLogDuration, err)
 	}
 
 	return errs
 }
 
-// QueryClusterResources queries non-namespace resources in the cluster, writing
-// them out to <resultsdir>/resources/non-ns/*.json
+// nsListOptions returns the options namespaced resources are listed with,
+// applying the label filter if there is a valid one.
+func nsListOptions(cfg *config.Config) metav1.ListOptions {
+	opts := metav1.ListOptions{}
+	if len(cfg.Filters.LabelSelector) > 0 {
+		if _, err := labels.Parse(cfg.Filters.LabelSelector); err != nil {
+			glog.Warningf("Labelselector %v failed to parse with error %v", cfg.Filters.LabelSelector, err)
+		} else {
+			opts.LabelSelector = cfg.Filters.LabelSelector
+		}
+	}
+	return opts
+}
+
+// QueryClusterResources queries the given non-namespace resources in the
+// cluster, writing them out to <resultsdir>/resources/non-ns/*.json
 // TODO: Eliminate dependencies from config.Config and pass in data
-func QueryClusterResources(kubeClient kubernetes.Interface, cfg *config.Config) []error {
+func QueryClusterResources(ctx context.Context, kubeClient kubernetes.Interface, resources []APIResource, throttle Throttle, redactor *Redactor, cfg *config.Config) []error {
 	var errs []error
 	glog.Infof("Running non-ns query")
 
-	resources := cfg.FilterResources(config.ClusterResources)
-
 	// 1. Create the parent directory we will use to store the results
 	outdir := path.Join(cfg.OutputDir(), NonNSResourceLocation)
-	if len(resources) > 0 {
-		if err := os.MkdirAll(outdir, 0755); err != nil {
-			errs = append(errs, err)
-			return errs
-		}
+	if err := os.MkdirAll(outdir, 0755); err != nil {
+		errs = append(errs, err)
+		return errs
 	}
 
 	// 2. Create the results output file.
@@ -312,35 +311,48 @@ func QueryClusterResources(kubeClient kubernetes.Interface, cfg *config.Config)
 	}
 
 	// 3. Execute the non-ns-query
-	for resourceKind := range resources {
-		// Eliminate special cases.
-		if resourceKind != "ServerVersion" {
-			lister := func() (runtime.Object, error) { return queryNonNsResource(resourceKind, kubeClient) }
-			query := func() (time.Duration, error) { return objListQuery(outdir+"/", resourceKind+".json", lister) }
-			timedQuery(f, resourceKind, errs, query)
+	gatherNodes := false
+	queries := make([]timedQuery, 0, len(resources)+1)
+	for i := range resources {
+		r := &resources[i]
+		redact := func(obj map[string]interface{}) { redactor.Redact(r, obj) }
+		lister := func(continueToken string) (*unstructured.UnstructuredList, error) {
+			return queryResource(kubeClient, r, "", metav1.ListOptions{}, cfg.Limits.PageSize, continueToken)
 		}
+		queries = append(queries, timedQuery{
+			name: r.FileName(),
+			fn: func() (time.Duration, error) {
+				return pagedListQuery(outdir+"/", r.FileName()+".json", lister, redact)
+			},
+		})
+
+		if r.GroupVersion.Group == "" && r.Name == "nodes" {
+			gatherNodes = true
+		}
+	}
+
+	if isSelectedName(cfg.Resources, ServerVersionResource) {
+		objqry := func() (interface{}, error) { return kubeClient.Discovery().ServerVersion() }
+		queries = append(queries, timedQuery{
+			name: "serverversion",
+			fn: func() (time.Duration, error) {
+				return untypedQuery(path.Join(cfg.OutputDir(), ServerVersionLocation), "serverversion.json", objqry)
+			},
+		})
 	}
+	errs = append(errs, runQueries(ctx, f, throttle, queries)...)
 
-	// cfg.Nodes configures whether users want to gather the Nodes resource in the
-	// cluster, but we also use that option to guide whether we get node data such
-	// as configz and healthz endpoints.
-	if resources["Nodes"] {
+	// Whether users want to gather the Nodes resource in the cluster also
+	// guides whether we get node data such as configz and healthz endpoints.
+	if gatherNodes {
 		// NOTE: Node data collection is an aggregated time b/c propagating that detail back up
 		// is odd and would pollute some of the output.
 		start := time.Now()
-		if err = gatherNodeData(kubeClient, cfg); err != nil {
+		if err = gatherNodeData(ctx, kubeClient, cfg); err != nil {
 			errs = append(errs, err)
 		}
 		duration := time.Since(start)
-		recordResults(f, "podlogs", duration, err)
-	}
-
-	if resources["ServerVersion"] {
-		objqry := func() (interface{}, error) { return kubeClient.Discovery().ServerVersion() }
-		query := func() (time.Duration, error) {
-			return untypedQuery(cfg.OutputDir()+"/serverversion", "serverversion.json", objqry)
-		}
-		timedQuery(f, "serverversion", errs, query)
+		recordResults(f, "nodedata", duration, err)
 	}
 
 	return errs
@@ -0,0 +1,191 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRunQueriesOrder(t *testing.T) {
+	f, err := ioutil.TempFile("", "sonobuoy_discovery_test")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// Make later queries finish first, so completion order is the reverse of
+	// the order the queries were given in.
+	var queries []timedQuery
+	for i := 0; i < 5; i++ {
+		delay := time.Duration(5-i) * 10 * time.Millisecond
+		queries = append(queries, timedQuery{
+			name: fmt.Sprintf("query%d", i),
+			fn: func() (time.Duration, error) {
+				time.Sleep(delay)
+				return delay, nil
+			},
+		})
+	}
+
+	f.WriteString("[")
+	if errs := runQueries(context.Background(), f, NewThrottle(5), queries); len(errs) != 0 {
+		t.Fatalf("Unexpected errors running queries: %v", errs)
+	}
+	f.WriteString("{}]")
+
+	blob, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("Could not read results: %v", err)
+	}
+
+	var results []queryData
+	if err = json.Unmarshal(blob, &results); err != nil {
+		t.Fatalf("Could not parse results %v: %v", string(blob), err)
+	}
+
+	if len(results) != len(queries)+1 {
+		t.Fatalf("Expected %v results, got %v", len(queries)+1, len(results))
+	}
+	for i, query := range queries {
+		if results[i].QueryObj != query.name {
+			t.Errorf("Expected result %v to be %v, got %v", i, query.name, results[i].QueryObj)
+		}
+	}
+}
+
+func TestRunQueriesCancelled(t *testing.T) {
+	f, err := ioutil.TempFile("", "sonobuoy_discovery_test")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// The first query cancels the rest, which only run one at a time
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ran := 0
+	var queries []timedQuery
+	for i := 0; i < 3; i++ {
+		queries = append(queries, timedQuery{
+			name: fmt.Sprintf("query%d", i),
+			fn: func() (time.Duration, error) {
+				ran++
+				cancel()
+				return 0, nil
+			},
+		})
+	}
+
+	f.WriteString("[")
+	if errs := runQueries(ctx, f, NewThrottle(1), queries); len(errs) != 0 {
+		t.Fatalf("Unexpected errors running queries: %v", errs)
+	}
+	f.WriteString("{}]")
+
+	if ran != 1 {
+		t.Errorf("Expected 1 query to run, %v did", ran)
+	}
+
+	blob, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("Could not read results: %v", err)
+	}
+	// Errors don't unmarshal into queryData, so just look for them
+	var results []map[string]interface{}
+	if err = json.Unmarshal(blob, &results); err != nil {
+		t.Fatalf("Could not parse results %v: %v", string(blob), err)
+	}
+	failed := 0
+	for _, result := range results[:len(queries)] {
+		if _, ok := result["error"]; ok {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("Expected 2 skipped queries to be recorded as failed, got %v", failed)
+	}
+}
+
+func TestPagedListQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_discovery_test")
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Three pages of two objects each, linked by continue tokens
+	pages := map[string]*unstructured.UnstructuredList{}
+	tokens := []string{"", "page2", "page3"}
+	for i, token := range tokens {
+		list := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+		if i+1 < len(tokens) {
+			list.Object["metadata"] = map[string]interface{}{"continue": tokens[i+1]}
+		}
+		for j := 0; j < 2; j++ {
+			list.Items = append(list.Items, unstructured.Unstructured{
+				Object: map[string]interface{}{"name": fmt.Sprintf("obj%d", i*2+j)},
+			})
+		}
+		pages[token] = list
+	}
+
+	_, err = pagedListQuery(dir, "Objs.json", func(continueToken string) (*unstructured.UnstructuredList, error) {
+		return pages[continueToken], nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	blob, err := ioutil.ReadFile(path.Join(dir, "Objs.json"))
+	if err != nil {
+		t.Fatalf("Could not read results: %v", err)
+	}
+	var objs []map[string]string
+	if err = json.Unmarshal(blob, &objs); err != nil {
+		t.Fatalf("Results are not a valid JSON array (%v): %v", string(blob), err)
+	}
+	if len(objs) != 6 {
+		t.Fatalf("Expected 6 objects, got %v", len(objs))
+	}
+	for i, obj := range objs {
+		if expected := fmt.Sprintf("obj%d", i); obj["name"] != expected {
+			t.Errorf("Expected object %v to be %v, got %v", i, expected, obj["name"])
+		}
+	}
+
+	// Empty lists shouldn't produce a file at all
+	_, err = pagedListQuery(dir, "Empty.json", func(continueToken string) (*unstructured.UnstructuredList, error) {
+		return &unstructured.UnstructuredList{Object: map[string]interface{}{}}, nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = os.Stat(path.Join(dir, "Empty.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file for an empty list, got %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// RedactionReportLocation is the location within the results tarball of
+	// the report listing every value that was redacted.
+	RedactionReportLocation = "redaction.json"
+
+	// Names of the built-in redaction rules, as recorded in the report
+	secretDataRule = "secret-data"
+	envRule        = "env"
+	annotationRule = "annotation"
+)
+
+// RedactionRecord describes a single value that was redacted from a
+// collected object.
+type RedactionRecord struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Rule      string `json:"rule"`
+}
+
+// Redactor scrubs sensitive values out of collected objects, replacing each
+// with a keyed hash so that equal values can still be recognized within a
+// run, and keeps a record of everything it has redacted. A nil Redactor
+// redacts nothing.
+type Redactor struct {
+	key         []byte
+	envPatterns []*regexp.Regexp
+	annotations map[string]bool
+	rules       []redactionRule
+
+	recordsMutex sync.Mutex
+	records      []RedactionRecord
+}
+
+// redactionRule is a parsed config.RedactionRule
+type redactionRule struct {
+	resources []string
+	path      string
+	tokens    []string
+}
+
+// NewRedactor builds a Redactor from the given options, returning nil if
+// redaction is disabled. Invalid patterns or paths are returned as errors.
+func NewRedactor(opts config.RedactionOptions) (*Redactor, error) {
+	if !opts.Enabled {
+		return nil, nil
+	}
+
+	// The hash key is random and never written out, so hashes can't be
+	// reversed by guessing at likely values.
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	r := &Redactor{
+		key:         key,
+		annotations: make(map[string]bool, len(opts.Annotations)),
+	}
+
+	for _, pattern := range opts.EnvPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction env pattern %q: %v", pattern, err)
+		}
+		r.envPatterns = append(r.envPatterns, re)
+	}
+
+	for _, annotation := range opts.Annotations {
+		r.annotations[annotation] = true
+	}
+
+	for _, rule := range opts.Rules {
+		tokens, err := parseRedactionPath(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule path %q: %v", rule.Path, err)
+		}
+		r.rules = append(r.rules, redactionRule{
+			resources: rule.Resources,
+			path:      rule.Path,
+			tokens:    tokens,
+		})
+	}
+
+	return r, nil
+}
+
+// Redact scrubs the given object, of the given resource, in place.
+func (r *Redactor) Redact(res *APIResource, obj map[string]interface{}) {
+	if r == nil {
+		return
+	}
+
+	var namespace, name string
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		namespace, _ = metadata["namespace"].(string)
+		name, _ = metadata["name"].(string)
+	}
+	record := func(path, rule string) {
+		r.recordsMutex.Lock()
+		defer r.recordsMutex.Unlock()
+		r.records = append(r.records, RedactionRecord{
+			Resource:  res.FileName(),
+			Namespace: namespace,
+			Name:      name,
+			Path:      strings.TrimPrefix(path, "."),
+			Rule:      rule,
+		})
+	}
+
+	if res.GroupVersion.Group == "" && res.Name == "secrets" {
+		for _, field := range []string{"data", "stringData"} {
+			if values, ok := obj[field].(map[string]interface{}); ok {
+				for key, value := range values {
+					values[key] = r.hash(value)
+					record(field+"["+strconv.Quote(key)+"]", secretDataRule)
+				}
+			}
+		}
+		// kubectl apply keeps a copy of the data in this annotation, so it
+		// goes too, whatever the configured annotations are. If it's one
+		// of them, walk redacts it instead.
+		if !r.annotations[v1.LastAppliedConfigAnnotation] {
+			if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+				if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+					if value, ok := annotations[v1.LastAppliedConfigAnnotation]; ok {
+						annotations[v1.LastAppliedConfigAnnotation] = r.hash(value)
+						record("metadata.annotations["+strconv.Quote(v1.LastAppliedConfigAnnotation)+"]", secretDataRule)
+					}
+				}
+			}
+		}
+	}
+
+	r.walk(obj, "", record)
+
+	for _, rule := range r.rules {
+		if len(rule.resources) > 0 && !isSelected(rule.resources, res) {
+			continue
+		}
+		visitPath(obj, rule.tokens, "", func(path string, value interface{}) interface{} {
+			record(path, rule.path)
+			return r.hash(value)
+		})
+	}
+}
+
+// walk recursively looks for container environment variables and
+// annotations to redact, wherever they appear in the object, so that pod
+// templates nested in workloads and custom resources are covered too.
+func (r *Redactor) walk(node interface{}, path string, record func(path, rule string)) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if env, ok := n["env"].([]interface{}); ok {
+			r.redactEnv(env, path+".env", record)
+		}
+		if metadata, ok := n["metadata"].(map[string]interface{}); ok {
+			if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+				for key, value := range annotations {
+					if r.annotations[key] {
+						annotations[key] = r.hash(value)
+						record(path+".metadata.annotations["+strconv.Quote(key)+"]", annotationRule)
+					}
+				}
+			}
+		}
+		for key, child := range n {
+			r.walk(child, path+"."+key, record)
+		}
+	case []interface{}:
+		for i, child := range n {
+			r.walk(child, path+"["+strconv.Itoa(i)+"]", record)
+		}
+	}
+}
+
+func (r *Redactor) redactEnv(env []interface{}, path string, record func(path, rule string)) {
+	for i, item := range env {
+		envVar, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := envVar["name"].(string)
+		value, ok := envVar["value"].(string)
+		if !ok {
+			continue
+		}
+		for _, re := range r.envPatterns {
+			if re.MatchString(name + "=" + value) {
+				envVar["value"] = r.hash(value)
+				record(path+"["+strconv.Itoa(i)+"].value", envRule)
+				break
+			}
+		}
+	}
+}
+
+// hash returns the replacement for a redacted value.
+func (r *Redactor) hash(value interface{}) string {
+	var blob []byte
+	if s, ok := value.(string); ok {
+		blob = []byte(s)
+	} else {
+		blob, _ = json.Marshal(value)
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(blob)
+	return "redacted:hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Records returns everything redacted so far, sorted so that the report is
+// stable regardless of the order objects were collected in.
+func (r *Redactor) Records() []RedactionRecord {
+	if r == nil {
+		return nil
+	}
+	r.recordsMutex.Lock()
+	defer r.recordsMutex.Unlock()
+
+	records := make([]RedactionRecord, len(r.records))
+	copy(records, r.records)
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Path < b.Path
+	})
+	return records
+}
+
+// WriteReport writes the list of redacted values to outpath.
+func (r *Redactor) WriteReport(outpath string) error {
+	if r == nil {
+		return nil
+	}
+	return SerializeObj(r.Records(), outpath, RedactionReportLocation)
+}
+
+// parseRedactionPath splits a JSONPath-style expression into the field names,
+// indexes and wildcards ("*") it is made of.  Both dotted fields and bracketed
+// quoted keys are supported, so annotations can be addressed as
+// metadata.annotations["example.com/key"].  A leading "$" is ignored.
+func parseRedactionPath(path string) ([]string, error) {
+	var tokens []string
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+		case '[':
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [")
+			}
+			inner := p[1:end]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') {
+				// Quoted keys may themselves contain "]", so find the closing quote.
+				closing := strings.IndexByte(p[2:], inner[0])
+				if closing < 0 || 2+closing+1 >= len(p) || p[2+closing+1] != ']' {
+					return nil, fmt.Errorf("unterminated quoted key")
+				}
+				tokens = append(tokens, p[2:2+closing])
+				p = p[2+closing+2:]
+				continue
+			}
+			if inner != "*" {
+				if _, err := strconv.Atoi(inner); err != nil {
+					return nil, fmt.Errorf("index %q is not a number or *", inner)
+				}
+			}
+			tokens = append(tokens, "["+inner+"]")
+			p = p[end+1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			tokens = append(tokens, p[:end])
+			p = p[end:]
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return tokens, nil
+}
+
+// visitPath finds every value in node matched by tokens, replacing each with
+// the result of fn.
+func visitPath(node interface{}, tokens []string, path string, fn func(path string, value interface{}) interface{}) {
+	if len(tokens) == 0 {
+		return
+	}
+	token, rest := tokens[0], tokens[1:]
+
+	visit := func(child interface{}, childPath string, set func(interface{})) {
+		if len(rest) == 0 {
+			set(fn(childPath, child))
+			return
+		}
+		visitPath(child, rest, childPath, fn)
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if token == "*" || token == "[*]" {
+			for key, child := range n {
+				key := key
+				visit(child, path+"["+strconv.Quote(key)+"]", func(v interface{}) { n[key] = v })
+			}
+		} else if child, ok := n[token]; ok {
+			visit(child, path+"."+token, func(v interface{}) { n[token] = v })
+		}
+	case []interface{}:
+		if token == "*" || token == "[*]" {
+			for i, child := range n {
+				i := i
+				visit(child, path+"["+strconv.Itoa(i)+"]", func(v interface{}) { n[i] = v })
+			}
+		} else if strings.HasPrefix(token, "[") {
+			if i, err := strconv.Atoi(token[1 : len(token)-1]); err == nil && i >= 0 && i < len(n) {
+				visit(n[i], path+token, func(v interface{}) { n[i] = v })
+			}
+		}
+	}
+}
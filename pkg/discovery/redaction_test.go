@@ -0,0 +1,225 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func parseObj(t *testing.T, blob string) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(blob), &obj); err != nil {
+		t.Fatalf("Could not parse test object: %v", err)
+	}
+	return obj
+}
+
+func isRedacted(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, "redacted:")
+}
+
+func TestRedactDefaults(t *testing.T) {
+	redactor, err := NewRedactor(config.NewWithDefaults().Redaction)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	secrets := &APIResource{
+		GroupVersion: schema.GroupVersion{Version: "v1"},
+		APIResource:  metav1.APIResource{Name: "secrets", Kind: "Secret", Namespaced: true},
+	}
+	secret := parseObj(t, `{
+		"metadata": {
+			"name": "creds",
+			"namespace": "default",
+			"annotations": {
+				"kubectl.kubernetes.io/last-applied-configuration": "{\"data\":{\"password\":\"aHVudGVyMg==\"}}",
+				"owner": "me"
+			}
+		},
+		"data": {"password": "aHVudGVyMg==", "user": "YWRtaW4="}
+	}`)
+	redactor.Redact(secrets, secret)
+
+	data := secret["data"].(map[string]interface{})
+	if !isRedacted(data["password"]) || !isRedacted(data["user"]) {
+		t.Errorf("Secret data was not redacted: %v", data)
+	}
+	annotations := secret["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if !isRedacted(annotations["kubectl.kubernetes.io/last-applied-configuration"]) {
+		t.Errorf("last-applied-configuration annotation was not redacted: %v", annotations)
+	}
+	if annotations["owner"] != "me" {
+		t.Errorf("Unrelated annotation was redacted: %v", annotations)
+	}
+
+	deployments := &APIResource{
+		GroupVersion: schema.GroupVersion{Group: "apps", Version: "v1beta1"},
+		APIResource:  metav1.APIResource{Name: "deployments", Kind: "Deployment", Namespaced: true},
+	}
+	deployment := parseObj(t, `{
+		"metadata": {"name": "web", "namespace": "default"},
+		"spec": {"template": {"spec": {"containers": [{
+			"name": "web",
+			"env": [
+				{"name": "DB_PASSWORD", "value": "hunter2"},
+				{"name": "LOG_LEVEL", "value": "debug"}
+			]
+		}]}}}
+	}`)
+	redactor.Redact(deployments, deployment)
+
+	container := deployment["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	env := container["env"].([]interface{})
+	if !isRedacted(env[0].(map[string]interface{})["value"]) {
+		t.Errorf("DB_PASSWORD was not redacted: %v", env[0])
+	}
+	if env[1].(map[string]interface{})["value"] != "debug" {
+		t.Errorf("LOG_LEVEL should not have been redacted: %v", env[1])
+	}
+
+	expected := []RedactionRecord{
+		{Resource: "Deployments", Namespace: "default", Name: "web", Path: "spec.template.spec.containers[0].env[0].value", Rule: envRule},
+		{Resource: "Secrets", Namespace: "default", Name: "creds", Path: `data["password"]`, Rule: secretDataRule},
+		{Resource: "Secrets", Namespace: "default", Name: "creds", Path: `data["user"]`, Rule: secretDataRule},
+		{Resource: "Secrets", Namespace: "default", Name: "creds", Path: `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`, Rule: annotationRule},
+	}
+	if records := redactor.Records(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("Unexpected redaction records:\n%+v\nexpected:\n%+v", records, expected)
+	}
+}
+
+func TestRedactSecretLastApplied(t *testing.T) {
+	opts := config.NewWithDefaults().Redaction
+	opts.Annotations = []string{"example.com/token"}
+	redactor, err := NewRedactor(opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	secrets := &APIResource{
+		GroupVersion: schema.GroupVersion{Version: "v1"},
+		APIResource:  metav1.APIResource{Name: "secrets", Kind: "Secret", Namespaced: true},
+	}
+	secret := parseObj(t, `{
+		"metadata": {
+			"name": "creds",
+			"namespace": "default",
+			"annotations": {
+				"kubectl.kubernetes.io/last-applied-configuration": "{\"data\":{\"password\":\"aHVudGVyMg==\"}}",
+				"example.com/token": "abc"
+			}
+		}
+	}`)
+	redactor.Redact(secrets, secret)
+
+	annotations := secret["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if !isRedacted(annotations["kubectl.kubernetes.io/last-applied-configuration"]) || !isRedacted(annotations["example.com/token"]) {
+		t.Errorf("Secret annotations were not redacted: %v", annotations)
+	}
+
+	expected := []RedactionRecord{
+		{Resource: "Secrets", Namespace: "default", Name: "creds", Path: `metadata.annotations["example.com/token"]`, Rule: annotationRule},
+		{Resource: "Secrets", Namespace: "default", Name: "creds", Path: `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`, Rule: secretDataRule},
+	}
+	if records := redactor.Records(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("Unexpected redaction records:\n%+v\nexpected:\n%+v", records, expected)
+	}
+}
+
+func TestRedactRules(t *testing.T) {
+	redactor, err := NewRedactor(config.RedactionOptions{
+		Enabled: true,
+		Rules: []config.RedactionRule{
+			{Resources: []string{"ConfigMaps"}, Path: "data.*"},
+			{Path: `$.metadata.annotations["example.com/token"]`},
+			{Path: "spec.containers[*].args[1]"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	configMaps := &APIResource{
+		GroupVersion: schema.GroupVersion{Version: "v1"},
+		APIResource:  metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+	}
+	cm := parseObj(t, `{
+		"metadata": {"name": "cm", "annotations": {"example.com/token": "abc"}},
+		"data": {"a": "1", "b": "2"}
+	}`)
+	redactor.Redact(configMaps, cm)
+	data := cm["data"].(map[string]interface{})
+	if !isRedacted(data["a"]) || !isRedacted(data["b"]) {
+		t.Errorf("ConfigMap data was not redacted: %v", data)
+	}
+	if annotations := cm["metadata"].(map[string]interface{})["annotations"].(map[string]interface{}); !isRedacted(annotations["example.com/token"]) {
+		t.Errorf("Annotation was not redacted: %v", annotations)
+	}
+
+	pods := &APIResource{
+		GroupVersion: schema.GroupVersion{Version: "v1"},
+		APIResource:  metav1.APIResource{Name: "pods", Kind: "Pod", Namespaced: true},
+	}
+	pod := parseObj(t, `{
+		"metadata": {"name": "pod"},
+		"data": {"a": "1"},
+		"spec": {"containers": [{"args": ["--password", "hunter2"]}]}
+	}`)
+	redactor.Redact(pods, pod)
+	if data := pod["data"].(map[string]interface{}); data["a"] != "1" {
+		t.Errorf("Rule scoped to ConfigMaps should not apply to pods: %v", data)
+	}
+	args := pod["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})["args"].([]interface{})
+	if args[0] != "--password" || !isRedacted(args[1]) {
+		t.Errorf("Unexpected args after redaction: %v", args)
+	}
+}
+
+func TestParseRedactionPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []string
+		err      bool
+	}{
+		{"data.*", []string{"data", "*"}, false},
+		{"$.spec.containers[*].env[0].value", []string{"spec", "containers", "[*]", "env", "[0]", "value"}, false},
+		{`metadata.annotations["example.com/a[b]"]`, []string{"metadata", "annotations", "example.com/a[b]"}, false},
+		{"spec.containers[x]", nil, true},
+		{"spec.containers[0", nil, true},
+		{"", nil, true},
+	}
+
+	for _, test := range tests {
+		tokens, err := parseRedactionPath(test.path)
+		if (err != nil) != test.err {
+			t.Errorf("Unexpected error result for %q: %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(tokens, test.expected) {
+			t.Errorf("Expected %q to parse to %v, got %v", test.path, test.expected, tokens)
+		}
+	}
+}
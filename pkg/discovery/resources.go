@@ -0,0 +1,320 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AllResources is a special entry in config.Resources that selects every
+	// listable resource the API server advertises, including custom resources.
+	AllResources = "*"
+	// PodLogsResource is a special entry in config.Resources that enables pod
+	// log collection. It does not correspond to an API resource.
+	PodLogsResource = "PodLogs"
+	// ServerVersionResource is a special entry in config.Resources that
+	// enables collection of the API server's version information.
+	ServerVersionResource = "ServerVersion"
+)
+
+// APIResource is a listable resource advertised by the API server's discovery
+// endpoint, along with the group and version it is served from.
+type APIResource struct {
+	GroupVersion schema.GroupVersion
+	metav1.APIResource
+
+	// qualified is set when another group serves a resource with the same
+	// name, so that FileName needs the group to tell them apart.
+	qualified bool
+}
+
+// legacyResourceGroups maps the resource names sonobuoy collected before
+// resources were discovered dynamically to the group they were queried from.
+// When several groups serve a resource with one of these names, the resource
+// from this group keeps the unqualified name so existing results consumers
+// find it where they always have.
+var legacyResourceGroups = map[string]string{
+	"ConfigMaps":                 "",
+	"CronJobs":                   "batch",
+	"DaemonSets":                 "extensions",
+	"Deployments":                "apps",
+	"Endpoints":                  "",
+	"Events":                     "",
+	"HorizontalPodAutoscalers":   "autoscaling",
+	"Ingresses":                  "extensions",
+	"Jobs":                       "batch",
+	"LimitRanges":                "",
+	"PersistentVolumeClaims":     "",
+	"Pods":                       "",
+	"PodDisruptionBudgets":       "policy",
+	"PodPresets":                 "settings.k8s.io",
+	"PodTemplates":               "",
+	"ReplicaSets":                "extensions",
+	"ReplicationControllers":     "",
+	"ResourceQuotas":             "",
+	"RoleBindings":               "rbac.authorization.k8s.io",
+	"Roles":                      "rbac.authorization.k8s.io",
+	"Secrets":                    "",
+	"ServiceAccounts":            "",
+	"Services":                   "",
+	"StatefulSets":               "apps",
+	"CertificateSigningRequests": "certificates.k8s.io",
+	"ClusterRoleBindings":        "rbac.authorization.k8s.io",
+	"ClusterRoles":               "rbac.authorization.k8s.io",
+	"ComponentStatuses":          "",
+	"Nodes":                      "",
+	"PersistentVolumes":          "",
+	"PodSecurityPolicies":        "extensions",
+	"StorageClasses":             "storage.k8s.io",
+	"ThirdPartyResources":        "extensions",
+}
+
+// FileName is the name (without extension) used for this resource's results,
+// and in the per-directory query summary, eg. "Pods" or "Deployments". If
+// more than one group serves a resource with the same name, all but one of
+// them are qualified with their group (eg. "Deployments.extensions") so they
+// don't collide. See qualifyCollisions.
+func (r *APIResource) FileName() string {
+	name := r.baseName()
+	if !r.qualified || r.GroupVersion.Group == "" {
+		return name
+	}
+	return name + "." + r.GroupVersion.Group
+}
+
+func (r *APIResource) baseName() string {
+	return pluralKind(r.Kind, r.Name)
+}
+
+// qualifyCollisions marks the resources whose FileName would collide with
+// another's as qualified. Of each set of colliding resources, the one in the
+// group sonobuoy has historically queried it from (see legacyResourceGroups)
+// or else the one in the core group keeps the unqualified name. If neither
+// serves it, they're all qualified.
+func qualifyCollisions(resources []APIResource) {
+	byName := map[string][]int{}
+	for i := range resources {
+		name := resources[i].baseName()
+		byName[name] = append(byName[name], i)
+	}
+
+	for name, idxs := range byName {
+		if len(idxs) < 2 {
+			continue
+		}
+		keep, ok := legacyResourceGroups[name]
+		if !ok || !hasGroup(resources, idxs, keep) {
+			keep = ""
+		}
+		for _, i := range idxs {
+			resources[i].qualified = resources[i].GroupVersion.Group != keep
+		}
+	}
+}
+
+func hasGroup(resources []APIResource, idxs []int, group string) bool {
+	for _, i := range idxs {
+		if resources[i].GroupVersion.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the URL path under which this resource is listed, scoped to
+// the given namespace if the resource is namespaced.
+func (r *APIResource) path(ns string) []string {
+	var segments []string
+	if r.GroupVersion.Group == "" {
+		segments = []string{"/api", r.GroupVersion.Version}
+	} else {
+		segments = []string{"/apis", r.GroupVersion.Group, r.GroupVersion.Version}
+	}
+	if r.Namespaced {
+		segments = append(segments, "namespaces", ns)
+	}
+	return append(segments, r.Name)
+}
+
+// pluralKind combines a resource's Kind with its plural name so that
+// "PodDisruptionBudget"/"poddisruptionbudgets" becomes "PodDisruptionBudgets"
+// and "NetworkPolicy"/"networkpolicies" becomes "NetworkPolicies".
+func pluralKind(kind, plural string) string {
+	lowerKind := strings.ToLower(kind)
+	i := 0
+	for i < len(lowerKind) && i < len(plural) && lowerKind[i] == plural[i] {
+		i++
+	}
+	if i == 0 {
+		return plural
+	}
+	return kind[:i] + plural[i:]
+}
+
+// isSelected returns whether the given resource is matched by any of the
+// entries in selections.  Entries may be the resource's plural name
+// ("pods"), its kind ("Pod"), the capitalized plural sonobuoy has
+// historically used ("Pods"), or any of those qualified by group
+// ("deployments.apps", "Deployment.apps"). Comparison is case insensitive.
+func isSelected(selections []string, r *APIResource) bool {
+	names := []string{r.Name, r.Kind}
+	for _, sel := range selections {
+		if sel == AllResources {
+			return true
+		}
+		for _, name := range names {
+			if strings.EqualFold(sel, name) {
+				return true
+			}
+			if r.GroupVersion.Group != "" && strings.EqualFold(sel, name+"."+r.GroupVersion.Group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSelectedName returns whether the given special (non-API) resource name,
+// such as PodLogs, appears in the selections.
+func isSelectedName(selections []string, name string) bool {
+	for _, sel := range selections {
+		if strings.EqualFold(sel, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscoverResources uses the API server's discovery endpoint to find every
+// listable resource in the cluster's preferred group versions that is
+// selected by the given list of resource names, returning the namespaced and
+// cluster-scoped resources separately. The results are sorted by FileName so
+// that output is stable across runs.
+func DiscoverResources(kubeClient kubernetes.Interface, selections []string) (nsResources []APIResource, clusterResources []APIResource, err error) {
+	lists, err := kubeClient.Discovery().ServerPreferredResources()
+	if err != nil {
+		// Some aggregated API groups (eg. metrics) may be unavailable, but
+		// that shouldn't stop us from querying everything else.
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return nil, nil, err
+		}
+		glog.Warningf("Unable to discover some API groups, they will be skipped: %v", err)
+	}
+
+	var listable []APIResource
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			glog.Warningf("Skipping resources in unparseable group version %v: %v", list.GroupVersion, err)
+			continue
+		}
+
+		for _, res := range list.APIResources {
+			// Skip subresources such as pods/log, and anything we can't list
+			if strings.Contains(res.Name, "/") || !hasVerb(res.Verbs, "list") {
+				continue
+			}
+
+			listable = append(listable, APIResource{GroupVersion: gv, APIResource: res})
+		}
+	}
+
+	// Names are decided from everything the server serves, not just what's
+	// selected, so a resource's file name doesn't depend on the config.
+	qualifyCollisions(listable)
+
+	for _, r := range listable {
+		if !isSelected(selections, &r) {
+			continue
+		}
+		if r.Namespaced {
+			nsResources = append(nsResources, r)
+		} else {
+			clusterResources = append(clusterResources, r)
+		}
+	}
+
+	sortResources(nsResources)
+	sortResources(clusterResources)
+	return nsResources, clusterResources, nil
+}
+
+func sortResources(resources []APIResource) {
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].FileName() < resources[j].FileName()
+	})
+}
+
+func hasVerb(verbs metav1.Verbs, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// queryResource lists a page of objects of the given resource (in the given
+// namespace, if it's namespaced) using the raw REST client, so that types
+// unknown to client-go, such as custom resources, can be collected. A
+// pageSize of 0 lists everything at once.
+func queryResource(kubeClient kubernetes.Interface, r *APIResource, ns string, opts metav1.ListOptions, pageSize int64, continueToken string) (*unstructured.UnstructuredList, error) {
+	req := kubeClient.CoreV1().RESTClient().Get().AbsPath(r.path(ns)...)
+	if opts.LabelSelector != "" {
+		req = req.Param("labelSelector", opts.LabelSelector)
+	}
+	if pageSize > 0 {
+		req = req.Param("limit", strconv.FormatInt(pageSize, 10))
+	}
+	if continueToken != "" {
+		req = req.Param("continue", continueToken)
+	}
+
+	body, err := req.Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+	if err = runtime.DecodeInto(unstructured.UnstructuredJSONScheme, body, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listContinue returns the token to fetch the next page of the given list
+// with, or "" if this was the last page (or the API server doesn't support
+// paging.)
+func listContinue(list *unstructured.UnstructuredList) string {
+	metadata, ok := list.Object["metadata"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	token, _ := metadata["continue"].(string)
+	return token
+}
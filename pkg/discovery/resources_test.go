@@ -0,0 +1,110 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		group, kind, plural string
+		expected            string
+	}{
+		{"", "Pod", "pods", "Pods"},
+		{"", "Endpoints", "endpoints", "Endpoints"},
+		{"", "ComponentStatus", "componentstatuses", "ComponentStatuses"},
+		{"policy", "PodDisruptionBudget", "poddisruptionbudgets", "PodDisruptionBudgets"},
+		{"networking.k8s.io", "NetworkPolicy", "networkpolicies", "NetworkPolicies"},
+		{"example.com", "Widget", "gadgets", "gadgets"},
+	}
+
+	for _, test := range tests {
+		r := APIResource{
+			GroupVersion: schema.GroupVersion{Group: test.group, Version: "v1"},
+			APIResource:  metav1.APIResource{Name: test.plural, Kind: test.kind},
+		}
+		if name := r.FileName(); name != test.expected {
+			t.Errorf("Expected file name %v for %v, got %v", test.expected, test.plural, name)
+		}
+	}
+}
+
+func TestQualifyCollisions(t *testing.T) {
+	resource := func(group, kind, plural string) APIResource {
+		return APIResource{
+			GroupVersion: schema.GroupVersion{Group: group, Version: "v1"},
+			APIResource:  metav1.APIResource{Name: plural, Kind: kind},
+		}
+	}
+	resources := []APIResource{
+		resource("extensions", "Deployment", "deployments"),
+		resource("apps", "Deployment", "deployments"),
+		resource("", "Event", "events"),
+		resource("events.k8s.io", "Event", "events"),
+		resource("a.example.com", "Widget", "widgets"),
+		resource("b.example.com", "Widget", "widgets"),
+		resource("", "Pod", "pods"),
+	}
+	qualifyCollisions(resources)
+
+	expected := []string{
+		"Deployments.extensions",
+		"Deployments",
+		"Events",
+		"Events.events.k8s.io",
+		"Widgets.a.example.com",
+		"Widgets.b.example.com",
+		"Pods",
+	}
+	for i, r := range resources {
+		if name := r.FileName(); name != expected[i] {
+			t.Errorf("Expected file name %v for %v, got %v", expected[i], r.GroupVersion.WithResource(r.Name), name)
+		}
+	}
+}
+
+func TestIsSelected(t *testing.T) {
+	deployments := &APIResource{
+		GroupVersion: schema.GroupVersion{Group: "apps", Version: "v1beta1"},
+		APIResource:  metav1.APIResource{Name: "deployments", Kind: "Deployment"},
+	}
+
+	tests := []struct {
+		selections []string
+		expected   bool
+	}{
+		{[]string{"Deployments"}, true},
+		{[]string{"deployments"}, true},
+		{[]string{"Deployment"}, true},
+		{[]string{"deployments.apps"}, true},
+		{[]string{"Deployment.apps"}, true},
+		{[]string{"deployments.extensions"}, false},
+		{[]string{"Pods", "Services"}, false},
+		{[]string{AllResources}, true},
+		{[]string{}, false},
+	}
+
+	for _, test := range tests {
+		if selected := isSelected(test.selections, deployments); selected != test.expected {
+			t.Errorf("Expected isSelected(%v) to be %v, got %v", test.selections, test.expected, selected)
+		}
+	}
+}
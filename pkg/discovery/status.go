@@ -0,0 +1,220 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// StatusAnnotation is the annotation on the master pod holding the
+	// RunStatus of the run, for users who can read pods but can't reach the
+	// aggregation server.
+	StatusAnnotation = "sonobuoy.hept.io/status"
+
+	// PodNameEnv and PodNamespaceEnv are the environment variables (set via
+	// the downward API) that tell the master which pod it's running in.
+	PodNameEnv      = "SONOBUOY_POD_NAME"
+	PodNamespaceEnv = "SONOBUOY_POD_NAMESPACE"
+
+	// Phases of a run, as reported in RunStatus
+	PhaseRunningPlugins = "running-plugins"
+	PhaseCollecting     = "collecting"
+	PhaseComplete       = "complete"
+	PhaseFailed         = "failed"
+	// PhaseIncomplete is a run that was interrupted, but whose results so
+	// far were saved
+	PhaseIncomplete = "incomplete"
+
+	statusUpdateInterval = 15 * time.Second
+)
+
+// RunStatus is the compact summary of a run written to StatusAnnotation.
+type RunStatus struct {
+	Phase   string          `json:"phase"`
+	Plugins []PluginSummary `json:"plugins,omitempty"`
+	// Tarball is the path of the results within the master pod, once the
+	// run is complete
+	Tarball string `json:"tarball,omitempty"`
+	// Sessions are the session IDs of the run's plugins, which label the
+	// resources they create, so that they aren't mistaken for leftovers of
+	// another run.
+	Sessions []string `json:"sessions,omitempty"`
+}
+
+// PluginSummary counts the results of a single plugin.
+type PluginSummary struct {
+	Plugin    string `json:"plugin"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	Pending   int    `json:"pending"`
+}
+
+// statusReporter periodically writes the status of the run onto the master
+// pod's StatusAnnotation. A nil statusReporter reports nothing, which is the
+// case when the master isn't running in a pod.
+type statusReporter struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+
+	mutex       sync.Mutex
+	status      RunStatus
+	aggregation func() *aggregation.Status
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// newStatusReporter returns a statusReporter for the pod named by
+// PodNameEnv and PodNamespaceEnv, or nil if they aren't set.
+func newStatusReporter(kubeClient kubernetes.Interface) *statusReporter {
+	name, namespace := os.Getenv(PodNameEnv), os.Getenv(PodNamespaceEnv)
+	if name == "" || namespace == "" {
+		glog.Infof("%v and %v not set, not reporting status on the master pod", PodNameEnv, PodNamespaceEnv)
+		return nil
+	}
+	return &statusReporter{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		name:       name,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+}
+
+// start begins reporting the status, starting in the given phase, of a run
+// of the given plugins.
+func (r *statusReporter) start(phase string, plugins []plugin.Interface) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	for _, p := range plugins {
+		r.status.Sessions = append(r.status.Sessions, p.GetSessionID())
+	}
+	r.mutex.Unlock()
+	r.setPhase(phase)
+
+	go func() {
+		defer close(r.doneCh)
+		ticker := time.NewTicker(statusUpdateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.update()
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the periodic updates and writes the final status of the run.
+func (r *statusReporter) stop(phase, tarball string) {
+	if r == nil {
+		return
+	}
+	close(r.stopCh)
+	<-r.doneCh
+
+	r.mutex.Lock()
+	r.status.Tarball = tarball
+	r.mutex.Unlock()
+	r.setPhase(phase)
+}
+
+// setPhase moves the run to the given phase, reporting it right away.
+func (r *statusReporter) setPhase(phase string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.status.Phase = phase
+	r.mutex.Unlock()
+	r.update()
+}
+
+// watchAggregator includes the progress of the given aggregator's plugins
+// in the reported status.
+func (r *statusReporter) watchAggregator(aggr *aggregation.Aggregator) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.aggregation = aggr.Status
+}
+
+// update writes the current status to the pod's annotation. Failures are
+// logged rather than returned, since they shouldn't stop the run.
+func (r *statusReporter) update() {
+	r.mutex.Lock()
+	status := r.status
+	if r.aggregation != nil {
+		status.Plugins = SummarizePlugins(r.aggregation())
+	}
+	r.mutex.Unlock()
+
+	patch, err := statusPatch(status)
+	if err != nil {
+		glog.Warningf("Could not serialize run status: %v", err)
+		return
+	}
+
+	if _, err = r.kubeClient.CoreV1().Pods(r.namespace).Patch(r.name, types.MergePatchType, patch); err != nil {
+		glog.Warningf("Could not write run status to pod %v/%v: %v", r.namespace, r.name, err)
+	}
+}
+
+// statusPatch returns the merge patch writing the given status to the master
+// pod's StatusAnnotation.
+func statusPatch(status RunStatus) ([]byte, error) {
+	blob, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{StatusAnnotation: string(blob)},
+		},
+	})
+}
+
+// SummarizePlugins reduces the aggregator's status to per-plugin counts.
+func SummarizePlugins(status *aggregation.Status) []PluginSummary {
+	summaries := make([]PluginSummary, 0, len(status.Plugins))
+	for _, p := range status.Plugins {
+		summaries = append(summaries, PluginSummary{
+			Plugin:    p.ResultType,
+			Completed: p.Completed,
+			Failed:    p.Failed,
+			Pending:   p.Pending,
+		})
+	}
+	return summaries
+}
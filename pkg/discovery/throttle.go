@@ -0,0 +1,38 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+// Throttle bounds the number of API queries that discovery has in flight at
+// any one time. It is shared between every namespace, resource and pod log
+// query in a run, so callers must never hold a slot while waiting on another.
+type Throttle chan struct{}
+
+// NewThrottle returns a Throttle allowing up to concurrency queries at once.
+// A concurrency of less than 1 runs queries one at a time.
+func NewThrottle(concurrency int) Throttle {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return make(Throttle, concurrency)
+}
+
+// Do blocks until a slot is free, then runs fn while holding it.
+func (t Throttle) Do(fn func()) {
+	t <- struct{}{}
+	defer func() { <-t }()
+	fn()
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package discovery
 
 import (
+	"bufio"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -76,3 +77,58 @@ func SerializeObjAppend(f *os.File, obj interface{}) error {
 	}
 	return err
 }
+
+// arrayWriter streams objects out to a file as the elements of a JSON array.
+type arrayWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	count int
+}
+
+// newArrayWriter creates outpath/file and opens a JSON array in it.
+func newArrayWriter(outpath string, file string) (*arrayWriter, error) {
+	if err := os.MkdirAll(outpath, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(outpath + "/" + file)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	if _, err = w.WriteString("["); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &arrayWriter{f: f, w: w}, nil
+}
+
+// Write serializes obj and appends it to the array.
+func (a *arrayWriter) Write(obj interface{}) error {
+	blob, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if a.count > 0 {
+		if _, err = a.w.WriteString(","); err != nil {
+			return err
+		}
+	}
+	if _, err = a.w.Write(blob); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+// Close terminates the array, so the file is valid JSON even if not every
+// object was written, and closes the file.
+func (a *arrayWriter) Close() error {
+	_, err := a.w.WriteString("]")
+	if err == nil {
+		err = a.w.Flush()
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -27,9 +27,11 @@ import (
 	"os"
 	"path"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
 	"github.com/viniciuschiele/tarx"
 )
 
@@ -44,6 +46,12 @@ type Aggregator struct {
 	Results map[string]*plugin.Result
 	// ExpectedResults stores a map of results the server should expect
 	ExpectedResults map[string]*plugin.ExpectedResult
+	// RunID is the UUID of the sonobuoy run, reported in Status
+	RunID string
+
+	// startTime is when the aggregator was created, for reporting how long
+	// it has been running.
+	startTime time.Time
 
 	// resultEvents is a channel that is written to when results are seen
 	// by the server, so we can block until we're done.
@@ -51,6 +59,11 @@ type Aggregator struct {
 	// resultsMutex prevents race conditions if two identical results
 	// come in at the same time.
 	resultsMutex sync.Mutex
+	// pending counts the results still expected for each result type, and
+	// pluginDone has a channel for each result type that is closed when
+	// its count reaches zero.
+	pending    map[string]int
+	pluginDone map[string]chan struct{}
 }
 
 // NewAggregator constructs a new Aggregator object to write the given result
@@ -61,15 +74,73 @@ func NewAggregator(outputDir string, expected []plugin.ExpectedResult) *Aggregat
 		Results:         make(map[string]*plugin.Result, len(expected)),
 		ExpectedResults: make(map[string]*plugin.ExpectedResult, len(expected)),
 		resultEvents:    make(chan *plugin.Result, len(expected)),
+		startTime:       time.Now(),
+		pending:         make(map[string]int),
+		pluginDone:      make(map[string]chan struct{}),
 	}
 
 	for i, expResult := range expected {
 		aggr.ExpectedResults[expResult.ID()] = &expected[i]
 	}
+	for _, expResult := range aggr.ExpectedResults {
+		aggr.pending[expResult.ResultType]++
+		if _, ok := aggr.pluginDone[expResult.ResultType]; !ok {
+			aggr.pluginDone[expResult.ResultType] = make(chan struct{})
+		}
+	}
 
 	return aggr
 }
 
+// PluginDone returns a channel that is closed once every expected result of
+// the given type has come in (or been failed by FailPending.)
+func (a *Aggregator) PluginDone(resultType string) <-chan struct{} {
+	if done, ok := a.pluginDone[resultType]; ok {
+		return done
+	}
+
+	// Nothing to wait for
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// PluginFailed returns whether any result of the given type that has come in
+// is an error.
+func (a *Aggregator) PluginFailed(resultType string) bool {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	for _, result := range a.Results {
+		if result.ResultType == resultType && !result.IsSuccess() {
+			return true
+		}
+	}
+	return false
+}
+
+// FailPending records an error result, with the given reason, for each
+// result of the given type that hasn't come in yet, so the results show
+// which of them never reported. It returns how many results it failed.
+func (a *Aggregator) FailPending(resultType string, reason string) int {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	failed := 0
+	for id, expected := range a.ExpectedResults {
+		if _, ok := a.Results[id]; ok || expected.ResultType != resultType {
+			continue
+		}
+
+		result := utils.MakeErrorResult(resultType, map[string]interface{}{"error": reason}, expected.NodeName)
+		if err := a.handleResult(result); err != nil {
+			glog.Errorf("Could not record failed result %v: %v", id, err)
+		}
+		failed++
+	}
+	return failed
+}
+
 // Wait blocks until all expected results have come in.
 func (a *Aggregator) Wait(stop chan bool) {
 	for !a.isComplete() {
@@ -192,6 +263,11 @@ func (a *Aggregator) handleResult(result *plugin.Result) error {
 	defer func() {
 		a.Results[result.ExpectedResultID()] = result
 		a.resultEvents <- result
+
+		a.pending[result.ResultType]--
+		if a.pending[result.ResultType] == 0 {
+			close(a.pluginDone[result.ResultType])
+		}
 	}()
 
 	// Create the output directory for the result.  Will be of the
@@ -18,6 +18,7 @@ package aggregation
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -170,6 +171,129 @@ func TestAggregation_errors(t *testing.T) {
 	})
 }
 
+func TestAggregation_status(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{NodeName: "node2", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator) {
+		agg.RunID = "testrun"
+
+		resp := doRequest(t, "PUT", "/api/v1/results/by-node/node1/systemd_logs.json", []byte("foo"))
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+		resultsCh := make(chan *plugin.Result, 1)
+		resultsCh <- pluginutils.MakeErrorResult("e2e", map[string]interface{}{"error": "foo"}, "")
+		close(resultsCh)
+		agg.IngestResults(resultsCh)
+
+		resp = doRequest(t, "GET", "/api/v1/status", nil)
+		if resp.StatusCode != 200 {
+			t.Fatalf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+		var status Status
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatalf("Could not decode status: %v", err)
+		}
+		if status.RunID != "testrun" || status.Complete || len(status.Plugins) != 2 {
+			t.Fatalf("Unexpected status: %+v", status)
+		}
+
+		e2e := status.Plugins[0]
+		if e2e.ResultType != "e2e" || e2e.Failed != 1 || e2e.Results[0].Error != "foo" {
+			t.Errorf("Unexpected e2e status: %+v", e2e)
+		}
+
+		resp = doRequest(t, "GET", "/api/v1/status/systemd_logs", nil)
+		if resp.StatusCode != 200 {
+			t.Fatalf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+		var logs PluginStatus
+		if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+			t.Fatalf("Could not decode plugin status: %v", err)
+		}
+		expectedResults := []ResultStatus{
+			{NodeName: "node1", Status: ResultStatusComplete},
+			{NodeName: "node2", Status: ResultStatusPending},
+		}
+		if logs.Completed != 1 || logs.Pending != 1 || len(logs.Results) != 2 ||
+			logs.Results[0] != expectedResults[0] || logs.Results[1] != expectedResults[1] {
+			t.Errorf("Unexpected systemd_logs status: %+v", logs)
+		}
+
+		resp = doRequest(t, "GET", "/api/v1/status/nonexistent", nil)
+		if resp.StatusCode != 404 {
+			t.Errorf("Expected a 404 for an unknown plugin, got %v", resp.StatusCode)
+		}
+
+		resp = doRequest(t, "PUT", "/api/v1/status", nil)
+		if resp.StatusCode != 405 {
+			t.Errorf("Expected a 405 for a PUT to the status API, got %v", resp.StatusCode)
+		}
+	})
+}
+
+func TestAggregation_failPending(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{NodeName: "node2", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	isClosed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator) {
+		if !isClosed(agg.PluginDone("unknown")) {
+			t.Error("Expected a plugin with no expected results to be done")
+		}
+
+		resp := doRequest(t, "PUT", "/api/v1/results/by-node/node1/systemd_logs.json", []byte("foo"))
+		if resp.StatusCode != 200 {
+			t.Fatalf("Got (%v) response from server", resp.StatusCode)
+		}
+		if isClosed(agg.PluginDone("systemd_logs")) {
+			t.Fatal("Expected systemd_logs not to be done with node2 outstanding")
+		}
+
+		if n := agg.FailPending("systemd_logs", "timed out"); n != 1 {
+			t.Errorf("Expected 1 result to be failed, got %v", n)
+		}
+		if !isClosed(agg.PluginDone("systemd_logs")) {
+			t.Error("Expected systemd_logs to be done")
+		}
+		if isClosed(agg.PluginDone("e2e")) {
+			t.Error("Expected e2e not to be done")
+		}
+
+		if result := agg.Results["systemd_logs/node1"]; result == nil || !result.IsSuccess() {
+			t.Errorf("Expected node1's result to be kept, got %+v", result)
+		}
+		result := agg.Results["systemd_logs/node2"]
+		if result == nil || result.Error != "timed out" {
+			t.Fatalf("Expected node2's result to be failed, got %+v", result)
+		}
+		if _, err := os.Stat(path.Join(agg.OutputDir, result.Path()) + ".json"); err != nil {
+			t.Errorf("Expected node2's error to be written out: %v", err)
+		}
+
+		// The failed result counts as received
+		resp = doRequest(t, "PUT", "/api/v1/results/by-node/node2/systemd_logs.json", []byte("foo"))
+		if resp.StatusCode != 409 {
+			t.Errorf("Expected a 409 for a result that timed out, got %v", resp.StatusCode)
+		}
+	})
+}
+
 func withAggregator(t *testing.T, expected []plugin.ExpectedResult, callback func(*Aggregator)) {
 	dir, err := ioutil.TempDir("", "sonobuoy_server_test")
 	if err != nil {
@@ -181,6 +305,7 @@ func withAggregator(t *testing.T, expected []plugin.ExpectedResult, callback fun
 
 	agg := NewAggregator(dir, expected)
 	srv := NewServer(":"+strconv.Itoa(testPort), agg.HandleHTTPResult)
+	srv.StatusCallback = agg.Status
 
 	// Run the server, ensuring it's fully stopped before returning
 	done := make(chan error)
@@ -209,7 +334,7 @@ func makeTarWithContents(t *testing.T, filename string, fileContents []byte) (ta
 	tardir := path.Join(dir, "results")
 	err = os.Mkdir(tardir, 0755)
 	if err != nil {
-		t.Fatal("Could not create results directory %v: %v", tardir, err)
+		t.Fatalf("Could not create results directory %v: %v", tardir, err)
 		return
 	}
 
@@ -0,0 +1,89 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+// dependencies returns the names of the plugins each plugin must wait for:
+// those it names in its dependsOn, and every plugin in an earlier phase. It
+// returns an error if a plugin depends on one that isn't being run, or if the
+// dependencies form a cycle.
+func dependencies(plugins []plugin.Interface) (map[string][]string, error) {
+	names := make(map[string]bool, len(plugins))
+	for _, p := range plugins {
+		names[p.GetName()] = true
+	}
+
+	deps := make(map[string][]string, len(plugins))
+	for _, p := range plugins {
+		seen := make(map[string]bool)
+		for _, name := range p.GetDependsOn() {
+			if !names[name] {
+				return nil, fmt.Errorf("plugin %v depends on plugin %v, which isn't being run", p.GetName(), name)
+			}
+			if !seen[name] {
+				seen[name] = true
+				deps[p.GetName()] = append(deps[p.GetName()], name)
+			}
+		}
+		for _, other := range plugins {
+			if other.GetPhase() < p.GetPhase() && !seen[other.GetName()] {
+				seen[other.GetName()] = true
+				deps[p.GetName()] = append(deps[p.GetName()], other.GetName())
+			}
+		}
+	}
+
+	// Look for cycles with a depth-first search
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(plugins))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("plugin dependencies form a cycle: %v", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, p := range plugins {
+		if err := visit(p.GetName(), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return deps, nil
+}
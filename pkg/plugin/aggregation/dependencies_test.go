@@ -0,0 +1,122 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+)
+
+func TestDependencies(t *testing.T) {
+	newPlugin := func(name string, phase int, dependsOn ...string) plugin.Interface {
+		return job.NewPlugin("sonobuoy", plugin.Definition{
+			Name:       name,
+			ResultType: name,
+			DependsOn:  dependsOn,
+			Phase:      phase,
+		}, &plugin.WorkerConfig{})
+	}
+
+	tests := []struct {
+		name     string
+		plugins  []plugin.Interface
+		expected map[string][]string
+		err      string
+	}{
+		{
+			name: "independent",
+			plugins: []plugin.Interface{
+				newPlugin("inventory", 0),
+				newPlugin("e2e", 0),
+			},
+			expected: map[string][]string{},
+		},
+		{
+			name: "dependsOn",
+			plugins: []plugin.Interface{
+				newPlugin("e2e", 0, "inventory", "inventory"),
+				newPlugin("inventory", 0),
+			},
+			expected: map[string][]string{
+				"e2e": {"inventory"},
+			},
+		},
+		{
+			name: "phases",
+			plugins: []plugin.Interface{
+				newPlugin("post-checks", 2),
+				newPlugin("e2e", 1, "inventory"),
+				newPlugin("inventory", 0),
+				newPlugin("systemd_logs", 0),
+			},
+			expected: map[string][]string{
+				"post-checks": {"e2e", "inventory", "systemd_logs"},
+				"e2e":         {"inventory", "systemd_logs"},
+			},
+		},
+		{
+			name: "missing dependency",
+			plugins: []plugin.Interface{
+				newPlugin("e2e", 0, "inventory"),
+			},
+			err: "isn't being run",
+		},
+		{
+			name: "cycle",
+			plugins: []plugin.Interface{
+				newPlugin("a", 0, "b"),
+				newPlugin("b", 0, "c"),
+				newPlugin("c", 0, "a"),
+			},
+			err: "a -> b -> c -> a",
+		},
+		{
+			name: "cycle through phases",
+			plugins: []plugin.Interface{
+				newPlugin("early", 0, "late"),
+				newPlugin("late", 1),
+			},
+			err: "cycle",
+		},
+	}
+
+	for _, test := range tests {
+		deps, err := dependencies(test.plugins)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: expected error containing %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		for _, d := range deps {
+			sort.Strings(d)
+		}
+		if !reflect.DeepEqual(deps, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, deps)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// logGatherTimeout is how long gathering the logs of a plugin may take,
+	// so a slow or stalled log stream can't hold up the run.
+	logGatherTimeout = 2 * time.Minute
+	// maxLogBytes and maxLogAge bound how much of each container's log is
+	// saved; plugins logging more only have the start of their logs saved,
+	// and those running longer only the most recent.
+	maxLogBytes = 10 * 1024 * 1024
+	maxLogAge   = 24 * time.Hour
+)
+
+// GatherLogs saves the logs of every container of every pod created by the
+// given plugins, whether they succeeded or not, so they outlive Cleanup. Logs
+// are written to <outdir>/<result type>/logs/<node or pod>/<container>.txt,
+// along with <container>-previous.txt if the container has restarted. Once
+// ctx is done, any logs still being saved are cut short.
+func GatherLogs(ctx context.Context, client kubernetes.Interface, plugins []plugin.Interface, outdir string) (errors []error) {
+	for _, p := range plugins {
+		pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+			LabelSelector: plugin.SessionLabel + "=" + p.GetSessionID(),
+		})
+		if err != nil {
+			errors = append(errors, fmt.Errorf("could not list pods for plugin %v: %v", p.GetName(), err))
+			continue
+		}
+
+		for _, pod := range pods.Items {
+			// Pods on a node are named after it, like their results
+			dir := pod.Spec.NodeName
+			if dir == "" {
+				dir = pod.Name
+			}
+			dir = path.Join(outdir, p.GetResultType(), "logs", dir)
+
+			for _, cstatus := range pod.Status.InitContainerStatuses {
+				errors = append(errors, gatherContainerLogs(ctx, client, &pod, cstatus, dir)...)
+			}
+			for _, cstatus := range pod.Status.ContainerStatuses {
+				errors = append(errors, gatherContainerLogs(ctx, client, &pod, cstatus, dir)...)
+			}
+		}
+	}
+
+	return errors
+}
+
+// gatherContainerLogs saves the current and, if there is one, previous log of
+// a container in dir.
+func gatherContainerLogs(ctx context.Context, client kubernetes.Interface, pod *v1.Pod, cstatus v1.ContainerStatus, dir string) (errors []error) {
+	// A container that has never run has no logs to fetch
+	if cstatus.State.Waiting == nil || cstatus.RestartCount > 0 {
+		if err := saveLog(ctx, client, pod, cstatus.Name, false, path.Join(dir, cstatus.Name+".txt")); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if cstatus.RestartCount > 0 {
+		if err := saveLog(ctx, client, pod, cstatus.Name, true, path.Join(dir, cstatus.Name+"-previous.txt")); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return errors
+}
+
+// saveLog saves the log of a container to filename, cutting it short once
+// ctx is done.
+func saveLog(ctx context.Context, client kubernetes.Interface, pod *v1.Pod, container string, previous bool, filename string) error {
+	glog.V(5).Infof("Saving logs of container %v in pod %v to %v", container, pod.Name, filename)
+	limitBytes := int64(maxLogBytes)
+	sinceSeconds := int64(maxLogAge / time.Second)
+	logs, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container:    container,
+		Previous:     previous,
+		LimitBytes:   &limitBytes,
+		SinceSeconds: &sinceSeconds,
+	}).Context(ctx).Stream()
+	if err != nil {
+		return fmt.Errorf("could not get logs of container %v in pod %v: %v", container, pod.Name, err)
+	}
+	defer logs.Close()
+
+	if err = os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, logs); err != nil {
+		return fmt.Errorf("could not save logs of container %v in pod %v: %v", container, pod.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// withLogServer calls callback with a client for a fake API server that
+// serves the given pods, and the logs of their containers from serveLog.
+func withLogServer(t *testing.T, pods []v1.Pod, serveLog func(w http.ResponseWriter, r *http.Request, pod, container string), callback func(kubernetes.Interface)) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/pods" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&v1.PodList{
+				TypeMeta: metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"},
+				Items:    pods,
+			})
+			return
+		}
+
+		// /api/v1/namespaces/<namespace>/pods/<pod>/log
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 7 || parts[6] != "log" {
+			http.NotFound(w, r)
+			return
+		}
+		serveLog(w, r, parts[5], r.URL.Query().Get("container"))
+	}))
+	defer server.Close()
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	callback(client)
+}
+
+func TestGatherLogs(t *testing.T) {
+	p := job.NewPlugin("sonobuoy", plugin.Definition{Name: "e2e", ResultType: "e2e"}, &plugin.WorkerConfig{})
+	labels := map[string]string{plugin.SessionLabel: p.GetSessionID()}
+	running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "sonobuoy", Name: "on-node", Labels: labels},
+			Spec:       v1.PodSpec{NodeName: "node1"},
+			Status: v1.PodStatus{
+				InitContainerStatuses: []v1.ContainerStatus{
+					{Name: "setup", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{}}},
+				},
+				ContainerStatuses: []v1.ContainerStatus{
+					{Name: "plugin", State: running},
+					{Name: "sonobuoy-worker", State: running},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "sonobuoy", Name: "unscheduled", Labels: labels},
+			Status: v1.PodStatus{
+				ContainerStatuses: []v1.ContainerStatus{
+					{Name: "plugin", State: running, RestartCount: 1},
+					{Name: "never-started", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{}}},
+				},
+			},
+		},
+	}
+
+	var badQueries []string
+	serveLog := func(w http.ResponseWriter, r *http.Request, pod, container string) {
+		query := r.URL.Query()
+		if query.Get("limitBytes") != strconv.Itoa(maxLogBytes) || query.Get("sinceSeconds") != strconv.Itoa(int(maxLogAge/time.Second)) {
+			badQueries = append(badQueries, r.URL.RawQuery)
+		}
+		fmt.Fprintf(w, "%v/%v previous=%v", pod, container, query.Get("previous") == "true")
+	}
+
+	outdir, err := ioutil.TempDir("", "sonobuoy_logs")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	withLogServer(t, pods, serveLog, func(client kubernetes.Interface) {
+		if errs := GatherLogs(context.Background(), client, []plugin.Interface{p}, outdir); len(errs) > 0 {
+			t.Fatalf("Unexpected errors: %v", errs)
+		}
+	})
+
+	if len(badQueries) > 0 {
+		t.Errorf("Expected logs to be limited to %v bytes and %v, got queries %v", maxLogBytes, maxLogAge, badQueries)
+	}
+
+	expected := map[string]string{
+		"e2e/logs/node1/setup.txt":                 "on-node/setup previous=false",
+		"e2e/logs/node1/plugin.txt":                "on-node/plugin previous=false",
+		"e2e/logs/node1/sonobuoy-worker.txt":       "on-node/sonobuoy-worker previous=false",
+		"e2e/logs/unscheduled/plugin.txt":          "unscheduled/plugin previous=false",
+		"e2e/logs/unscheduled/plugin-previous.txt": "unscheduled/plugin previous=true",
+	}
+	for file, content := range expected {
+		raw, err := ioutil.ReadFile(path.Join(outdir, file))
+		if err != nil {
+			t.Errorf("Expected log %v: %v", file, err)
+			continue
+		}
+		if string(raw) != content {
+			t.Errorf("Expected log %v to be %q, got %q", file, content, raw)
+		}
+	}
+	if _, err = os.Stat(path.Join(outdir, "e2e/logs/unscheduled/never-started.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no log for a container that never started, got %v", err)
+	}
+}
+
+func TestGatherLogsDeadline(t *testing.T) {
+	p := job.NewPlugin("sonobuoy", plugin.Definition{Name: "e2e", ResultType: "e2e"}, &plugin.WorkerConfig{})
+	pods := []v1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "sonobuoy",
+			Name:      "chatty",
+			Labels:    map[string]string{plugin.SessionLabel: p.GetSessionID()},
+		},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "plugin", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			},
+		},
+	}}
+
+	// A follow-like stream that never ends on its own
+	serveLog := func(w http.ResponseWriter, r *http.Request, pod, container string) {
+		fmt.Fprintln(w, "starting")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+
+	outdir, err := ioutil.TempDir("", "sonobuoy_logs")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	withLogServer(t, pods, serveLog, func(client kubernetes.Interface) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		done := make(chan []error, 1)
+		go func() { done <- GatherLogs(ctx, client, []plugin.Interface{p}, outdir) }()
+		select {
+		case errs := <-done:
+			if len(errs) != 1 {
+				t.Errorf("Expected an error for the log cut short, got %v", errs)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected gathering logs to stop once the deadline passed")
+		}
+	})
+}
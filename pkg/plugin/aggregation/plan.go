@@ -0,0 +1,64 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"fmt"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PluginPlan is what a dry run reports about a plugin: the plugins it would
+// wait for, the results it would be expected to submit, and the resources it
+// would create.
+type PluginPlan struct {
+	Name            string                  `json:"name"`
+	ResultType      string                  `json:"resultType"`
+	WaitsFor        []string                `json:"waitsFor,omitempty"`
+	ExpectedResults []plugin.ExpectedResult `json:"expectedResults"`
+	Resources       []runtime.Object        `json:"resources"`
+}
+
+// Plan is the dry run counterpart of Run. It checks the plugins' dependencies
+// and works out what each plugin would do in a cluster with the given nodes,
+// without creating anything. Worker credentials are only made for real runs,
+// so the Secrets that would hold them are empty, and owner references are
+// left out.
+func Plan(plugins []plugin.Interface, nodes []v1.Node) ([]PluginPlan, error) {
+	deps, err := dependencies(plugins)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]PluginPlan, 0, len(plugins))
+	for _, p := range plugins {
+		resources, err := p.Resources(nodes, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not build resources for plugin %v: %v", p.GetName(), err)
+		}
+		plans = append(plans, PluginPlan{
+			Name:            p.GetName(),
+			ResultType:      p.GetResultType(),
+			WaitsFor:        deps[p.GetName()],
+			ExpectedResults: p.ExpectedResults(nodes),
+			Resources:       resources,
+		})
+	}
+	return plans, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/daemonset"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPlan(t *testing.T) {
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+	}
+	cfg := &plugin.WorkerConfig{MasterURL: "https://sonobuoy-master:8080/api/v1/results/global/e2e"}
+	plugins := []plugin.Interface{
+		job.NewPlugin("sonobuoy", plugin.Definition{Name: "e2e", ResultType: "e2e", Phase: 1}, cfg),
+		daemonset.NewPlugin("sonobuoy", plugin.Definition{Name: "systemd_logs", ResultType: "systemd_logs"}, cfg),
+	}
+
+	plans, err := Plan(plugins, nodes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plans) != 2 {
+		t.Fatalf("expected 2 plugin plans, got %v", len(plans))
+	}
+
+	e2e, logs := plans[0], plans[1]
+	if len(e2e.WaitsFor) != 1 || e2e.WaitsFor[0] != "systemd_logs" {
+		t.Errorf("expected e2e to wait for systemd_logs, got %v", e2e.WaitsFor)
+	}
+	if len(e2e.ExpectedResults) != 1 || len(logs.ExpectedResults) != 2 {
+		t.Errorf("expected 1 e2e result and 2 systemd_logs results, got %v and %v", e2e.ExpectedResults, logs.ExpectedResults)
+	}
+
+	for _, p := range plans {
+		if len(p.Resources) != 3 {
+			t.Errorf("expected plugin %v to create 3 resources, got %v", p.Name, len(p.Resources))
+			continue
+		}
+		cm, ok := p.Resources[0].(*v1.ConfigMap)
+		if !ok {
+			t.Errorf("expected plugin %v's first resource to be a ConfigMap, got %T", p.Name, p.Resources[0])
+			continue
+		}
+		if strings.Contains(cm.Data["worker.json"], "BEGIN") {
+			t.Errorf("expected plugin %v's worker config to leave out credentials, got %v", p.Name, cm.Data["worker.json"])
+		}
+		secret, ok := p.Resources[1].(*v1.Secret)
+		if !ok {
+			t.Errorf("expected plugin %v's second resource to be a Secret, got %T", p.Name, p.Resources[1])
+			continue
+		}
+		if len(secret.Data) != 0 {
+			t.Errorf("expected plugin %v's credentials to be left out of the plan, got %v", p.Name, secret.Data)
+		}
+		if kind := p.Resources[2].GetObjectKind().GroupVersionKind().Kind; kind == "" {
+			t.Errorf("expected plugin %v's resources to have a kind", p.Name)
+		}
+	}
+}
+
+func TestPlanBadDependencies(t *testing.T) {
+	plugins := []plugin.Interface{
+		job.NewPlugin("sonobuoy", plugin.Definition{Name: "e2e", ResultType: "e2e", DependsOn: []string{"missing"}}, &plugin.WorkerConfig{}),
+	}
+	if _, err := Plan(plugins, nil); err == nil {
+		t.Errorf("expected an error for a missing dependency")
+	}
+}
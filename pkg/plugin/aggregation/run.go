@@ -17,11 +17,19 @@ limitations under the License.
 package aggregation
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/ca"
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -36,11 +44,25 @@ import (
 // 2. Launch the HTTP server with the aggr's HandleHTTPResult function as the
 //    callback
 // 3. Run all the aggregation plugins, monitoring each one in a goroutine,
-//    configuring them to send failure results through a shared channel
+//    configuring them to send failure results through a shared channel. Once
+//    each plugin's results are in, or its timeout passes and its outstanding
+//    results are recorded as failed, its logs are saved and it's cleaned up.
+//    Plugins are only run once the plugins they depend on (see dependencies)
+//    have finished; if any of those failed, they are skipped, and all their
+//    results recorded as failed.
 // 4. Hook the shared monitoring channel up to aggr's IngestResults() function
 // 5. Block until aggr shows all results accounted for (results come in through
 //    the HTTP callback), stopping the HTTP server on completion
-func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.AggregationConfig, outdir string) []error {
+//
+// If onStart is non-nil, it is called with the aggregator as soon as it is
+// created, so that its progress can be reported elsewhere. If owner is
+// non-nil, every resource the plugins create belongs to it. The plugins' pods
+// are watched for failures in namespace, which is where they're created.
+//
+// If ctx is done before every result is in, no more plugins are run, the
+// results that haven't come in are recorded as failed, and every plugin that
+// was run is cleaned up before Run returns.
+func Run(ctx context.Context, client kubernetes.Interface, namespace string, plugins []plugin.Interface, cfg plugin.AggregationConfig, owner *metav1.OwnerReference, runID, outdir string, onStart func(*Aggregator)) []error {
 	var errors []error
 
 	// Construct a list of things we'll need to dispatch
@@ -48,6 +70,10 @@ func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.Agg
 		glog.Info("Skipping host data gathering: no plugins defined")
 		return errors
 	}
+	deps, err := dependencies(plugins)
+	if err != nil {
+		return append(errors, err)
+	}
 
 	// Get a list of nodes so the plugins can properly estimate what
 	// results they'll give.
@@ -67,8 +93,43 @@ func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.Agg
 
 	glog.V(5).Infof("Starting server Expected Results: %v", expectedResults)
 
+	// Every run gets its own certificate authority, so that only the workers
+	// launched by this run, each with a certificate for its own plugin, can
+	// submit results.
+	authority, err := ca.NewAuthority()
+	if err != nil {
+		return append(errors, fmt.Errorf("could not create certificate authority: %v", err))
+	}
+	serverCert, err := authority.ServerCertificate(advertiseHost(cfg.AdvertiseAddress))
+	if err != nil {
+		return append(errors, fmt.Errorf("could not create server certificate: %v", err))
+	}
+	creds := make(map[string]*plugin.WorkerCredentials, len(plugins))
+	tokens := make(map[string]string, len(plugins))
+	for _, p := range plugins {
+		certPEM, keyPEM, err := authority.ClientCertificate(p.GetResultType())
+		if err != nil {
+			return append(errors, fmt.Errorf("could not create client certificate for plugin %v: %v", p.GetName(), err))
+		}
+		token, err := newToken()
+		if err != nil {
+			return append(errors, fmt.Errorf("could not create token for plugin %v: %v", p.GetName(), err))
+		}
+		creds[p.GetSessionID()] = &plugin.WorkerCredentials{
+			CACert:     string(authority.CACertPEM()),
+			ClientCert: string(certPEM),
+			ClientKey:  string(keyPEM),
+			Token:      token,
+		}
+		tokens[p.GetResultType()] = token
+	}
+
 	// 1. Await results from each plugin
 	aggr := NewAggregator(outdir+"/plugins", expectedResults)
+	aggr.RunID = runID
+	if onStart != nil {
+		onStart(aggr)
+	}
 	doneAggr := make(chan bool, 1)
 	monitorCh := make(chan *plugin.Result, len(expectedResults))
 	stopWaitCh := make(chan bool, 1)
@@ -80,52 +141,162 @@ func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.Agg
 
 	// 2. Launch the aggregation server
 	srv := NewServer(cfg.BindAddress+":"+strconv.Itoa(cfg.BindPort), aggr.HandleHTTPResult)
+	srv.StatusCallback = aggr.Status
+	srv.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{*serverCert},
+		ClientCAs:    authority.CertPool(),
+		// Results require a certificate, but the status API doesn't
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}
+	srv.Tokens = tokens
 	doneServ := make(chan error)
 	go func() {
 		doneServ <- srv.Start()
 	}()
 
-	// 3. Launch each plugin, to dispatch workers which submit the results back
+	// errors is appended to concurrently from here on
+	var errMutex sync.Mutex
+	rollup := func(errs ...error) {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		errors = append(errors, errs...)
+	}
+
+	// 3. Launch each plugin, to dispatch workers which submit the results
+	// back, and see each one through on its own: monitoring it until its
+	// results are in or it times out, then cleaning up after it.
+	stopWatchCh := make(chan struct{})
+	defer close(stopWatchCh)
+	pods := plugin.NewPodWatcher(client, namespace)
+	go pods.Run(stopWatchCh)
+
+	// ctx is also cancelled if the server fails, since no results can come
+	// in after that.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	interrupted := func(p plugin.Interface) {
+		aggr.FailPending(p.GetResultType(), fmt.Sprintf("Run was interrupted before results came in from plugin %v", p.GetName()))
+	}
+
+	var wg sync.WaitGroup
+	byName := make(map[string]plugin.Interface, len(plugins))
+	finished := make(map[string]chan struct{}, len(plugins))
 	for _, p := range plugins {
-		glog.Infof("Running (%v) plugin", p.GetName())
-		err := p.Run(client)
-		// Have the plugin monitor for errors
-		go p.Monitor(client, nodes.Items, monitorCh)
-		if err != nil {
-			errors = append(errors, err)
+		byName[p.GetName()] = p
+		finished[p.GetName()] = make(chan struct{})
+	}
+	for _, p := range plugins {
+		timeout := p.GetTimeout()
+		if timeout == 0 {
+			timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
 		}
+
+		wg.Add(1)
+		go func(p plugin.Interface, timeout time.Duration) {
+			defer wg.Done()
+			defer close(finished[p.GetName()])
+
+			for _, dep := range deps[p.GetName()] {
+				select {
+				case <-finished[dep]:
+				case <-ctx.Done():
+					interrupted(p)
+					return
+				}
+			}
+			for _, dep := range deps[p.GetName()] {
+				if aggr.PluginFailed(byName[dep].GetResultType()) {
+					glog.Warningf("Skipping (%v) plugin: plugin %v failed", p.GetName(), dep)
+					aggr.FailPending(p.GetResultType(), fmt.Sprintf("Skipped due to failed dependency %v", dep))
+					return
+				}
+			}
+
+			if ctx.Err() != nil {
+				interrupted(p)
+				return
+			}
+
+			glog.Infof("Running (%v) plugin", p.GetName())
+			if err := p.Run(client, nodes.Items, creds[p.GetSessionID()], owner); err != nil {
+				rollup(err)
+				// Its results will never come
+				aggr.FailPending(p.GetResultType(), fmt.Sprintf("Could not run plugin %v: %v", p.GetName(), err))
+			}
+
+			// Have the plugin monitor for errors
+			monitorCtx, stopMonitor := context.WithCancel(ctx)
+			go p.Monitor(monitorCtx, client, nodes.Items, pods, monitorCh)
+
+			select {
+			case <-aggr.PluginDone(p.GetResultType()):
+				glog.Infof("All results from (%v) plugin are in", p.GetName())
+			case <-time.After(timeout):
+				n := aggr.FailPending(p.GetResultType(), fmt.Sprintf("Timed out after %v waiting for results from plugin %v", timeout, p.GetName()))
+				rollup(fmt.Errorf("timed out after %v waiting for %v results from plugin %v", timeout, n, p.GetName()))
+			case <-ctx.Done():
+				glog.Warningf("Cleaning up (%v) plugin early: %v", p.GetName(), ctx.Err())
+				interrupted(p)
+			}
+			stopMonitor()
+
+			// When interrupted, there may not be time to gather the logs
+			// before we're killed, and cleaning up matters more.
+			if ctx.Err() == nil {
+				logCtx, cancelLogs := context.WithTimeout(ctx, logGatherTimeout)
+				rollup(GatherLogs(logCtx, client, []plugin.Interface{p}, outdir+"/plugins")...)
+				cancelLogs()
+			}
+			rollup(p.Cleanup(client)...)
+		}(p, timeout)
 	}
 	// 4. Have the aggregator plumb results from each plugins' monitor function
 	go aggr.IngestResults(monitorCh)
 
-	// Ensure we only wait for results for a certain time
-	timeout := make(chan bool, 1)
-	go func() {
-		time.Sleep(time.Duration(cfg.TimeoutSeconds) * time.Second)
-		timeout <- true
-	}()
-
-	// 5. Wait for aggr to show that all results are accounted for
+	// 5. Wait for aggr to show that all results are accounted for, which
+	// includes those failed by timeouts
 	select {
-	case <-timeout:
-		errors = append(errors, fmt.Errorf("timed out waiting for results, shutting down HTTP server"))
-		srv.Stop()
-		stopWaitCh <- true
 	case err := <-doneServ:
-		errors = append(errors, fmt.Errorf("Error running aggregation server: %v", err))
+		rollup(fmt.Errorf("Error running aggregation server: %v", err))
+		stopWaitCh <- true
+		cancel()
+	case <-ctx.Done():
+		rollup(fmt.Errorf("aggregation interrupted: %v", ctx.Err()))
 		stopWaitCh <- true
+		srv.Stop()
+		<-doneServ
 	case <-doneAggr:
-		break
+		// Every result is in, so stop the server and wait for it to shut
+		// down.
+		srv.Stop()
+		<-doneServ
+	}
+	wg.Wait()
+
+	if err := os.MkdirAll(aggr.OutputDir, 0755); err != nil {
+		errors = append(errors, err)
+	} else if err = aggr.WriteStatus(); err != nil {
+		errors = append(errors, fmt.Errorf("could not write aggregation status: %v", err))
 	}
 
 	return errors
 }
 
-func Cleanup(client kubernetes.Interface, plugins []plugin.Interface) (errors []error) {
-	// Cleanup after each plugin
-	for _, p := range plugins {
-		errors = append(errors, p.Cleanup(client)...)
+// advertiseHost returns the host part of the address workers are told to
+// dial, which the server's certificate must be valid for.
+func advertiseHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
 	}
+	return host
+}
 
-	return errors
+// newToken returns a random bearer token for a plugin's workers.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -17,6 +17,9 @@ limitations under the License.
 package aggregation
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -33,6 +36,16 @@ type Server struct {
 	BindAddr string
 	// ResultsCallback is the function that is called when a result is checked in.
 	ResultsCallback func(*plugin.Result, http.ResponseWriter)
+	// StatusCallback is the function called to report the progress of the
+	// run. If unset, the status API is not served.
+	StatusCallback func() *Status
+	// TLSConfig, if set, makes the server serve HTTPS. Results are then
+	// only accepted from clients presenting a certificate, verified against
+	// TLSConfig.ClientCAs, whose common name is the result type they submit.
+	TLSConfig *tls.Config
+	// Tokens, if set, maps each result type to the bearer token that must
+	// accompany its results.
+	Tokens map[string]string
 
 	stopCh  chan bool
 	readyCh chan bool
@@ -62,6 +75,10 @@ const (
 	resultsGlobal = "/api/v1/results/global/"
 )
 
+// StatusPath is the HTTP path under which the progress of the run can be
+// read, either in full or for a single plugin (eg. /api/v1/status/e2e)
+const StatusPath = "/api/v1/status"
+
 // Stop stops a running Server
 func (s *Server) Stop() {
 	s.stopCh <- true
@@ -87,6 +104,10 @@ func (s *Server) Start() error {
 	mux.Handle(resultsGlobal, http.StripPrefix(resultsGlobal, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		s.globalResultsHandler(w, r)
 	})))
+	if s.StatusCallback != nil {
+		mux.Handle(StatusPath, http.StripPrefix(StatusPath, http.HandlerFunc(s.statusHandler)))
+		mux.Handle(StatusPath+"/", http.StripPrefix(StatusPath+"/", http.HandlerFunc(s.statusHandler)))
+	}
 	srv := &http.Server{
 		Addr:    s.BindAddr,
 		Handler: mux,
@@ -97,6 +118,9 @@ func (s *Server) Start() error {
 	if err != nil {
 		return fmt.Errorf("could not listen on %v: %v", s.BindAddr, err)
 	}
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
 	defer l.Close()
 
 	glog.Infof("Listening for incoming results on %v\n", s.BindAddr)
@@ -156,6 +180,9 @@ func (s *Server) nodeResultsHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse the path into the node name, result type, and extension
 	node, file := parts[0], parts[1]
 	resultType, extension := parseFileName(file)
+	if !s.authorize(w, r, resultType) {
+		return
+	}
 
 	glog.Infof("got %v result from %v\n", resultType, node)
 
@@ -200,6 +227,9 @@ func (s *Server) globalResultsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resultType, extension := parseFileName(parts[0])
+	if !s.authorize(w, r, resultType) {
+		return
+	}
 	glog.Infof("got %v result\n", resultType)
 
 	result := &plugin.Result{
@@ -216,6 +246,81 @@ func (s *Server) globalResultsHandler(w http.ResponseWriter, r *http.Request) {
 	r.Body.Close()
 }
 
+// authorize checks that the request came with the credentials of the plugin
+// that owns resultType: a verified client certificate issued to it if TLS is
+// enabled, and its bearer token if Tokens is set. If not, an error is returned
+// to the client and authorize returns false.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, resultType string) bool {
+	if s.Tokens != nil {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		expected, ok := s.Tokens[resultType]
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			glog.Warningf("Rejecting %v result from %v: invalid token", resultType, r.RemoteAddr)
+			http.Error(w, "A valid token is required to submit results", http.StatusUnauthorized)
+			return false
+		}
+	}
+
+	if s.TLSConfig == nil {
+		return true
+	}
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		glog.Warningf("Rejecting %v result from %v: no client certificate", resultType, r.RemoteAddr)
+		http.Error(w, "A client certificate is required to submit results", http.StatusUnauthorized)
+		return false
+	}
+	if name := r.TLS.VerifiedChains[0][0].Subject.CommonName; name != resultType {
+		glog.Warningf("Rejecting %v result from %v: certificate was issued to %v", resultType, r.RemoteAddr, name)
+		http.Error(
+			w,
+			fmt.Sprintf("Certificate for %v may not submit %v results", name, resultType),
+			http.StatusForbidden,
+		)
+		return false
+	}
+	return true
+}
+
+// statusHandler serves the progress of the run as JSON. The path must be
+// stripped of the /api/v1/status/ prefix, leaving either nothing (for the
+// whole run) or :type (for a single plugin.) The only supported method is
+// GET.
+//
+// Example: GET node1.cluster.local/api/v1/status/systemd_logs
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(
+			w,
+			fmt.Sprintf("Unsupported method %s.  Supported methods are: %v", r.Method, http.MethodGet),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+
+	var body interface{}
+	status := s.StatusCallback()
+	switch resultType := strings.TrimSuffix(r.URL.Path, "/"); {
+	case resultType == "":
+		body = status
+	case strings.Contains(resultType, "/"):
+		http.NotFound(w, r)
+		return
+	default:
+		plugin := status.PluginStatus(resultType)
+		if plugin == nil {
+			http.NotFound(w, r)
+			return
+		}
+		body = plugin
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		glog.Warningf("Error writing status response: %v", err)
+	}
+}
+
 // given an uploaded filename, parse it into its base name and extension.  If
 // there are no "." characters, the extension will be blank and the name will
 // be set to the filename as-is
@@ -0,0 +1,145 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+	"time"
+)
+
+// StatusFile is the file in the aggregator's OutputDir that its final Status
+// is written to, so that readers of the results know which results were
+// expected, and which failed.
+const StatusFile = "status.json"
+
+const (
+	// ResultStatusComplete is the status of a result that was received
+	ResultStatusComplete = "complete"
+	// ResultStatusFailed is the status of a result that was received, but
+	// reports that the plugin failed
+	ResultStatusFailed = "failed"
+	// ResultStatusPending is the status of a result that hasn't come in yet
+	ResultStatusPending = "pending"
+)
+
+// Status is a snapshot of the progress of the aggregator, as served by the
+// aggregation server's status API.
+type Status struct {
+	// RunID is the UUID of this sonobuoy run
+	RunID string `json:"runID"`
+	// StartTime is when aggregation started
+	StartTime time.Time `json:"startTime"`
+	// Elapsed is how long aggregation has been running, eg. "1m30s"
+	Elapsed string `json:"elapsed"`
+	// Complete is whether every expected result has been received
+	Complete bool `json:"complete"`
+	// Plugins is the progress of each plugin, sorted by result type
+	Plugins []PluginStatus `json:"plugins"`
+}
+
+// PluginStatus is the progress of a single plugin.
+type PluginStatus struct {
+	ResultType string `json:"resultType"`
+	Completed  int    `json:"completed"`
+	Failed     int    `json:"failed"`
+	Pending    int    `json:"pending"`
+	// Results are the individual expected results, sorted by node
+	Results []ResultStatus `json:"results"`
+}
+
+// ResultStatus is the status of a single expected result.
+type ResultStatus struct {
+	// NodeName is the node the result is for, or empty for global results
+	NodeName string `json:"node,omitempty"`
+	// Status is one of ResultStatusComplete, ResultStatusFailed or
+	// ResultStatusPending
+	Status string `json:"status"`
+	// Error is the reason a failed result failed
+	Error string `json:"error,omitempty"`
+}
+
+// Status returns a snapshot of which expected results have been received,
+// which failed and which are still pending.
+func (a *Aggregator) Status() *Status {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	status := &Status{
+		RunID:     a.RunID,
+		StartTime: a.startTime,
+		Elapsed:   (time.Since(a.startTime) / time.Second * time.Second).String(),
+		Complete:  true,
+	}
+
+	plugins := make(map[string]*PluginStatus)
+	for id, expected := range a.ExpectedResults {
+		p, ok := plugins[expected.ResultType]
+		if !ok {
+			p = &PluginStatus{ResultType: expected.ResultType}
+			plugins[expected.ResultType] = p
+		}
+
+		rs := ResultStatus{NodeName: expected.NodeName, Status: ResultStatusPending}
+		if result, ok := a.Results[id]; !ok {
+			p.Pending++
+			status.Complete = false
+		} else if !result.IsSuccess() {
+			rs.Status = ResultStatusFailed
+			rs.Error = result.Error
+			p.Failed++
+		} else {
+			rs.Status = ResultStatusComplete
+			p.Completed++
+		}
+		p.Results = append(p.Results, rs)
+	}
+
+	for _, p := range plugins {
+		sort.Slice(p.Results, func(i, j int) bool {
+			return p.Results[i].NodeName < p.Results[j].NodeName
+		})
+		status.Plugins = append(status.Plugins, *p)
+	}
+	sort.Slice(status.Plugins, func(i, j int) bool {
+		return status.Plugins[i].ResultType < status.Plugins[j].ResultType
+	})
+
+	return status
+}
+
+// WriteStatus writes the aggregator's Status to StatusFile in its OutputDir.
+func (a *Aggregator) WriteStatus() error {
+	blob, err := json.Marshal(a.Status())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(a.OutputDir, StatusFile), blob, 0644)
+}
+
+// PluginStatus returns the status of the plugin with the given result type,
+// or nil if there is no such plugin.
+func (s *Status) PluginStatus(resultType string) *PluginStatus {
+	for i := range s.Plugins {
+		if s.Plugins[i].ResultType == resultType {
+			return &s.Plugins[i]
+		}
+	}
+	return nil
+}
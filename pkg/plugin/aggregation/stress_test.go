@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"strconv"
 	"testing"
@@ -92,7 +93,7 @@ func sendResults(t *testing.T, n int) {
 	for i := 0; i < n; i++ {
 		go func(i int) {
 			url := "http://" + bindAddr + "/api/v1/results/by-node/node" + strconv.Itoa(i) + "/fake"
-			err := worker.DoRequest(url, func() (io.Reader, error) {
+			err := worker.DoRequest(url, http.DefaultClient, "", func() (io.Reader, error) {
 				return bytes.NewReader([]byte("hello")), nil
 			})
 			if err != nil {
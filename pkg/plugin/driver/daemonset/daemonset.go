@@ -17,6 +17,7 @@ limitations under the License.
 package daemonset
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"strings"
@@ -28,6 +29,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	v1beta1ext "k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/kubernetes"
 )
@@ -41,36 +43,62 @@ type Plugin struct {
 	Namespace  string
 	UUID       gouuid.UUID
 	ResultType string
-
-	cleanedUp bool
+	Timeout    time.Duration
+	DependsOn  []string
+	Phase      int
+	// TaintPolicy is how tainted nodes are treated, see
+	// plugin.Definition.TaintPolicy
+	TaintPolicy string
 }
 
+// schedulingCheckInterval is how often Monitor checks for nodes the
+// DaemonSet's pods haven't been scheduled on.
+const schedulingCheckInterval = 10 * time.Second
+
 // Ensure DaemonSetPlugin implements plugin.Interface
 var _ plugin.Interface = &Plugin{}
 
 // NewPlugin creates a new DaemonSet plugin from the given Plugin Definition
 // and sonobuoy master address
 func NewPlugin(namespace string, dfn plugin.Definition, cfg *plugin.WorkerConfig) *Plugin {
+	utils.ApplyNodeSelection(&dfn.PodSpec, dfn.NodeSelector, dfn.TaintPolicy)
+
 	return &Plugin{
-		Name:       dfn.Name,
-		UUID:       gouuid.NewV4(),
-		ResultType: dfn.ResultType,
-		PodSpec:    &dfn.PodSpec,
-		Namespace:  namespace,
-		Config:     cfg,
+		Name:        dfn.Name,
+		UUID:        gouuid.NewV4(),
+		ResultType:  dfn.ResultType,
+		PodSpec:     &dfn.PodSpec,
+		Namespace:   namespace,
+		Config:      cfg,
+		Timeout:     time.Duration(dfn.TimeoutSeconds) * time.Second,
+		DependsOn:   dfn.DependsOn,
+		Phase:       dfn.Phase,
+		TaintPolicy: dfn.TaintPolicy,
 	}
 }
 
+// selectNodes returns the nodes out of the given ones that the DaemonSet will
+// run on, and so which results are expected from.
+func (p *Plugin) selectNodes(nodes []v1.Node) []v1.Node {
+	return utils.SelectNodes(nodes, p.PodSpec, p.TaintPolicy)
+}
+
 func (p *Plugin) configMapName() string {
 	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-config-" + p.GetSessionID()
 }
 
+func (p *Plugin) secretName() string {
+	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-credentials-" + p.GetSessionID()
+}
+
 func (p *Plugin) daemonSetName() string {
 	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-daemonset-" + p.GetSessionID()
 }
 
-// ExpectedResults returns the list of results expected for this daemonset
+// ExpectedResults returns the list of results expected for this daemonset,
+// one from each node it runs on.
 func (p *Plugin) ExpectedResults(nodes []v1.Node) []plugin.ExpectedResult {
+	nodes = p.selectNodes(nodes)
 	ret := make([]plugin.ExpectedResult, 0, len(nodes))
 
 	for _, node := range nodes {
@@ -89,13 +117,8 @@ func (p *Plugin) GetResultType() string {
 }
 
 // Run dispatches worker pods according to the DaemonSet's configuration.
-func (p *Plugin) Run(kubeclient kubernetes.Interface) error {
-	var err error
-	configMap, err := p.buildConfigMap()
-	if err != nil {
-		return err
-	}
-	daemonSet, err := p.buildDaemonSet()
+func (p *Plugin) Run(kubeclient kubernetes.Interface, _ []v1.Node, creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) error {
+	configMap, secret, daemonSet, err := p.build(creds, owner)
 	if err != nil {
 		return err
 	}
@@ -104,6 +127,9 @@ func (p *Plugin) Run(kubeclient kubernetes.Interface) error {
 	if _, err = kubeclient.CoreV1().ConfigMaps(p.Namespace).Create(configMap); err != nil {
 		return fmt.Errorf("could not create configMap for worker daemonset: %v", err)
 	}
+	if _, err = kubeclient.CoreV1().Secrets(p.Namespace).Create(secret); err != nil {
+		return fmt.Errorf("could not create credentials Secret for worker daemonset: %v", err)
+	}
 	if _, err = kubeclient.ExtensionsV1beta1().DaemonSets(p.Namespace).Create(daemonSet); err != nil {
 		return fmt.Errorf("could not create DaemonSet for sonobuoy plugin %v: %v", p.Name, err)
 	}
@@ -111,9 +137,37 @@ func (p *Plugin) Run(kubeclient kubernetes.Interface) error {
 	return nil
 }
 
-// Cleanup cleans up the k8s DaemonSet and ConfigMap created by this plugin instance
+// Resources returns the ConfigMap, Secret and DaemonSet Run would create.
+func (p *Plugin) Resources(_ []v1.Node, creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) ([]runtime.Object, error) {
+	configMap, secret, daemonSet, err := p.build(creds, owner)
+	if err != nil {
+		return nil, err
+	}
+	return []runtime.Object{configMap, secret, daemonSet}, nil
+}
+
+// build builds the ConfigMap holding the worker config, the Secret holding
+// the worker credentials and the DaemonSet running the workers, owned by
+// owner.
+func (p *Plugin) build(creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) (*v1.ConfigMap, *v1.Secret, *v1beta1ext.DaemonSet, error) {
+	configMap, err := p.buildConfigMap()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	secret := utils.BuildCredentialsSecret(p, p.Namespace, p.secretName(), creds)
+	daemonSet, err := p.buildDaemonSet()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	configMap.OwnerReferences = utils.OwnerReferences(owner)
+	secret.OwnerReferences = utils.OwnerReferences(owner)
+	daemonSet.OwnerReferences = utils.OwnerReferences(owner)
+	return configMap, secret, daemonSet, nil
+}
+
+// Cleanup cleans up the k8s DaemonSet, ConfigMap and Secret created by this
+// plugin instance
 func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) []error {
-	p.cleanedUp = true
 	var errors []error
 	gracePeriod := int64(1)
 	deletionPolicy := metav1.DeletePropagationBackground
@@ -142,12 +196,21 @@ func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) []error {
 		errors = append(errors, fmt.Errorf("Error deleting configmap %v: %v", p.configMapName(), err))
 	}
 
+	// Delete the Secret created by this plugin
+	err = kubeclient.CoreV1().Secrets(p.Namespace).DeleteCollection(
+		&deleteOptions,
+		listOptions,
+	)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("Error deleting secret %v: %v", p.secretName(), err))
+	}
+
 	return errors
 }
 
 func (p *Plugin) listOptions() metav1.ListOptions {
 	return metav1.ListOptions{
-		LabelSelector: "sonobuoy-run=" + p.GetSessionID(),
+		LabelSelector: plugin.SessionLabel + "=" + p.GetSessionID(),
 	}
 }
 
@@ -167,7 +230,9 @@ func (p *Plugin) findDaemonSet(kubeclient kubernetes.Interface) (*v1beta1ext.Dae
 
 // Monitor adheres to plugin.Interface by ensuring the DaemonSet is correctly
 // configured and that each pod is running normally.
-func (p *Plugin) Monitor(kubeclient kubernetes.Interface, availableNodes []v1.Node, resultsCh chan<- *plugin.Result) {
+func (p *Plugin) Monitor(ctx context.Context, kubeclient kubernetes.Interface, availableNodes []v1.Node, pods *plugin.PodWatcher, resultsCh chan<- *plugin.Result) {
+	// Only look for pods on the nodes we expect them on
+	availableNodes = p.selectNodes(availableNodes)
 	podsReported := make(map[string]bool)
 	podsFound := make(map[string]bool, len(availableNodes))
 	for _, node := range availableNodes {
@@ -175,32 +240,30 @@ func (p *Plugin) Monitor(kubeclient kubernetes.Interface, availableNodes []v1.No
 		podsReported[node.Name] = false
 	}
 
-	for {
-		// Sleep between each poll, which should give the DaemonSet
-		// enough time to create pods
-		time.Sleep(10 * time.Second)
-		// If we've cleaned up after ourselves, stop monitoring
-		if p.cleanedUp {
-			break
-		}
-
-		// If we don't have a daemonset created, retry next time.  We
-		// only send errors if we successfully see that an expected pod
-		// is having issues.
-		ds, err := p.findDaemonSet(kubeclient)
-		if err != nil {
-			continue
-		}
-
-		// Find all the pods configured by this daemonset
-		pods, err := kubeclient.CoreV1().Pods(p.Namespace).List(p.listOptions())
-		if err != nil {
-			// Likewise, if we can't query for pods, just retry next time.
-			continue
+	changed, unsubscribe := pods.Subscribe(p.GetSessionID())
+	defer unsubscribe()
+	diagnoser := utils.NewDiagnoser(kubeclient)
+
+	// DaemonSets are a bit strange, if node taints are preventing
+	// scheduling, pods won't even be created (unlike say Jobs, which will
+	// create the pod and leave it in an unscheduled state.) So nodes
+	// without pods are checked for periodically, rather than on changes.
+	scheduleCheck := time.NewTicker(schedulingCheckInterval)
+	defer scheduleCheck.Stop()
+
+	report := func(result *plugin.Result) bool {
+		select {
+		case resultsCh <- result:
+			return true
+		case <-ctx.Done():
+			return false
 		}
+	}
 
-		// Cycle through each pod in this daemonset, reporting any failures.
-		for _, pod := range pods.Items {
+	// checkPods cycles through each pod in this daemonset, reporting any
+	// failures.
+	checkPods := func() bool {
+		for _, pod := range pods.Pods(p.GetSessionID()) {
 			nodeName := pod.Spec.NodeName
 			// We don't care about nodes we already saw
 			if podsReported[nodeName] {
@@ -210,32 +273,53 @@ func (p *Plugin) Monitor(kubeclient kubernetes.Interface, availableNodes []v1.No
 			podsFound[nodeName] = true
 
 			// Check if it's failing and submit the error result
-			if isFailing, reason := utils.IsPodFailing(&pod); isFailing {
+			if failure := diagnoser.Diagnose(&pod); failure != nil {
 				podsReported[nodeName] = true
 
-				resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
-					"error": reason,
-					"pod":   pod,
-				}, nodeName)
+				if !report(utils.MakePodErrorResult(p.GetResultType(), &pod, failure, nodeName)) {
+					return false
+				}
 			}
 		}
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			if !checkPods() {
+				return
+			}
+		case <-scheduleCheck.C:
+			// If we don't have a daemonset created, retry next time.  We
+			// only send errors if we successfully see that an expected pod
+			// is having issues.
+			ds, err := p.findDaemonSet(kubeclient)
+			if err != nil {
+				continue
+			}
+			if !checkPods() {
+				return
+			}
 
-		// DaemonSets are a bit strange, if node taints are preventing
-		// scheduling, pods won't even be created (unlike say Jobs,
-		// which will create the pod and leave it in an unscheduled
-		// state.)  So take any nodes we didn't see pods on, and report
-		// issues scheduling them.
-		for _, node := range availableNodes {
-			if !podsFound[node.Name] && !podsReported[node.Name] {
-				podsReported[node.Name] = true
-				resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
-					"error": fmt.Sprintf(
-						"No pod was scheduled on node %v within %v. Check tolerations for plugin %v",
-						node.Name,
-						time.Now().Sub(ds.CreationTimestamp.Time),
-						p.Name,
-					),
-				}, node.Name)
+			// Take any nodes we didn't see pods on, and report issues
+			// scheduling them.
+			for _, node := range availableNodes {
+				if !podsFound[node.Name] && !podsReported[node.Name] {
+					podsReported[node.Name] = true
+					if !report(utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
+						"error": fmt.Sprintf(
+							"No pod was scheduled on node %v within %v. Check tolerations for plugin %v",
+							node.Name,
+							time.Now().Sub(ds.CreationTimestamp.Time),
+							p.Name,
+						),
+					}, node.Name)) {
+						return
+					}
+				}
 			}
 		}
 	}
@@ -254,16 +338,36 @@ func (p *Plugin) GetName() string {
 	return p.Name
 }
 
+// GetTimeout returns how long to wait for this plugin's results, or 0 for
+// the default.
+func (p *Plugin) GetTimeout() time.Duration {
+	return p.Timeout
+}
+
+// GetDependsOn returns the names of the plugins this one runs after
+func (p *Plugin) GetDependsOn() []string {
+	return p.DependsOn
+}
+
+// GetPhase returns the phase this plugin runs in
+func (p *Plugin) GetPhase() int {
+	return p.Phase
+}
+
 // GetPodSpec returns the pod spec for this DaemonSet
 func (p *Plugin) GetPodSpec() *v1.PodSpec {
 	return p.PodSpec
 }
 
+// buildConfigMap builds the ConfigMap holding the worker config, without the
+// credentials, which go in a Secret of their own.
 func (p *Plugin) buildConfigMap() (*v1.ConfigMap, error) {
 	// We get to build the worker config directly from our own data structures,
 	// this is where doing this natively in golang helps a lot (as opposed to
 	// shelling out to kubectl)
-	cfgjson, err := json.Marshal(p.Config)
+	cfg := *p.Config
+	cfg.WorkerCredentials = plugin.WorkerCredentials{}
+	cfgjson, err := json.Marshal(&cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -271,6 +375,7 @@ func (p *Plugin) buildConfigMap() (*v1.ConfigMap, error) {
 	cmap := &v1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
+			Kind:       "ConfigMap",
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      p.configMapName(),
@@ -286,16 +391,13 @@ func (p *Plugin) buildConfigMap() (*v1.ConfigMap, error) {
 }
 
 func (p *Plugin) buildDaemonSet() (*v1beta1ext.DaemonSet, error) {
-	// Fix up the pod spec to use this session's config map
-	for _, vol := range p.PodSpec.Volumes {
-		if vol.ConfigMap != nil && vol.ConfigMap.Name == "__SONOBUOY_CONFIGMAP__" {
-			vol.ConfigMap.Name = p.configMapName()
-		}
-	}
+	// Fix up the pod spec to use this session's config map and credentials
+	spec := utils.WorkerPodSpec(p.PodSpec, p.configMapName(), p.secretName())
 
 	ds := &v1beta1ext.DaemonSet{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "extensions/v1beta1",
+			Kind:       "DaemonSet",
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      p.daemonSetName(),
@@ -305,14 +407,14 @@ func (p *Plugin) buildDaemonSet() (*v1beta1ext.DaemonSet, error) {
 		Spec: v1beta1ext.DaemonSetSpec{
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
-					"sonobuoy-run": p.GetSessionID(),
+					plugin.SessionLabel: p.GetSessionID(),
 				},
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: utils.ApplyDefaultLabels(p, map[string]string{}),
 				},
-				Spec: *p.PodSpec,
+				Spec: *spec,
 			},
 		},
 	}
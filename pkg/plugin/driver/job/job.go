@@ -17,6 +17,7 @@ limitations under the License.
 package job
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"strings"
@@ -26,6 +27,7 @@ import (
 	"github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/kubernetes"
 
@@ -41,10 +43,15 @@ type Plugin struct {
 	Namespace  string
 	UUID       gouuid.UUID
 	ResultType string
-
-	cleanedUp bool
+	Timeout    time.Duration
+	DependsOn  []string
+	Phase      int
 }
 
+// podCreationTimeout is how long Monitor waits to see the Job's pod before
+// reporting that it wasn't created.
+const podCreationTimeout = 10 * time.Second
+
 // Ensure Plugin implements plugin.Interface
 var _ plugin.Interface = &Plugin{}
 
@@ -58,6 +65,9 @@ func NewPlugin(namespace string, dfn plugin.Definition, cfg *plugin.WorkerConfig
 		PodSpec:    &dfn.PodSpec,
 		Namespace:  namespace,
 		Config:     cfg,
+		Timeout:    time.Duration(dfn.TimeoutSeconds) * time.Second,
+		DependsOn:  dfn.DependsOn,
+		Phase:      dfn.Phase,
 	}
 }
 
@@ -65,6 +75,10 @@ func (p *Plugin) configMapName() string {
 	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-config-" + p.GetSessionID()
 }
 
+func (p *Plugin) secretName() string {
+	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-credentials-" + p.GetSessionID()
+}
+
 func (p *Plugin) jobName() string {
 	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-job-" + p.GetSessionID()
 }
@@ -83,13 +97,8 @@ func (p *Plugin) GetResultType() string {
 }
 
 // Run dispatches worker pods according to the Job's configuration.
-func (p *Plugin) Run(kubeclient kubernetes.Interface) error {
-	var err error
-	configMap, err := p.buildConfigMap()
-	if err != nil {
-		return err
-	}
-	job, err := p.buildJob()
+func (p *Plugin) Run(kubeclient kubernetes.Interface, _ []v1.Node, creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) error {
+	configMap, secret, job, err := p.build(creds, owner)
 	if err != nil {
 		return err
 	}
@@ -98,6 +107,9 @@ func (p *Plugin) Run(kubeclient kubernetes.Interface) error {
 	if _, err = kubeclient.CoreV1().ConfigMaps(p.Namespace).Create(configMap); err != nil {
 		return fmt.Errorf("could not create ConfigMap resource for Job plugin: %v", err)
 	}
+	if _, err = kubeclient.CoreV1().Secrets(p.Namespace).Create(secret); err != nil {
+		return fmt.Errorf("could not create credentials Secret for Job plugin: %v", err)
+	}
 	if _, err = kubeclient.CoreV1().Pods(p.Namespace).Create(job); err != nil {
 		return fmt.Errorf("could not create Job resource for Job plugin %v: %v", p.Name, err)
 	}
@@ -105,47 +117,90 @@ func (p *Plugin) Run(kubeclient kubernetes.Interface) error {
 	return nil
 }
 
+// Resources returns the ConfigMap, Secret and pod Run would create.
+func (p *Plugin) Resources(_ []v1.Node, creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) ([]runtime.Object, error) {
+	configMap, secret, job, err := p.build(creds, owner)
+	if err != nil {
+		return nil, err
+	}
+	return []runtime.Object{configMap, secret, job}, nil
+}
+
+// build builds the ConfigMap holding the worker config, the Secret holding
+// the worker credentials and the pod running the worker, owned by owner.
+func (p *Plugin) build(creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) (*v1.ConfigMap, *v1.Secret, *v1.Pod, error) {
+	configMap, err := p.buildConfigMap()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	secret := utils.BuildCredentialsSecret(p, p.Namespace, p.secretName(), creds)
+	job, err := p.buildJob()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	configMap.OwnerReferences = utils.OwnerReferences(owner)
+	secret.OwnerReferences = utils.OwnerReferences(owner)
+	job.OwnerReferences = utils.OwnerReferences(owner)
+	return configMap, secret, job, nil
+}
+
 // Monitor adheres to plugin.Interface by ensuring the pod created by the job
 // doesn't have any urecoverable failures.
-func (p *Plugin) Monitor(kubeclient kubernetes.Interface, _ []v1.Node, resultsCh chan<- *plugin.Result) {
-	for {
-		// Sleep between each poll, which should give the Job
-		// enough time to create a Pod
-		// TODO: maybe use a watcher instead of polling.
-		time.Sleep(10 * time.Second)
-		// If we've cleaned up after ourselves, stop monitoring
-		if p.cleanedUp {
-			break
-		}
-
-		// Make sure there's a pod
-		pod, err := p.findPod(kubeclient)
-		if err != nil {
-			resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{"error": err.Error()}, "")
-			break
+func (p *Plugin) Monitor(ctx context.Context, kubeclient kubernetes.Interface, _ []v1.Node, pods *plugin.PodWatcher, resultsCh chan<- *plugin.Result) {
+	changed, unsubscribe := pods.Subscribe(p.GetSessionID())
+	defer unsubscribe()
+	diagnoser := utils.NewDiagnoser(kubeclient)
+
+	// The pod is created before monitoring starts, so if we still haven't
+	// seen it after a while, it isn't coming.
+	podTimeout := time.After(podCreationTimeout)
+
+	// Some failures only show with time, rather than as changes to the pod
+	recheck := time.NewTicker(utils.PodCheckInterval)
+	defer recheck.Stop()
+
+	var result *plugin.Result
+	for result == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-podTimeout:
+			if len(pods.Pods(p.GetSessionID())) == 0 {
+				result = utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
+					"error": fmt.Sprintf("No pods were created by plugin %v", p.Name),
+				}, "")
+			}
+		case <-changed:
+		case <-recheck.C:
 		}
 
 		// Make sure the pod isn't failing
-		if isFailing, reason := utils.IsPodFailing(pod); isFailing {
-			resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
-				"error": reason,
-				"pod":   pod,
-			}, "")
-			break
+		if result == nil {
+			for _, pod := range pods.Pods(p.GetSessionID()) {
+				if failure := diagnoser.Diagnose(&pod); failure != nil {
+					result = utils.MakePodErrorResult(p.GetResultType(), &pod, failure, "")
+					break
+				}
+			}
 		}
 	}
+
+	select {
+	case resultsCh <- result:
+	case <-ctx.Done():
+	}
 }
 
-// Cleanup cleans up the k8s Job and ConfigMap created by this plugin instance
+// Cleanup cleans up the k8s Job, ConfigMap and Secret created by this plugin
+// instance
 func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) []error {
-	p.cleanedUp = true
 	var errors []error
 
 	gracePeriod := int64(1)
 	deletionPolicy := metav1.DeletePropagationBackground
 
 	listOptions := metav1.ListOptions{
-		LabelSelector: "sonobuoy-run=" + p.GetSessionID(),
+		LabelSelector: plugin.SessionLabel + "=" + p.GetSessionID(),
 	}
 	deleteOptions := metav1.DeleteOptions{
 		GracePeriodSeconds: &gracePeriod,
@@ -172,29 +227,16 @@ func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) []error {
 		errors = append(errors, fmt.Errorf("Error deleting configmap %v: %v", p.configMapName(), err))
 	}
 
-	return errors
-}
-
-func (p *Plugin) listOptions() metav1.ListOptions {
-	return metav1.ListOptions{
-		LabelSelector: "sonobuoy-run=" + p.GetSessionID(),
-	}
-}
-
-// findPod finds the pod created by this plugin, using a kubernetes label
-// search.  If no pod is found, or if multiple pods are found, returns an
-// error.
-func (p *Plugin) findPod(kubeclient kubernetes.Interface) (*v1.Pod, error) {
-	pods, err := kubeclient.CoreV1().Pods(p.Namespace).List(p.listOptions())
+	// Delete the Secret created by this plugin
+	err = kubeclient.CoreV1().Secrets(p.Namespace).DeleteCollection(
+		&deleteOptions,
+		listOptions,
+	)
 	if err != nil {
-		return nil, err
-	}
-
-	if len(pods.Items) != 1 {
-		return nil, fmt.Errorf("No pods were created by plugin %v", p.Name)
+		errors = append(errors, fmt.Errorf("Error deleting secret %v: %v", p.secretName(), err))
 	}
 
-	return &pods.Items[0], nil
+	return errors
 }
 
 // GetSessionID returns a unique identifier for this dispatcher, used for tagging
@@ -210,16 +252,36 @@ func (p *Plugin) GetName() string {
 	return p.Name
 }
 
+// GetTimeout returns how long to wait for this plugin's results, or 0 for
+// the default.
+func (p *Plugin) GetTimeout() time.Duration {
+	return p.Timeout
+}
+
+// GetDependsOn returns the names of the plugins this one runs after
+func (p *Plugin) GetDependsOn() []string {
+	return p.DependsOn
+}
+
+// GetPhase returns the phase this plugin runs in
+func (p *Plugin) GetPhase() int {
+	return p.Phase
+}
+
 // GetPodSpec returns the pod spec for this Job
 func (p *Plugin) GetPodSpec() *v1.PodSpec {
 	return p.PodSpec
 }
 
+// buildConfigMap builds the ConfigMap holding the worker config, without the
+// credentials, which go in a Secret of their own.
 func (p *Plugin) buildConfigMap() (*v1.ConfigMap, error) {
 	// We get to build the worker config directly from our own data structures,
 	// this is where doing this natively in golang helps a lot (as opposed to
 	// shelling out to kubectl)
-	cfgjson, err := json.Marshal(p.Config)
+	cfg := *p.Config
+	cfg.WorkerCredentials = plugin.WorkerCredentials{}
+	cfgjson, err := json.Marshal(&cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -227,6 +289,7 @@ func (p *Plugin) buildConfigMap() (*v1.ConfigMap, error) {
 	cmap := &v1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
+			Kind:       "ConfigMap",
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      p.configMapName(),
@@ -242,22 +305,22 @@ func (p *Plugin) buildConfigMap() (*v1.ConfigMap, error) {
 }
 
 func (p *Plugin) buildJob() (*v1.Pod, error) {
-	// Fix up the pod spec to use this session's config map
-	for _, vol := range p.PodSpec.Volumes {
-		if vol.ConfigMap != nil && vol.ConfigMap.Name == "__SONOBUOY_CONFIGMAP__" {
-			vol.ConfigMap.Name = p.configMapName()
-		}
-	}
+	// Fix up the pod spec to use this session's config map and credentials
+	spec := utils.WorkerPodSpec(p.PodSpec, p.configMapName(), p.secretName())
 
 	// NOTE: We're actually only constructing a pod with Never restart policy
 	// b/c K8s.Job semantics are broken.
 	job := &v1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      p.jobName(),
 			Labels:    utils.ApplyDefaultLabels(p, map[string]string{}),
 			Namespace: p.Namespace,
 		},
-		Spec: *p.PodSpec,
+		Spec: *spec,
 	}
 
 	return job, nil
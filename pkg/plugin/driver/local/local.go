@@ -0,0 +1,391 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
+	gouuid "github.com/satori/go.uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Collector is a plugin implemented in Go, run by the Local driver. It's
+// given the plugin's worker config and the output directory of the run, and
+// returns its result along with the result's file extension (e.g. ".json".)
+type Collector func(cfg *plugin.WorkerConfig, outdir string) (result io.Reader, extension string, err error)
+
+var (
+	collectorsMutex sync.Mutex
+	collectors      = make(map[string]Collector)
+)
+
+// RegisterCollector makes a Collector available to plugin definitions by
+// name. It panics if a collector is registered twice under the same name.
+func RegisterCollector(name string, collector Collector) {
+	collectorsMutex.Lock()
+	defer collectorsMutex.Unlock()
+
+	if _, ok := collectors[name]; ok {
+		panic("local: RegisterCollector called twice for collector " + name)
+	}
+	collectors[name] = collector
+}
+
+func getCollector(name string) (Collector, bool) {
+	collectorsMutex.Lock()
+	defer collectorsMutex.Unlock()
+
+	collector, ok := collectors[name]
+	return collector, ok
+}
+
+// logTailLines is how many lines of a failed command's output are included
+// in its error result.
+const logTailLines = 20
+
+// killWait is how long Cleanup waits for a killed command to exit, before
+// leaving it behind.
+const killWait = 10 * time.Second
+
+// Plugin is a plugin driver that runs a command, or a registered Collector,
+// inside the master itself, rather than in a pod.
+//
+// Commands follow the same contract as the containers of other plugins:
+// they write their result into $RESULTS_DIR, and then the path of the result
+// to $RESULTS_DIR/done. They're also given the output directory of the run,
+// as $SONOBUOY_OUTPUT_DIR, and the path of their worker config, as
+// $SONOBUOY_WORKER_CONFIG.
+type Plugin struct {
+	Name       string
+	Command    []string
+	Collector  string
+	Config     *plugin.WorkerConfig `json:"config"`
+	OutputDir  string
+	UUID       gouuid.UUID
+	ResultType string
+	Timeout    time.Duration
+	DependsOn  []string
+	Phase      int
+
+	// tmpDir holds the plugin's worker config and results dir while it runs
+	tmpDir string
+	// cmd is the running command, if the plugin runs one
+	cmd *exec.Cmd
+	// result receives the plugin's result once it has finished
+	result chan *plugin.Result
+	// finished is closed once the command or collector has returned
+	finished chan struct{}
+}
+
+// Ensure Plugin implements plugin.Interface
+var _ plugin.Interface = &Plugin{}
+
+// NewPlugin creates a new Local plugin from the given Plugin Definition,
+// which runs with the given output directory of the sonobuoy run.
+func NewPlugin(dfn plugin.Definition, cfg *plugin.WorkerConfig, outdir string) (*Plugin, error) {
+	switch {
+	case len(dfn.Command) == 0 && dfn.Collector == "":
+		return nil, fmt.Errorf("Local plugin %v needs a command or a collector", dfn.Name)
+	case len(dfn.Command) > 0 && dfn.Collector != "":
+		return nil, fmt.Errorf("Local plugin %v can't have both a command and a collector", dfn.Name)
+	}
+	if dfn.Collector != "" {
+		if _, ok := getCollector(dfn.Collector); !ok {
+			return nil, fmt.Errorf("Unknown collector %v for Local plugin %v", dfn.Collector, dfn.Name)
+		}
+	}
+
+	return &Plugin{
+		Name:       dfn.Name,
+		Command:    dfn.Command,
+		Collector:  dfn.Collector,
+		UUID:       gouuid.NewV4(),
+		ResultType: dfn.ResultType,
+		Config:     cfg,
+		OutputDir:  outdir,
+		Timeout:    time.Duration(dfn.TimeoutSeconds) * time.Second,
+		DependsOn:  dfn.DependsOn,
+		Phase:      dfn.Phase,
+	}, nil
+}
+
+// ExpectedResults returns the list of results expected for this plugin. Like
+// a Job, it only gives one result.
+func (p *Plugin) ExpectedResults(nodes []v1.Node) []plugin.ExpectedResult {
+	return []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: p.ResultType},
+	}
+}
+
+// GetResultType returns the ResultType for this plugin (to adhere to plugin.Interface)
+func (p *Plugin) GetResultType() string {
+	return p.ResultType
+}
+
+// Run starts the plugin's command or collector, without waiting for it to
+// finish. Local plugins don't talk to the master over HTTP or create any
+// resources, so the credentials and owner are ignored.
+func (p *Plugin) Run(kubeclient kubernetes.Interface, _ []v1.Node, creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) error {
+	var err error
+	p.tmpDir, err = ioutil.TempDir("", "sonobuoy-"+strings.Replace(p.Name, "_", "-", -1)+"-")
+	if err != nil {
+		return fmt.Errorf("could not create directory for Local plugin %v: %v", p.Name, err)
+	}
+
+	cfg := *p.Config
+	cfg.ResultsDir = path.Join(p.tmpDir, "results")
+	if err = os.Mkdir(cfg.ResultsDir, 0755); err != nil {
+		return fmt.Errorf("could not create results directory for Local plugin %v: %v", p.Name, err)
+	}
+	cfgjson, err := json.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	cfgFile := path.Join(p.tmpDir, "worker.json")
+	if err = ioutil.WriteFile(cfgFile, cfgjson, 0644); err != nil {
+		return fmt.Errorf("could not write config for Local plugin %v: %v", p.Name, err)
+	}
+
+	p.result = make(chan *plugin.Result, 1)
+	p.finished = make(chan struct{})
+
+	if p.Collector != "" {
+		collector, _ := getCollector(p.Collector)
+		go func() {
+			defer close(p.finished)
+			p.result <- p.collectorResult(collector, &cfg)
+		}()
+		return nil
+	}
+
+	var output bytes.Buffer
+	p.cmd = exec.Command(p.Command[0], p.Command[1:]...)
+	p.cmd.Env = append(os.Environ(),
+		"RESULTS_DIR="+cfg.ResultsDir,
+		"SONOBUOY_OUTPUT_DIR="+p.OutputDir,
+		"SONOBUOY_WORKER_CONFIG="+cfgFile,
+	)
+	p.cmd.Dir = p.tmpDir
+	p.cmd.Stdout = &output
+	p.cmd.Stderr = &output
+	setProcessGroup(p.cmd)
+	if err = p.cmd.Start(); err != nil {
+		return fmt.Errorf("could not start command for Local plugin %v: %v", p.Name, err)
+	}
+
+	go func() {
+		defer close(p.finished)
+		err := p.cmd.Wait()
+		p.result <- p.commandResult(err, cfg.ResultsDir, output.Bytes())
+	}()
+	return nil
+}
+
+// Resources returns nothing, since Local plugins run in the master rather than
+// creating any resources.
+func (p *Plugin) Resources(_ []v1.Node, _ *plugin.WorkerCredentials, _ *metav1.OwnerReference) ([]runtime.Object, error) {
+	return nil, nil
+}
+
+// collectorResult runs the collector, turning what it returns into the
+// plugin's result.
+func (p *Plugin) collectorResult(collector Collector, cfg *plugin.WorkerConfig) *plugin.Result {
+	body, extension, err := collector(cfg, p.OutputDir)
+	if err != nil {
+		return utils.MakeErrorResult(p.ResultType, map[string]interface{}{
+			"error": fmt.Sprintf("Collector %v failed: %v", p.Collector, err),
+		}, "")
+	}
+
+	return &plugin.Result{
+		ResultType: p.ResultType,
+		Extension:  extension,
+		Body:       body,
+	}
+}
+
+// commandResult reads the result the command left in resultsDir, once it has
+// exited, or describes why there isn't one. The command's output is saved
+// with the plugin's logs.
+func (p *Plugin) commandResult(waitErr error, resultsDir string, output []byte) *plugin.Result {
+	logsDir := path.Join(p.OutputDir, "plugins", p.ResultType, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		glog.Warningf("Could not create logs directory for plugin %v: %v", p.Name, err)
+	} else if err := ioutil.WriteFile(path.Join(logsDir, "output.txt"), output, 0644); err != nil {
+		glog.Warningf("Could not save output of plugin %v: %v", p.Name, err)
+	}
+
+	fail := func(msg string) *plugin.Result {
+		return utils.MakeErrorResult(p.ResultType, map[string]interface{}{
+			"error":   msg,
+			"logTail": tail(output, logTailLines),
+		}, "")
+	}
+
+	if waitErr != nil {
+		return fail(fmt.Sprintf("Command %v failed: %v", p.Command, waitErr))
+	}
+
+	// Like the worker, expect a done file with the path of the result
+	resultsFile, err := ioutil.ReadFile(path.Join(resultsDir, "done"))
+	if err != nil {
+		return fail(fmt.Sprintf("Command %v exited without writing %v: %v", p.Command, path.Join(resultsDir, "done"), err))
+	}
+	filename := strings.TrimSpace(string(resultsFile))
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fail(fmt.Sprintf("Could not read result of command %v: %v", p.Command, err))
+	}
+
+	extension := ""
+	if parts := strings.SplitN(path.Base(filename), ".", 2); len(parts) == 2 {
+		extension = "." + parts[1]
+	}
+
+	return &plugin.Result{
+		ResultType: p.ResultType,
+		Extension:  extension,
+		Body:       bytes.NewReader(body),
+	}
+}
+
+// tail returns the last n lines of output.
+func tail(output []byte, n int) []string {
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// Monitor adheres to plugin.Interface by waiting for the command or
+// collector to finish and submitting its result, which also reports it if it
+// fails.
+func (p *Plugin) Monitor(ctx context.Context, kubeclient kubernetes.Interface, _ []v1.Node, _ *plugin.PodWatcher, resultsCh chan<- *plugin.Result) {
+	// If Run failed, its error is already reported
+	if p.result == nil {
+		return
+	}
+
+	select {
+	case result := <-p.result:
+		select {
+		case resultsCh <- result:
+		case <-ctx.Done():
+		}
+	case <-ctx.Done():
+	}
+}
+
+// Cleanup stops the plugin's command, if it's still running, and removes its
+// working files.
+func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) []error {
+	var errors []error
+
+	finished := p.finished == nil
+	if !finished {
+		select {
+		case <-p.finished:
+			finished = true
+		default:
+		}
+	}
+	if !finished && p.cmd != nil && p.cmd.Process != nil {
+		if err := killProcessGroup(p.cmd); err != nil {
+			errors = append(errors, fmt.Errorf("Error killing command of plugin %v: %v", p.Name, err))
+		}
+		select {
+		case <-p.finished:
+			finished = true
+		case <-time.After(killWait):
+			glog.Warningf("Command of plugin %v didn't exit within %v of being killed", p.Name, killWait)
+		}
+	}
+
+	if p.tmpDir == "" {
+		return errors
+	}
+	if !finished {
+		// A collector can't be stopped, and a command may outlive being
+		// killed, so the directory they write to is only removed once they
+		// finish.
+		go func(dir string, finished <-chan struct{}) {
+			<-finished
+			if err := os.RemoveAll(dir); err != nil {
+				glog.Warningf("Error removing directory %v: %v", dir, err)
+			}
+		}(p.tmpDir, p.finished)
+		return errors
+	}
+	if err := os.RemoveAll(p.tmpDir); err != nil {
+		errors = append(errors, fmt.Errorf("Error removing directory %v: %v", p.tmpDir, err))
+	}
+
+	return errors
+}
+
+// GetSessionID returns a unique identifier for this dispatcher, used for tagging
+// objects and cleaning them up later
+func (p *Plugin) GetSessionID() string {
+	ret := make([]byte, hex.EncodedLen(8))
+	hex.Encode(ret, p.UUID.Bytes()[0:8])
+	return string(ret)
+}
+
+// GetName returns the name of this Local plugin
+func (p *Plugin) GetName() string {
+	return p.Name
+}
+
+// GetTimeout returns how long to wait for this plugin's results, or 0 for
+// the default.
+func (p *Plugin) GetTimeout() time.Duration {
+	return p.Timeout
+}
+
+// GetDependsOn returns the names of the plugins this one runs after
+func (p *Plugin) GetDependsOn() []string {
+	return p.DependsOn
+}
+
+// GetPhase returns the phase this plugin runs in
+func (p *Plugin) GetPhase() int {
+	return p.Phase
+}
+
+// GetPodSpec returns an empty pod spec, since Local plugins don't run in pods
+func (p *Plugin) GetPodSpec() *v1.PodSpec {
+	return &v1.PodSpec{}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+// runPlugin runs a Local plugin to completion and returns its result.
+func runPlugin(t *testing.T, dfn plugin.Definition) (*plugin.Result, string) {
+	outdir, err := ioutil.TempDir("", "sonobuoy-local-test")
+	if err != nil {
+		t.Fatalf("couldn't create output dir: %v", err)
+	}
+
+	dfn.Name = "local_test"
+	dfn.ResultType = "local_test"
+	p, err := NewPlugin(dfn, &plugin.WorkerConfig{ResultType: dfn.ResultType}, outdir)
+	if err != nil {
+		t.Fatalf("couldn't create plugin: %v", err)
+	}
+
+	if err = p.Run(nil, nil, nil, nil); err != nil {
+		t.Fatalf("couldn't run plugin: %v", err)
+	}
+	resultsCh := make(chan *plugin.Result, 1)
+	p.Monitor(context.Background(), nil, nil, nil, resultsCh)
+	if errs := p.Cleanup(nil); len(errs) > 0 {
+		t.Errorf("unexpected errors cleaning up: %v", errs)
+	}
+	if _, err = os.Stat(p.tmpDir); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed, got %v", p.tmpDir, err)
+	}
+
+	return <-resultsCh, outdir
+}
+
+func readBody(t *testing.T, result *plugin.Result) string {
+	body, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		t.Fatalf("couldn't read result: %v", err)
+	}
+	return string(body)
+}
+
+func TestRun_command(t *testing.T) {
+	result, outdir := runPlugin(t, plugin.Definition{
+		Command: []string{"sh", "-c", `echo running; echo -n "$SONOBUOY_OUTPUT_DIR" > $RESULTS_DIR/out.json; echo $RESULTS_DIR/out.json > $RESULTS_DIR/done`},
+	})
+	defer os.RemoveAll(outdir)
+
+	if !result.IsSuccess() {
+		t.Fatalf("expected success, got error %v", result.Error)
+	}
+	if result.Extension != ".json" {
+		t.Errorf("expected extension .json, got %v", result.Extension)
+	}
+	if body := readBody(t, result); body != outdir {
+		t.Errorf("expected the output dir %v in the result, got %v", outdir, body)
+	}
+
+	output, err := ioutil.ReadFile(path.Join(outdir, "plugins", "local_test", "logs", "output.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the command's output: %v", err)
+	}
+	if string(output) != "running\n" {
+		t.Errorf("expected output %q, got %q", "running\n", output)
+	}
+}
+
+func TestRun_commandFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		error   string
+	}{
+		{
+			name:    "exit code",
+			command: "echo oops; exit 3",
+			error:   "exit status 3",
+		},
+		{
+			name:    "no done file",
+			command: "echo oops",
+			error:   "exited without writing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, outdir := runPlugin(t, plugin.Definition{
+				Command: []string{"sh", "-c", test.command},
+			})
+			defer os.RemoveAll(outdir)
+
+			if result.IsSuccess() {
+				t.Fatalf("expected an error result")
+			}
+			if !strings.Contains(result.Error, test.error) {
+				t.Errorf("expected error containing %q, got %q", test.error, result.Error)
+			}
+
+			var errdata struct {
+				LogTail []string `json:"logTail"`
+			}
+			if err := json.Unmarshal([]byte(readBody(t, result)), &errdata); err != nil {
+				t.Fatalf("couldn't decode error result: %v", err)
+			}
+			if len(errdata.LogTail) != 1 || errdata.LogTail[0] != "oops" {
+				t.Errorf("expected log tail [oops], got %v", errdata.LogTail)
+			}
+		})
+	}
+}
+
+func TestRun_collector(t *testing.T) {
+	RegisterCollector("test-ok", func(cfg *plugin.WorkerConfig, outdir string) (io.Reader, string, error) {
+		return bytes.NewBufferString(cfg.ResultType), ".txt", nil
+	})
+	RegisterCollector("test-fail", func(cfg *plugin.WorkerConfig, outdir string) (io.Reader, string, error) {
+		return nil, "", errors.New("oops")
+	})
+
+	result, outdir := runPlugin(t, plugin.Definition{Collector: "test-ok"})
+	defer os.RemoveAll(outdir)
+	if !result.IsSuccess() {
+		t.Fatalf("expected success, got error %v", result.Error)
+	}
+	if body := readBody(t, result); body != "local_test" || result.Extension != ".txt" {
+		t.Errorf("expected local_test.txt, got %v%v", body, result.Extension)
+	}
+
+	result, outdir = runPlugin(t, plugin.Definition{Collector: "test-fail"})
+	defer os.RemoveAll(outdir)
+	if result.IsSuccess() || !strings.Contains(result.Error, "oops") {
+		t.Errorf("expected an error containing oops, got %q", result.Error)
+	}
+}
+
+// startPlugin runs a Local plugin without waiting for it to finish.
+func startPlugin(t *testing.T, dfn plugin.Definition) (*Plugin, string) {
+	outdir, err := ioutil.TempDir("", "sonobuoy-local-test")
+	if err != nil {
+		t.Fatalf("couldn't create output dir: %v", err)
+	}
+
+	dfn.Name = "local_test"
+	dfn.ResultType = "local_test"
+	p, err := NewPlugin(dfn, &plugin.WorkerConfig{ResultType: dfn.ResultType}, outdir)
+	if err != nil {
+		t.Fatalf("couldn't create plugin: %v", err)
+	}
+	if err = p.Run(nil, nil, nil, nil); err != nil {
+		t.Fatalf("couldn't run plugin: %v", err)
+	}
+	return p, outdir
+}
+
+func TestCleanup_killsChildren(t *testing.T) {
+	// The sleep is a child of the shell, and holds on to its output
+	p, outdir := startPlugin(t, plugin.Definition{
+		Command: []string{"sh", "-c", "touch $RESULTS_DIR/started; sleep 30; echo done"},
+	})
+	defer os.RemoveAll(outdir)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path.Join(p.tmpDir, "results", "started")); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	start := time.Now()
+	if errs := p.Cleanup(nil); len(errs) > 0 {
+		t.Errorf("unexpected errors cleaning up: %v", errs)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command and its children to be killed right away, took %v", elapsed)
+	}
+	if _, err := os.Stat(p.tmpDir); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed, got %v", p.tmpDir, err)
+	}
+}
+
+func TestCleanup_runningCollector(t *testing.T) {
+	release := make(chan struct{})
+	RegisterCollector("test-blocked", func(cfg *plugin.WorkerConfig, outdir string) (io.Reader, string, error) {
+		<-release
+		return bytes.NewBufferString("late"), ".txt", nil
+	})
+
+	p, outdir := startPlugin(t, plugin.Definition{Collector: "test-blocked"})
+	defer os.RemoveAll(outdir)
+
+	if errs := p.Cleanup(nil); len(errs) > 0 {
+		t.Errorf("unexpected errors cleaning up: %v", errs)
+	}
+	if _, err := os.Stat(p.tmpDir); err != nil {
+		t.Errorf("expected %v to be kept while the collector runs, got %v", p.tmpDir, err)
+	}
+
+	close(release)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(p.tmpDir); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Errorf("expected %v to be removed once the collector finished", p.tmpDir)
+}
+
+func TestNewPlugin_invalid(t *testing.T) {
+	for _, dfn := range []plugin.Definition{
+		{},
+		{Command: []string{"true"}, Collector: "test"},
+		{Collector: "not-registered"},
+	} {
+		if _, err := NewPlugin(dfn, &plugin.WorkerConfig{}, ""); err == nil {
+			t.Errorf("expected an error for definition %+v", dfn)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import "os/exec"
+
+// setProcessGroup does nothing on Windows, which has no process groups to
+// kill.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills just the command on Windows; Cleanup doesn't wait
+// for long on any children it leaves.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,402 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podpernode
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
+	gouuid "github.com/satori/go.uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Plugin is a plugin driver that creates a pod on each node, like the
+// DaemonSet driver, but as plain pods that are left to finish instead of
+// being restarted.
+type Plugin struct {
+	Name       string
+	PodSpec    *v1.PodSpec          `json:"spec"`
+	Config     *plugin.WorkerConfig `json:"config"`
+	Namespace  string
+	UUID       gouuid.UUID
+	ResultType string
+	Timeout    time.Duration
+	DependsOn  []string
+	Phase      int
+	// TaintPolicy is how tainted nodes are treated, see
+	// plugin.Definition.TaintPolicy
+	TaintPolicy string
+
+	// createErrors are the errors creating the pods on each node, set by
+	// Run for Monitor to report.
+	createErrors map[string]error
+}
+
+// podCreationTimeout is how long Monitor waits to see the pod on each node
+// before reporting that it wasn't created.
+const podCreationTimeout = 10 * time.Second
+
+// Ensure Plugin implements plugin.Interface
+var _ plugin.Interface = &Plugin{}
+
+// NewPlugin creates a new PodPerNode plugin from the given Plugin Definition
+// and sonobuoy master address
+func NewPlugin(namespace string, dfn plugin.Definition, cfg *plugin.WorkerConfig) *Plugin {
+	utils.ApplyNodeSelection(&dfn.PodSpec, dfn.NodeSelector, dfn.TaintPolicy)
+	// The containers are meant to exit once they've submitted their results
+	dfn.PodSpec.RestartPolicy = v1.RestartPolicyNever
+
+	return &Plugin{
+		Name:        dfn.Name,
+		UUID:        gouuid.NewV4(),
+		ResultType:  dfn.ResultType,
+		PodSpec:     &dfn.PodSpec,
+		Namespace:   namespace,
+		Config:      cfg,
+		Timeout:     time.Duration(dfn.TimeoutSeconds) * time.Second,
+		DependsOn:   dfn.DependsOn,
+		Phase:       dfn.Phase,
+		TaintPolicy: dfn.TaintPolicy,
+	}
+}
+
+// selectNodes returns the nodes out of the given ones that pods are created
+// on, and so which results are expected from.
+func (p *Plugin) selectNodes(nodes []v1.Node) []v1.Node {
+	return utils.SelectNodes(nodes, p.PodSpec, p.TaintPolicy)
+}
+
+func (p *Plugin) configMapName() string {
+	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-config-" + p.GetSessionID()
+}
+
+func (p *Plugin) secretName() string {
+	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-credentials-" + p.GetSessionID()
+}
+
+// podNamePrefix is the prefix of the names of the pods, which are generated
+// since node names can be too long to go in them.
+func (p *Plugin) podNamePrefix() string {
+	return "sonobuoy-" + strings.Replace(p.Name, "_", "-", -1) + "-" + p.GetSessionID() + "-"
+}
+
+// ExpectedResults returns the list of results expected for this plugin, one
+// from each node it runs on.
+func (p *Plugin) ExpectedResults(nodes []v1.Node) []plugin.ExpectedResult {
+	nodes = p.selectNodes(nodes)
+	ret := make([]plugin.ExpectedResult, 0, len(nodes))
+
+	for _, node := range nodes {
+		ret = append(ret, plugin.ExpectedResult{
+			NodeName:   node.Name,
+			ResultType: p.ResultType,
+		})
+	}
+
+	return ret
+}
+
+// GetResultType returns the ResultType for this plugin (to adhere to plugin.Interface)
+func (p *Plugin) GetResultType() string {
+	return p.ResultType
+}
+
+// Run creates a worker pod on each of the given nodes that are selected,
+// which are the ones results are expected from. Errors creating individual
+// pods are reported by Monitor as the errors of those nodes, so the other
+// nodes can still report.
+func (p *Plugin) Run(kubeclient kubernetes.Interface, nodes []v1.Node, creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) error {
+	configMap, secret, err := p.buildConfig(creds, owner)
+	if err != nil {
+		return err
+	}
+
+	if _, err = kubeclient.CoreV1().ConfigMaps(p.Namespace).Create(configMap); err != nil {
+		return fmt.Errorf("could not create ConfigMap for PodPerNode plugin %v: %v", p.Name, err)
+	}
+	if _, err = kubeclient.CoreV1().Secrets(p.Namespace).Create(secret); err != nil {
+		return fmt.Errorf("could not create credentials Secret for PodPerNode plugin %v: %v", p.Name, err)
+	}
+
+	p.createErrors = make(map[string]error)
+	for _, node := range p.selectNodes(nodes) {
+		pod := p.buildPod(node.Name)
+		pod.OwnerReferences = utils.OwnerReferences(owner)
+		if _, err = kubeclient.CoreV1().Pods(p.Namespace).Create(pod); err != nil {
+			glog.Errorf("could not create pod for plugin %v on node %v: %v", p.Name, node.Name, err)
+			p.createErrors[node.Name] = err
+		}
+	}
+
+	return nil
+}
+
+// Resources returns the ConfigMap, Secret, and the pod for each selected
+// node, that Run would create.
+func (p *Plugin) Resources(nodes []v1.Node, creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) ([]runtime.Object, error) {
+	configMap, secret, err := p.buildConfig(creds, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := []runtime.Object{configMap, secret}
+	for _, node := range p.selectNodes(nodes) {
+		pod := p.buildPod(node.Name)
+		pod.OwnerReferences = utils.OwnerReferences(owner)
+		objs = append(objs, pod)
+	}
+	return objs, nil
+}
+
+// Monitor adheres to plugin.Interface by ensuring there's a pod on each
+// selected node, and that none of them have unrecoverable failures.
+func (p *Plugin) Monitor(ctx context.Context, kubeclient kubernetes.Interface, availableNodes []v1.Node, pods *plugin.PodWatcher, resultsCh chan<- *plugin.Result) {
+	availableNodes = p.selectNodes(availableNodes)
+	podsReported := make(map[string]bool, len(availableNodes))
+	podsFound := make(map[string]bool, len(availableNodes))
+
+	changed, unsubscribe := pods.Subscribe(p.GetSessionID())
+	defer unsubscribe()
+	diagnoser := utils.NewDiagnoser(kubeclient)
+
+	// The pods are created before monitoring starts, so if we still haven't
+	// seen one on a node after a while, it isn't coming.
+	podTimeout := time.After(podCreationTimeout)
+
+	// Some failures only show with time, rather than as changes to the pods
+	recheck := time.NewTicker(utils.PodCheckInterval)
+	defer recheck.Stop()
+
+	report := func(result *plugin.Result) bool {
+		select {
+		case resultsCh <- result:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	// checkPods reports the failures of pods on nodes that haven't been
+	// reported yet.
+	checkPods := func() bool {
+		for _, pod := range pods.Pods(p.GetSessionID()) {
+			nodeName := pod.Spec.NodeName
+			if podsReported[nodeName] {
+				continue
+			}
+
+			podsFound[nodeName] = true
+
+			if failure := diagnoser.Diagnose(&pod); failure != nil {
+				podsReported[nodeName] = true
+				if !report(utils.MakePodErrorResult(p.GetResultType(), &pod, failure, nodeName)) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	for _, node := range availableNodes {
+		if err, ok := p.createErrors[node.Name]; ok {
+			podsReported[node.Name] = true
+			if !report(utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
+				"error": fmt.Sprintf("Could not create pod for plugin %v on node %v: %v", p.Name, node.Name, err),
+			}, node.Name)) {
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			if !checkPods() {
+				return
+			}
+		case <-recheck.C:
+			if !checkPods() {
+				return
+			}
+		case <-podTimeout:
+			for _, node := range availableNodes {
+				if !podsFound[node.Name] && !podsReported[node.Name] {
+					podsReported[node.Name] = true
+					if !report(utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
+						"error": fmt.Sprintf("No pod was created for plugin %v on node %v", p.Name, node.Name),
+					}, node.Name)) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Cleanup cleans up the pods, ConfigMap and Secret created by this plugin
+// instance
+func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) []error {
+	var errors []error
+	gracePeriod := int64(1)
+	deletionPolicy := metav1.DeletePropagationBackground
+
+	listOptions := metav1.ListOptions{
+		LabelSelector: plugin.SessionLabel + "=" + p.GetSessionID(),
+	}
+	deleteOptions := metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &deletionPolicy,
+	}
+
+	// Delete the pods created by this plugin
+	err := kubeclient.CoreV1().Pods(p.Namespace).DeleteCollection(
+		&deleteOptions,
+		listOptions,
+	)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("Error deleting pods for plugin %v: %v", p.Name, err))
+	}
+
+	// Delete the ConfigMap created by this plugin
+	err = kubeclient.CoreV1().ConfigMaps(p.Namespace).DeleteCollection(
+		&deleteOptions,
+		listOptions,
+	)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("Error deleting configmap %v: %v", p.configMapName(), err))
+	}
+
+	// Delete the Secret created by this plugin
+	err = kubeclient.CoreV1().Secrets(p.Namespace).DeleteCollection(
+		&deleteOptions,
+		listOptions,
+	)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("Error deleting secret %v: %v", p.secretName(), err))
+	}
+
+	return errors
+}
+
+// GetSessionID returns a unique identifier for this dispatcher, used for tagging
+// objects and cleaning them up later
+func (p *Plugin) GetSessionID() string {
+	ret := make([]byte, hex.EncodedLen(8))
+	hex.Encode(ret, p.UUID.Bytes()[0:8])
+	return string(ret)
+}
+
+// GetName returns the name of this PodPerNode plugin
+func (p *Plugin) GetName() string {
+	return p.Name
+}
+
+// GetTimeout returns how long to wait for this plugin's results, or 0 for
+// the default.
+func (p *Plugin) GetTimeout() time.Duration {
+	return p.Timeout
+}
+
+// GetDependsOn returns the names of the plugins this one runs after
+func (p *Plugin) GetDependsOn() []string {
+	return p.DependsOn
+}
+
+// GetPhase returns the phase this plugin runs in
+func (p *Plugin) GetPhase() int {
+	return p.Phase
+}
+
+// GetPodSpec returns the pod spec for this plugin's pods
+func (p *Plugin) GetPodSpec() *v1.PodSpec {
+	return p.PodSpec
+}
+
+// buildConfig builds the ConfigMap holding the worker config and the Secret
+// holding the worker credentials, owned by owner.
+func (p *Plugin) buildConfig(creds *plugin.WorkerCredentials, owner *metav1.OwnerReference) (*v1.ConfigMap, *v1.Secret, error) {
+	configMap, err := p.buildConfigMap()
+	if err != nil {
+		return nil, nil, err
+	}
+	secret := utils.BuildCredentialsSecret(p, p.Namespace, p.secretName(), creds)
+	configMap.OwnerReferences = utils.OwnerReferences(owner)
+	secret.OwnerReferences = utils.OwnerReferences(owner)
+	return configMap, secret, nil
+}
+
+// buildConfigMap builds the ConfigMap holding the worker config, without the
+// credentials, which go in a Secret of their own.
+func (p *Plugin) buildConfigMap() (*v1.ConfigMap, error) {
+	cfg := *p.Config
+	cfg.WorkerCredentials = plugin.WorkerCredentials{}
+	cfgjson, err := json.Marshal(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cmap := &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p.configMapName(),
+			Labels:    utils.ApplyDefaultLabels(p, map[string]string{}),
+			Namespace: p.Namespace,
+		},
+		Data: map[string]string{
+			"worker.json": string(cfgjson),
+		},
+	}
+
+	return cmap, err
+}
+
+// buildPod builds the pod for the given node. It's bound to the node
+// directly, rather than going through the scheduler, so it runs there even
+// if the node is cordoned.
+func (p *Plugin) buildPod(nodeName string) *v1.Pod {
+	// Fix up the pod spec to use this session's config map and credentials
+	spec := utils.WorkerPodSpec(p.PodSpec, p.configMapName(), p.secretName())
+	spec.NodeName = nodeName
+
+	return &v1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: p.podNamePrefix(),
+			Labels:       utils.ApplyDefaultLabels(p, map[string]string{}),
+			Namespace:    p.Namespace,
+		},
+		Spec: *spec,
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podpernode
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var owner = &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "sonobuoy", UID: "master-uid"}
+
+func testNodes() []v1.Node {
+	node := func(name, role string) v1.Node {
+		return v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"role": role}}}
+	}
+	return []v1.Node{node("node1", "worker"), node("node2", "worker"), node("master1", "master")}
+}
+
+func testPlugin() *Plugin {
+	return NewPlugin("sonobuoy", plugin.Definition{
+		Name:         "node_check",
+		ResultType:   "node_check",
+		NodeSelector: map[string]string{"role": "worker"},
+		PodSpec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:         "sonobuoy-worker",
+				VolumeMounts: []v1.VolumeMount{{Name: "config", MountPath: "/etc/sonobuoy"}},
+			}},
+			Volumes: []v1.Volume{{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: "__SONOBUOY_CONFIGMAP__"},
+			}}}},
+		},
+	}, &plugin.WorkerConfig{MasterURL: "https://sonobuoy-master:8080"})
+}
+
+// newFakeClient returns a fake clientset that names created pods after their
+// GenerateName and node, as the API server would name them uniquely, and
+// fails to create the pods on the given nodes.
+func newFakeClient(failNodes ...string) *fake.Clientset {
+	kubeClient := fake.NewSimpleClientset()
+	kubeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*v1.Pod)
+		for _, node := range failNodes {
+			if pod.Spec.NodeName == node {
+				return true, nil, errors.New("quota exceeded")
+			}
+		}
+		if pod.Name == "" {
+			pod.Name = pod.GenerateName + pod.Spec.NodeName
+		}
+		return false, nil, nil
+	})
+	return kubeClient
+}
+
+func TestRun(t *testing.T) {
+	p := testPlugin()
+	kubeClient := newFakeClient()
+	nodes := testNodes()
+
+	creds := &plugin.WorkerCredentials{CACert: "ca", ClientCert: "cert", ClientKey: "key", Token: "token"}
+	if err := p.Run(kubeClient, nodes, creds, owner); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, action := range kubeClient.Actions() {
+		if action.GetResource().Resource == "nodes" {
+			t.Errorf("Expected the given nodes to be used rather than listing them again, got %v", action)
+		}
+	}
+
+	pods, err := kubeClient.CoreV1().Pods("sonobuoy").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var podNodes []string
+	for _, pod := range pods.Items {
+		podNodes = append(podNodes, pod.Spec.NodeName)
+		if pod.Labels[plugin.SessionLabel] != p.GetSessionID() {
+			t.Errorf("Expected pod %v to be labelled with the session, got %v", pod.Name, pod.Labels)
+		}
+		if len(pod.OwnerReferences) != 1 || pod.OwnerReferences[0].UID != owner.UID {
+			t.Errorf("Expected pod %v to be owned by the master, got %v", pod.Name, pod.OwnerReferences)
+		}
+		if pod.Spec.RestartPolicy != v1.RestartPolicyNever {
+			t.Errorf("Expected pod %v not to be restarted, got %v", pod.Name, pod.Spec.RestartPolicy)
+		}
+		if name := pod.Spec.Volumes[0].ConfigMap.Name; name != p.configMapName() {
+			t.Errorf("Expected pod %v to mount ConfigMap %v, got %v", pod.Name, p.configMapName(), name)
+		}
+	}
+	sort.Strings(podNodes)
+
+	var expectedNodes []string
+	for _, result := range p.ExpectedResults(nodes) {
+		expectedNodes = append(expectedNodes, result.NodeName)
+	}
+	sort.Strings(expectedNodes)
+
+	if strings.Join(podNodes, ",") != "node1,node2" || strings.Join(expectedNodes, ",") != "node1,node2" {
+		t.Errorf("Expected pods and results on the selected nodes node1 and node2, got pods on %v and results from %v", podNodes, expectedNodes)
+	}
+
+	configMap, err := kubeClient.CoreV1().ConfigMaps("sonobuoy").Get(p.configMapName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the worker ConfigMap to be created: %v", err)
+	}
+	if cfg := configMap.Data["worker.json"]; strings.Contains(cfg, "token") || !strings.Contains(cfg, "sonobuoy-master") {
+		t.Errorf("Expected the worker config without credentials, got %v", cfg)
+	}
+	secret, err := kubeClient.CoreV1().Secrets("sonobuoy").Get(p.secretName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the credentials Secret to be created: %v", err)
+	}
+	if string(secret.Data[plugin.TokenFile]) != "token" {
+		t.Errorf("Expected the token in the credentials Secret, got %v", secret.Data)
+	}
+}
+
+// monitor runs the plugin's Monitor until it has reported n results, and
+// returns them by node.
+func monitor(t *testing.T, p *Plugin, kubeClient *fake.Clientset, nodes []v1.Node, n int) map[string]*plugin.Result {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	pods := plugin.NewPodWatcher(kubeClient, p.Namespace)
+	go pods.Run(stopCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resultsCh := make(chan *plugin.Result, n)
+	go p.Monitor(ctx, kubeClient, nodes, pods, resultsCh)
+
+	results := make(map[string]*plugin.Result, n)
+	for len(results) < n {
+		select {
+		case result := <-resultsCh:
+			results[result.NodeName] = result
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %v results, got %v", n, results)
+		}
+	}
+	return results
+}
+
+func TestMonitorReportsCreateErrors(t *testing.T) {
+	p := testPlugin()
+	kubeClient := newFakeClient("node2")
+	nodes := testNodes()
+
+	if err := p.Run(kubeClient, nodes, nil, nil); err != nil {
+		t.Fatalf("Expected the other nodes' pods to be created despite the error, got %v", err)
+	}
+
+	results := monitor(t, p, kubeClient, nodes, 1)
+	result, ok := results["node2"]
+	if !ok || !strings.Contains(result.Error, "quota exceeded") {
+		t.Errorf("Expected node2's result to report the creation error, got %v", results)
+	}
+}
+
+func TestMonitorReportsFailingPods(t *testing.T) {
+	p := testPlugin()
+	kubeClient := newFakeClient()
+	nodes := testNodes()
+
+	if err := p.Run(kubeClient, nodes, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The pod on node1 can't pull its image, node2's is fine
+	failing, err := kubeClient.CoreV1().Pods("sonobuoy").Get(p.podNamePrefix()+"node1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	failing.Status = v1.PodStatus{
+		Phase: v1.PodPending,
+		ContainerStatuses: []v1.ContainerStatus{{
+			Name:  "sonobuoy-worker",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		}},
+	}
+	if _, err = kubeClient.CoreV1().Pods("sonobuoy").Update(failing); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	results := monitor(t, p, kubeClient, nodes, 1)
+	result, ok := results["node1"]
+	if !ok || result.ResultType != "node_check" || !strings.Contains(result.Error, "ImagePullBackOff") {
+		t.Errorf("Expected node1's result to report the image pull failure, got %v", results)
+	}
+}
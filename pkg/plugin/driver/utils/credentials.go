@@ -0,0 +1,118 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configMapPlaceholder is the name plugin definitions give the ConfigMap
+// holding the worker config, which is rewritten to the real one.
+const configMapPlaceholder = "__SONOBUOY_CONFIGMAP__"
+
+// credentialsVolume is the name of the volume the worker credentials are
+// mounted from.
+const credentialsVolume = "sonobuoy-credentials"
+
+// BuildCredentialsSecret builds the Secret named name holding the credentials
+// of the given plugin's workers, which are kept out of the worker config so
+// that only the pods mounting them can read them. If creds is nil, as in a
+// dry run, the Secret is empty.
+func BuildCredentialsSecret(p plugin.Interface, namespace, name string, creds *plugin.WorkerCredentials) *v1.Secret {
+	data := make(map[string][]byte)
+	if creds != nil {
+		for file, value := range map[string]string{
+			plugin.CACertFile:     creds.CACert,
+			plugin.ClientCertFile: creds.ClientCert,
+			plugin.ClientKeyFile:  creds.ClientKey,
+			plugin.TokenFile:      creds.Token,
+		} {
+			if value != "" {
+				data[file] = []byte(value)
+			}
+		}
+	}
+
+	return &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Labels:    ApplyDefaultLabels(p, map[string]string{}),
+			Namespace: namespace,
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: data,
+	}
+}
+
+// WorkerPodSpec returns a copy of the given pod spec, with the placeholder
+// worker config volume pointed at the ConfigMap named configMapName, and the
+// Secret named secretName mounted at plugin.CredentialsDir in every container
+// that mounts the worker config.
+func WorkerPodSpec(spec *v1.PodSpec, configMapName, secretName string) *v1.PodSpec {
+	ret := spec.DeepCopy()
+
+	configVolumes := make(map[string]bool)
+	for i := range ret.Volumes {
+		vol := &ret.Volumes[i]
+		if vol.ConfigMap != nil && vol.ConfigMap.Name == configMapPlaceholder {
+			vol.ConfigMap.Name = configMapName
+			configVolumes[vol.Name] = true
+		}
+	}
+	if len(configVolumes) == 0 {
+		return ret
+	}
+
+	mode := int32(0400)
+	ret.Volumes = append(ret.Volumes, v1.Volume{
+		Name: credentialsVolume,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName:  secretName,
+				DefaultMode: &mode,
+			},
+		},
+	})
+	mountCredentials(ret.InitContainers, configVolumes)
+	mountCredentials(ret.Containers, configVolumes)
+
+	return ret
+}
+
+// mountCredentials mounts the credentials volume in the given containers that
+// mount any of the given worker config volumes.
+func mountCredentials(containers []v1.Container, configVolumes map[string]bool) {
+	for i := range containers {
+		c := &containers[i]
+		for _, mount := range c.VolumeMounts {
+			if configVolumes[mount.Name] {
+				c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{
+					Name:      credentialsVolume,
+					MountPath: plugin.CredentialsDir,
+					ReadOnly:  true,
+				})
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestWorkerPodSpec(t *testing.T) {
+	spec := &v1.PodSpec{
+		Containers: []v1.Container{
+			{
+				Name:         "plugin",
+				VolumeMounts: []v1.VolumeMount{{Name: "results", MountPath: "/tmp/results"}},
+			},
+			{
+				Name: "sonobuoy-worker",
+				VolumeMounts: []v1.VolumeMount{
+					{Name: "results", MountPath: "/tmp/results"},
+					{Name: "config", MountPath: "/etc/sonobuoy"},
+				},
+			},
+		},
+		Volumes: []v1.Volume{
+			{Name: "results", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: configMapPlaceholder},
+			}}},
+		},
+	}
+
+	ret := WorkerPodSpec(spec, "config-abc", "credentials-abc")
+
+	if spec.Volumes[1].ConfigMap.Name != configMapPlaceholder || len(spec.Volumes) != 2 {
+		t.Errorf("Expected the original pod spec to be left alone, got %+v", spec.Volumes)
+	}
+	if len(ret.Volumes) != 3 {
+		t.Fatalf("Expected the credentials volume to be added, got %+v", ret.Volumes)
+	}
+	if name := ret.Volumes[1].ConfigMap.Name; name != "config-abc" {
+		t.Errorf("Expected the config volume to use config-abc, got %v", name)
+	}
+	if secret := ret.Volumes[2].Secret; secret == nil || secret.SecretName != "credentials-abc" {
+		t.Errorf("Expected the credentials volume to use credentials-abc, got %+v", ret.Volumes[2])
+	}
+
+	if mounts := ret.Containers[0].VolumeMounts; len(mounts) != 1 {
+		t.Errorf("Expected the plugin container not to mount the credentials, got %+v", mounts)
+	}
+	mounts := ret.Containers[1].VolumeMounts
+	if len(mounts) != 3 || mounts[2].Name != credentialsVolume || mounts[2].MountPath != plugin.CredentialsDir {
+		t.Errorf("Expected the worker container to mount the credentials at %v, got %+v", plugin.CredentialsDir, mounts)
+	}
+}
+
+// fakePlugin is just enough of a plugin to label its resources.
+type fakePlugin struct {
+	plugin.Interface
+}
+
+func (fakePlugin) GetSessionID() string { return "abc" }
+func (fakePlugin) GetName() string      { return "fake" }
+
+func TestBuildCredentialsSecret(t *testing.T) {
+	p := fakePlugin{}
+	secret := BuildCredentialsSecret(p, "sonobuoy", "credentials-abc", &plugin.WorkerCredentials{
+		CACert:    "ca",
+		ClientKey: "key",
+	})
+	if len(secret.Data) != 2 || string(secret.Data[plugin.CACertFile]) != "ca" || string(secret.Data[plugin.ClientKeyFile]) != "key" {
+		t.Errorf("Expected the given credentials in the secret, got %v", secret.Data)
+	}
+
+	if secret = BuildCredentialsSecret(p, "sonobuoy", "credentials-abc", nil); len(secret.Data) != 0 {
+		t.Errorf("Expected no credentials in the secret, got %v", secret.Data)
+	}
+}
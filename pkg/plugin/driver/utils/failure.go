@@ -0,0 +1,349 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Categories of pod failure, see PodFailure
+const (
+	FailureUnschedulable       = "Unschedulable"
+	FailureImagePull           = "ImagePullFailed"
+	FailureInvalidImageName    = "InvalidImageName"
+	FailureContainerConfig     = "ContainerConfigError"
+	FailureMissingVolume       = "MissingVolume"
+	FailureContainerExited     = "ContainerExited"
+	FailureCrashLoop           = "CrashLoop"
+	FailureOOMKilled           = "OOMKilled"
+	FailureInitContainerFailed = "InitContainerFailed"
+	FailureInitContainerStuck  = "InitContainerStuck"
+	FailureEvicted             = "Evicted"
+	FailureNodeLost            = "NodeLost"
+	FailurePodFailed           = "PodFailed"
+)
+
+// maxRestarts is how many times a container may restart before its pod is
+// considered to be failing.
+const maxRestarts = 2
+
+// initContainerTimeout is how long an init container may run before its pod
+// is considered to be stuck.
+const initContainerTimeout = 15 * time.Minute
+
+// PodCheckInterval is how often plugin drivers check their pods for failures
+// that don't show up as changes to the pods, like a stuck init container.
+const PodCheckInterval = 10 * time.Second
+
+// diagnosisTTL is how long a Diagnoser reuses the diagnosis of a pod that
+// hasn't changed, since the ConfigMaps and Secrets it mounts might have.
+const diagnosisTTL = time.Minute
+
+// logTailLines is how many lines of a failed container's log are included
+// in a PodFailure.
+const logTailLines = 20
+
+// PodFailure is a structured description of why a plugin's pod is failing,
+// and is written out with the error result for the pod.
+type PodFailure struct {
+	// Category is one of the Failure* constants
+	Category string `json:"category"`
+	// Container is the name of the container that failed, if the failure
+	// is specific to one
+	Container string `json:"container,omitempty"`
+	// ExitCode is the exit code of the container, if it terminated
+	ExitCode int32 `json:"exitCode,omitempty"`
+	// Message is a human readable description of the failure
+	Message string `json:"message"`
+	// LogTail is the last lines of the container's log
+	LogTail []string `json:"logTail,omitempty"`
+
+	// previous is whether the container's logs are from its previous
+	// instance, since it has restarted
+	previous bool
+}
+
+// IsPodFailing returns whether a plugin's pod is failing and isn't likely to
+// succeed, and if so, why. It only looks at the pod's status, see DiagnosePod
+// for a more thorough check.
+func IsPodFailing(pod *v1.Pod) (bool, *PodFailure) {
+	switch pod.Status.Reason {
+	case "Evicted":
+		return true, &PodFailure{
+			Category: FailureEvicted,
+			Message:  fmt.Sprintf("Pod was evicted: %v", pod.Status.Message),
+		}
+	case "NodeLost":
+		return true, &PodFailure{
+			Category: FailureNodeLost,
+			Message:  fmt.Sprintf("Node %v running the pod was lost: %v", pod.Spec.NodeName, pod.Status.Message),
+		}
+	}
+
+	// Check if the pod is unschedulable
+	for _, cond := range pod.Status.Conditions {
+		if cond.Reason == "Unschedulable" {
+			return true, &PodFailure{
+				Category: FailureUnschedulable,
+				Message:  fmt.Sprintf("Can't schedule pod: %v", cond.Message),
+			}
+		}
+	}
+
+	for _, cstatus := range pod.Status.InitContainerStatuses {
+		if failure := containerFailure(pod, cstatus, true); failure != nil {
+			return true, failure
+		}
+	}
+	for _, cstatus := range pod.Status.ContainerStatuses {
+		if failure := containerFailure(pod, cstatus, false); failure != nil {
+			return true, failure
+		}
+	}
+
+	if pod.Status.Phase == v1.PodFailed {
+		return true, &PodFailure{
+			Category: FailurePodFailed,
+			Message:  fmt.Sprintf("Pod failed: %v %v", pod.Status.Reason, pod.Status.Message),
+		}
+	}
+
+	return false, nil
+}
+
+// containerFailure classifies the failure of a single (init) container, or
+// returns nil if it isn't failing.
+func containerFailure(pod *v1.Pod, cstatus v1.ContainerStatus, init bool) *PodFailure {
+	kind := "Container"
+	if init {
+		kind = "Init container"
+	}
+
+	// Check if it can't start
+	if waiting := cstatus.State.Waiting; waiting != nil {
+		category := ""
+		switch waiting.Reason {
+		case "ImagePullBackOff", "ErrImagePull", "ErrImageNeverPull", "RegistryUnavailable":
+			category = FailureImagePull
+		case "InvalidImageName":
+			category = FailureInvalidImageName
+		case "CreateContainerConfigError", "CreateContainerError", "RunContainerError":
+			category = FailureContainerConfig
+		}
+		if category != "" {
+			return &PodFailure{
+				Category:  category,
+				Container: cstatus.Name,
+				Message:   fmt.Sprintf("%v %v is in state %v: %v", kind, cstatus.Name, waiting.Reason, waiting.Message),
+			}
+		}
+	}
+
+	// Init containers are meant to finish, and the pod's other containers
+	// can't start until they do
+	if running := cstatus.State.Running; init && running != nil {
+		if time.Since(running.StartedAt.Time) > initContainerTimeout {
+			return &PodFailure{
+				Category:  FailureInitContainerStuck,
+				Container: cstatus.Name,
+				Message:   fmt.Sprintf("%v %v has been running for longer than %v", kind, cstatus.Name, initContainerTimeout),
+			}
+		}
+	}
+
+	// A container that won't be restarted has failed as soon as it exits
+	// unsuccessfully
+	if term := cstatus.State.Terminated; term != nil && term.ExitCode != 0 && pod.Spec.RestartPolicy == v1.RestartPolicyNever {
+		failure := &PodFailure{
+			Category:  FailureContainerExited,
+			Container: cstatus.Name,
+			ExitCode:  term.ExitCode,
+			Message:   fmt.Sprintf("%v %v exited with code %v: %v %v", kind, cstatus.Name, term.ExitCode, term.Reason, term.Message),
+		}
+		switch {
+		case term.Reason == "OOMKilled":
+			failure.Category = FailureOOMKilled
+		case init:
+			failure.Category = FailureInitContainerFailed
+		}
+		return failure
+	}
+
+	// Check if the container is restarting multiple times
+	if cstatus.RestartCount > maxRestarts {
+		failure := &PodFailure{
+			Category:  FailureCrashLoop,
+			Container: cstatus.Name,
+			Message:   fmt.Sprintf("%v %v has restarted unsuccessfully %v times", kind, cstatus.Name, cstatus.RestartCount),
+			previous:  cstatus.State.Terminated == nil,
+		}
+		if init {
+			failure.Category = FailureInitContainerFailed
+		}
+		if last := cstatus.LastTerminationState.Terminated; last != nil {
+			failure.ExitCode = last.ExitCode
+			failure.Message += fmt.Sprintf(", last exiting with code %v", last.ExitCode)
+			if last.Reason == "OOMKilled" {
+				failure.Category = FailureOOMKilled
+				failure.Message += " (OOMKilled)"
+			}
+		}
+		return failure
+	}
+
+	return nil
+}
+
+// DiagnosePod returns why a plugin's pod is failing, or nil if it isn't. On
+// top of IsPodFailing, it checks with the API server for ConfigMaps and
+// Secrets that a pending pod can't mount, and fetches the end of the failed
+// container's log.
+func DiagnosePod(kubeclient kubernetes.Interface, pod *v1.Pod) *PodFailure {
+	isFailing, failure := IsPodFailing(pod)
+	if !isFailing {
+		failure = missingVolume(kubeclient, pod)
+	}
+	if failure == nil {
+		return nil
+	}
+
+	if failure.Container != "" && failure.Category != FailureImagePull && failure.Category != FailureInvalidImageName {
+		failure.LogTail = logTail(kubeclient, pod, failure.Container, failure.previous)
+	}
+	return failure
+}
+
+// Diagnoser diagnoses plugin pods like DiagnosePod, but remembers the
+// diagnosis of each pod until it changes, so that pods can be checked every
+// time the watch on them fires without calling the API server each time.
+// It isn't safe for concurrent use; each plugin's Monitor has its own.
+type Diagnoser struct {
+	kubeclient kubernetes.Interface
+	ttl        time.Duration
+	diagnoses  map[types.UID]diagnosis
+}
+
+type diagnosis struct {
+	resourceVersion string
+	diagnosed       time.Time
+	failure         *PodFailure
+}
+
+// NewDiagnoser returns a Diagnoser using the given client.
+func NewDiagnoser(kubeclient kubernetes.Interface) *Diagnoser {
+	return &Diagnoser{
+		kubeclient: kubeclient,
+		ttl:        diagnosisTTL,
+		diagnoses:  make(map[types.UID]diagnosis),
+	}
+}
+
+// Diagnose returns why a plugin's pod is failing, or nil if it isn't, see
+// DiagnosePod. The pod is only diagnosed again once it has changed, or its
+// diagnosis is older than diagnosisTTL.
+func (d *Diagnoser) Diagnose(pod *v1.Pod) *PodFailure {
+	now := time.Now()
+	if cached, ok := d.diagnoses[pod.UID]; ok && cached.resourceVersion == pod.ResourceVersion && now.Sub(cached.diagnosed) < d.ttl {
+		return cached.failure
+	}
+
+	failure := DiagnosePod(d.kubeclient, pod)
+	d.diagnoses[pod.UID] = diagnosis{
+		resourceVersion: pod.ResourceVersion,
+		diagnosed:       now,
+		failure:         failure,
+	}
+	return failure
+}
+
+// missingVolume returns a failure if a scheduled pod that hasn't started is
+// waiting on a ConfigMap or Secret volume that doesn't exist.
+func missingVolume(kubeclient kubernetes.Interface, pod *v1.Pod) *PodFailure {
+	if pod.Status.Phase != v1.PodPending || pod.Spec.NodeName == "" {
+		return nil
+	}
+
+	for _, vol := range pod.Spec.Volumes {
+		var kind, name string
+		var err error
+		switch {
+		case vol.ConfigMap != nil && !isOptional(vol.ConfigMap.Optional):
+			kind, name = "ConfigMap", vol.ConfigMap.Name
+			_, err = kubeclient.CoreV1().ConfigMaps(pod.Namespace).Get(name, metav1.GetOptions{})
+		case vol.Secret != nil && !isOptional(vol.Secret.Optional):
+			kind, name = "Secret", vol.Secret.SecretName
+			_, err = kubeclient.CoreV1().Secrets(pod.Namespace).Get(name, metav1.GetOptions{})
+		default:
+			continue
+		}
+
+		if errors.IsNotFound(err) {
+			return &PodFailure{
+				Category: FailureMissingVolume,
+				Message:  fmt.Sprintf("%v %v for volume %v does not exist", kind, name, vol.Name),
+			}
+		} else if err != nil {
+			glog.Warningf("Could not check %v %v for pod %v: %v", kind, name, pod.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
+
+// logTail returns the last lines of a container's log, or nothing if they
+// can't be fetched.
+func logTail(kubeclient kubernetes.Interface, pod *v1.Pod, container string, previous bool) []string {
+	lines := int64(logTailLines)
+	raw, err := kubeclient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container: container,
+		TailLines: &lines,
+		Previous:  previous,
+	}).DoRaw()
+	if err != nil {
+		glog.Warningf("Could not get logs for container %v of pod %v: %v", container, pod.Name, err)
+		return nil
+	}
+
+	tail := strings.TrimRight(string(raw), "\n")
+	if tail == "" {
+		return nil
+	}
+	return strings.Split(tail, "\n")
+}
+
+// MakePodErrorResult constructs the error result for a failing plugin pod.
+func MakePodErrorResult(resultType string, pod *v1.Pod, failure *PodFailure, nodeName string) *plugin.Result {
+	return MakeErrorResult(resultType, map[string]interface{}{
+		"error":  failure.Message,
+		"reason": failure,
+		"pod":    pod,
+	}, nodeName)
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIsPodFailing(t *testing.T) {
+	terminated := func(code int32, reason string) v1.ContainerState {
+		return v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: code, Reason: reason}}
+	}
+	waiting := func(reason string) v1.ContainerState {
+		return v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}}
+	}
+	runningFor := func(d time.Duration) v1.ContainerState {
+		return v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(time.Now().Add(-d))}}
+	}
+
+	tests := []struct {
+		name          string
+		restartPolicy v1.RestartPolicy
+		status        v1.PodStatus
+		category      string
+		container     string
+		exitCode      int32
+	}{
+		{
+			name:   "running",
+			status: v1.PodStatus{Phase: v1.PodRunning},
+		},
+		{
+			name: "unschedulable",
+			status: v1.PodStatus{Conditions: []v1.PodCondition{
+				{Type: v1.PodScheduled, Reason: "Unschedulable"},
+			}},
+			category: FailureUnschedulable,
+		},
+		{
+			name: "image pull",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "plugin", State: waiting("ImagePullBackOff")},
+			}},
+			category:  FailureImagePull,
+			container: "plugin",
+		},
+		{
+			name: "invalid image",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "plugin", State: waiting("InvalidImageName")},
+			}},
+			category:  FailureInvalidImageName,
+			container: "plugin",
+		},
+		{
+			name: "config error",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "worker", State: waiting("CreateContainerConfigError")},
+			}},
+			category:  FailureContainerConfig,
+			container: "worker",
+		},
+		{
+			name:          "exited with restartPolicy Never",
+			restartPolicy: v1.RestartPolicyNever,
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "plugin", State: terminated(3, "Error")},
+			}},
+			category:  FailureContainerExited,
+			container: "plugin",
+			exitCode:  3,
+		},
+		{
+			name:          "exited successfully",
+			restartPolicy: v1.RestartPolicyNever,
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "plugin", State: terminated(0, "Completed")},
+			}},
+		},
+		{
+			name:          "exited with restartPolicy Always",
+			restartPolicy: v1.RestartPolicyAlways,
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "plugin", State: terminated(3, "Error")},
+			}},
+		},
+		{
+			name:          "OOM killed",
+			restartPolicy: v1.RestartPolicyNever,
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "plugin", State: terminated(137, "OOMKilled")},
+			}},
+			category:  FailureOOMKilled,
+			container: "plugin",
+			exitCode:  137,
+		},
+		{
+			name:          "crash loop",
+			restartPolicy: v1.RestartPolicyAlways,
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name:                 "plugin",
+					State:                waiting("CrashLoopBackOff"),
+					LastTerminationState: terminated(1, "Error"),
+					RestartCount:         3,
+				},
+			}},
+			category:  FailureCrashLoop,
+			container: "plugin",
+			exitCode:  1,
+		},
+		{
+			name:          "crash loop from OOM",
+			restartPolicy: v1.RestartPolicyAlways,
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name:                 "plugin",
+					State:                waiting("CrashLoopBackOff"),
+					LastTerminationState: terminated(137, "OOMKilled"),
+					RestartCount:         3,
+				},
+			}},
+			category:  FailureOOMKilled,
+			container: "plugin",
+			exitCode:  137,
+		},
+		{
+			name:          "init container",
+			restartPolicy: v1.RestartPolicyNever,
+			status: v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{
+				{Name: "setup", State: terminated(1, "Error")},
+			}},
+			category:  FailureInitContainerFailed,
+			container: "setup",
+			exitCode:  1,
+		},
+		{
+			name: "init container running",
+			status: v1.PodStatus{Phase: v1.PodPending, InitContainerStatuses: []v1.ContainerStatus{
+				{Name: "setup", State: runningFor(time.Minute)},
+			}},
+		},
+		{
+			name: "init container stuck",
+			status: v1.PodStatus{Phase: v1.PodPending, InitContainerStatuses: []v1.ContainerStatus{
+				{Name: "setup", State: runningFor(time.Hour)},
+			}},
+			category:  FailureInitContainerStuck,
+			container: "setup",
+		},
+		{
+			name:     "evicted",
+			status:   v1.PodStatus{Phase: v1.PodFailed, Reason: "Evicted"},
+			category: FailureEvicted,
+		},
+		{
+			name:     "node lost",
+			status:   v1.PodStatus{Phase: v1.PodUnknown, Reason: "NodeLost"},
+			category: FailureNodeLost,
+		},
+		{
+			name:     "failed",
+			status:   v1.PodStatus{Phase: v1.PodFailed, Reason: "DeadlineExceeded"},
+			category: FailurePodFailed,
+		},
+	}
+
+	for _, test := range tests {
+		pod := &v1.Pod{
+			Spec:   v1.PodSpec{RestartPolicy: test.restartPolicy},
+			Status: test.status,
+		}
+		isFailing, failure := IsPodFailing(pod)
+
+		if test.category == "" {
+			if isFailing {
+				t.Errorf("%v: expected pod not to be failing, got %+v", test.name, failure)
+			}
+			continue
+		}
+
+		if !isFailing {
+			t.Errorf("%v: expected pod to be failing", test.name)
+			continue
+		}
+		if failure.Category != test.category {
+			t.Errorf("%v: expected category %v, got %v", test.name, test.category, failure.Category)
+		}
+		if failure.Container != test.container {
+			t.Errorf("%v: expected container %q, got %q", test.name, test.container, failure.Container)
+		}
+		if failure.ExitCode != test.exitCode {
+			t.Errorf("%v: expected exit code %v, got %v", test.name, test.exitCode, failure.ExitCode)
+		}
+		if failure.Message == "" {
+			t.Errorf("%v: expected a message", test.name)
+		}
+	}
+}
+
+func TestDiagnoserCaches(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "sonobuoy", Name: "plugin", UID: "abc", ResourceVersion: "1"},
+		Spec: v1.PodSpec{
+			NodeName: "node1",
+			Volumes: []v1.Volume{
+				{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: "config"},
+				}}},
+			},
+		},
+		Status: v1.PodStatus{Phase: v1.PodPending},
+	}
+	kubeClient := fake.NewSimpleClientset(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "sonobuoy", Name: "config"}})
+	diagnoser := NewDiagnoser(kubeClient)
+
+	diagnose := func(what string, calls int) {
+		kubeClient.ClearActions()
+		if failure := diagnoser.Diagnose(pod); failure != nil {
+			t.Errorf("%v: expected pod not to be failing, got %+v", what, failure)
+		}
+		if actions := kubeClient.Actions(); len(actions) != calls {
+			t.Errorf("%v: expected %v API calls, got %v", what, calls, actions)
+		}
+	}
+
+	diagnose("first check", 1)
+	diagnose("unchanged pod", 0)
+
+	pod.ResourceVersion = "2"
+	diagnose("changed pod", 1)
+
+	diagnoser.ttl = 0
+	diagnose("expired diagnosis", 1)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// SelectNodes returns the nodes that pods with the given spec can be scheduled
+// on, going by the spec's nodeSelector and required node affinity. With the
+// plugin.TaintPolicySkip policy, nodes with NoSchedule or NoExecute taints the
+// spec doesn't tolerate are left out too.
+func SelectNodes(nodes []v1.Node, spec *v1.PodSpec, taintPolicy string) []v1.Node {
+	var selected []v1.Node
+	nodeSelector := labels.SelectorFromSet(labels.Set(spec.NodeSelector))
+	for _, node := range nodes {
+		if !nodeSelector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		if !matchesNodeAffinity(&node, spec.Affinity) {
+			continue
+		}
+		if taintPolicy == plugin.TaintPolicySkip && !toleratesTaints(&node, spec.Tolerations) {
+			continue
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
+
+// matchesNodeAffinity returns whether a node satisfies the required node
+// affinity, if any. Like the scheduler, it requires any one of the node
+// selector terms to match.
+func matchesNodeAffinity(node *v1.Node, affinity *v1.Affinity) bool {
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		selector, err := nodeSelectorTermSelector(term)
+		if err != nil {
+			glog.Warningf("Ignoring invalid node selector term %v: %v", term, err)
+			continue
+		}
+		if selector.Matches(labels.Set(node.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+var nodeSelectorOperators = map[v1.NodeSelectorOperator]selection.Operator{
+	v1.NodeSelectorOpIn:           selection.In,
+	v1.NodeSelectorOpNotIn:        selection.NotIn,
+	v1.NodeSelectorOpExists:       selection.Exists,
+	v1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	v1.NodeSelectorOpGt:           selection.GreaterThan,
+	v1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// nodeSelectorTermSelector converts a node selector term to a label
+// selector. An empty term matches nothing.
+func nodeSelectorTermSelector(term v1.NodeSelectorTerm) (labels.Selector, error) {
+	if len(term.MatchExpressions) == 0 {
+		return labels.Nothing(), nil
+	}
+
+	selector := labels.NewSelector()
+	for _, expr := range term.MatchExpressions {
+		op, ok := nodeSelectorOperators[expr.Operator]
+		if !ok {
+			return nil, fmt.Errorf("unknown operator %v", expr.Operator)
+		}
+		req, err := labels.NewRequirement(expr.Key, op, expr.Values)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*req)
+	}
+	return selector, nil
+}
+
+// toleratesTaints returns whether the tolerations let pods be scheduled, and
+// keep running, on the node.
+func toleratesTaints(node *v1.Node, tolerations []v1.Toleration) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+			continue
+		}
+
+		tolerated := false
+		for _, toleration := range tolerations {
+			if toleration.ToleratesTaint(&taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyNodeSelection constrains a pod spec to the nodes matching the given
+// node selector, on top of any nodeSelector it already has, and with the
+// plugin.TaintPolicyTolerate policy, lets it tolerate every taint.
+func ApplyNodeSelection(spec *v1.PodSpec, nodeSelector map[string]string, taintPolicy string) {
+	if len(nodeSelector) > 0 {
+		merged := make(map[string]string, len(spec.NodeSelector)+len(nodeSelector))
+		for k, v := range spec.NodeSelector {
+			merged[k] = v
+		}
+		for k, v := range nodeSelector {
+			merged[k] = v
+		}
+		spec.NodeSelector = merged
+	}
+
+	if taintPolicy == plugin.TaintPolicyTolerate {
+		tolerations := make([]v1.Toleration, 0, len(spec.Tolerations)+1)
+		tolerations = append(tolerations, spec.Tolerations...)
+		spec.Tolerations = append(tolerations, v1.Toleration{Operator: v1.TolerationOpExists})
+	}
+}
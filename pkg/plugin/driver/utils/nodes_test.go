@@ -0,0 +1,120 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelectNodes(t *testing.T) {
+	node := func(name string, labels map[string]string, taints ...v1.Taint) v1.Node {
+		return v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec:       v1.NodeSpec{Taints: taints},
+		}
+	}
+	masterTaint := v1.Taint{Key: "node-role.kubernetes.io/master", Effect: v1.TaintEffectNoSchedule}
+
+	nodes := []v1.Node{
+		node("master", map[string]string{"role": "master"}, masterTaint),
+		node("worker1", map[string]string{"role": "node", "zone": "a"}),
+		node("worker2", map[string]string{"role": "node", "zone": "b"}),
+		node("soft", nil, v1.Taint{Key: "soft", Effect: v1.TaintEffectPreferNoSchedule}),
+	}
+
+	tests := []struct {
+		name          string
+		spec          v1.PodSpec
+		nodeSelector  map[string]string
+		taintPolicy   string
+		expectedNodes []string
+	}{
+		{
+			name:          "all nodes",
+			expectedNodes: []string{"master", "worker1", "worker2", "soft"},
+		},
+		{
+			name:          "node selector",
+			nodeSelector:  map[string]string{"role": "node"},
+			expectedNodes: []string{"worker1", "worker2"},
+		},
+		{
+			name:          "spec and definition node selectors",
+			spec:          v1.PodSpec{NodeSelector: map[string]string{"zone": "b"}},
+			nodeSelector:  map[string]string{"role": "node"},
+			expectedNodes: []string{"worker2"},
+		},
+		{
+			name: "node affinity",
+			spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{MatchExpressions: []v1.NodeSelectorRequirement{
+							{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}},
+						}},
+						{MatchExpressions: []v1.NodeSelectorRequirement{
+							{Key: "role", Operator: v1.NodeSelectorOpIn, Values: []string{"master"}},
+						}},
+					},
+				},
+			}}},
+			expectedNodes: []string{"master", "worker1"},
+		},
+		{
+			name:          "skip tainted",
+			taintPolicy:   plugin.TaintPolicySkip,
+			expectedNodes: []string{"worker1", "worker2", "soft"},
+		},
+		{
+			name:          "skip untolerated",
+			spec:          v1.PodSpec{Tolerations: []v1.Toleration{{Key: "node-role.kubernetes.io/master", Operator: v1.TolerationOpExists}}},
+			taintPolicy:   plugin.TaintPolicySkip,
+			expectedNodes: []string{"master", "worker1", "worker2", "soft"},
+		},
+		{
+			name:          "tolerate",
+			taintPolicy:   plugin.TaintPolicyTolerate,
+			expectedNodes: []string{"master", "worker1", "worker2", "soft"},
+		},
+		{
+			name:          "tolerate with node selector",
+			nodeSelector:  map[string]string{"role": "master"},
+			taintPolicy:   plugin.TaintPolicyTolerate,
+			expectedNodes: []string{"master"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := test.spec
+			ApplyNodeSelection(&spec, test.nodeSelector, test.taintPolicy)
+
+			var names []string
+			for _, node := range SelectNodes(nodes, &spec, test.taintPolicy) {
+				names = append(names, node.Name)
+			}
+			if !reflect.DeepEqual(names, test.expectedNodes) {
+				t.Errorf("expected nodes %v, got %v", test.expectedNodes, names)
+			}
+		})
+	}
+}
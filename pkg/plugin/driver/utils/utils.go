@@ -19,44 +19,11 @@ package utils
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 
 	"github.com/heptio/sonobuoy/pkg/plugin"
-
-	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// IsPodFailing returns whether a plugin's pod is failing and isn't likely to
-// succeed.
-// TODO: this may require more revisions as we get more experience with
-// various types of failures that can occur.
-func IsPodFailing(pod *v1.Pod) (bool, string) {
-	// Check if the pod is unschedulable
-	for _, cond := range pod.Status.Conditions {
-		if cond.Reason == "Unschedulable" {
-			return true, fmt.Sprintf("Can't schedule pod: %v", cond.Message)
-		}
-	}
-
-	for _, cstatus := range pod.Status.ContainerStatuses {
-		// Check if a container in the pod is restarting multiple times
-		if cstatus.RestartCount > 2 {
-			errstr := fmt.Sprintf("Container %v has restarted unsuccessfully %v times", cstatus.Name, cstatus.RestartCount)
-			return true, errstr
-		}
-
-		// Check if it can't fetch its image
-		if waiting := cstatus.State.Waiting; waiting != nil {
-			if waiting.Reason == "ImagePullBackOff" || waiting.Reason == "ErrImagePull" {
-				errstr := fmt.Sprintf("Container %v is in state %v", cstatus.Name, waiting.Reason)
-				return true, errstr
-			}
-		}
-	}
-
-	return false, ""
-}
-
 // MakeErrorResult constructs a plugin.Result given an error message and error
 // data.  errdata is a map that will be placed in the sonobuoy results tarball
 // for this plugin as a JSON file, so it's what users will see for why the
@@ -87,8 +54,17 @@ func MakeErrorResult(resultType string, errdata map[string]interface{}, nodeName
 func ApplyDefaultLabels(p plugin.Interface, labels map[string]string) map[string]string {
 	labels["component"] = "sonobuoy"
 	labels["tier"] = "analysis"
-	labels["sonobuoy-run"] = p.GetSessionID()
+	labels[plugin.SessionLabel] = p.GetSessionID()
 	labels["sonobuoy-plugin"] = p.GetName()
 
 	return labels
 }
+
+// OwnerReferences returns the owner references of a resource created by a
+// plugin, so that it's deleted along with the given owner, if there is one.
+func OwnerReferences(owner *metav1.OwnerReference) []metav1.OwnerReference {
+	if owner == nil {
+		return nil
+	}
+	return []metav1.OwnerReference{*owner}
+}
@@ -17,10 +17,14 @@ limitations under the License.
 package plugin
 
 import (
+	"context"
 	"io"
 	"path"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -29,14 +33,26 @@ import (
 type Interface interface {
 	// Run runs a plugin, declaring all resources it needs, and then
 	// returns.  It does not block and wait until the plugin has finished.
-	Run(kubeClient kubernetes.Interface) error
+	// The given nodes are the ones ExpectedResults was given, so plugins
+	// dispatching to nodes run on the ones they're expected to report from.
+	// The given credentials must be passed on to the plugin's workers so
+	// that they can submit results to the master. If owner isn't nil, the
+	// resources must belong to it, so that they're deleted along with the
+	// run.
+	Run(kubeClient kubernetes.Interface, nodes []v1.Node, creds *WorkerCredentials, owner *metav1.OwnerReference) error
+	// Resources returns the objects Run would create in a cluster with the
+	// given nodes, without creating anything, so that a run can be checked
+	// before it's made (see the master's --dry-run.)
+	Resources(nodes []v1.Node, creds *WorkerCredentials, owner *metav1.OwnerReference) ([]runtime.Object, error)
 	// Cleanup cleans up all resources created by the plugin
 	Cleanup(kubeClient kubernetes.Interface) []error
 	// Monitor continually checks for problems in the resources created by a
 	// plugin (either because it won't schedule, or the image won't
 	// download, too many failed executions, etc) and sends the errors as
-	// Result objects through the provided channel.
-	Monitor(kubeClient kubernetes.Interface, availableNodes []v1.Node, resultsCh chan<- *Result)
+	// Result objects through the provided channel. The plugin's pods are
+	// read from the given PodWatcher, shared by all plugins. Monitor
+	// returns when ctx is done.
+	Monitor(ctx context.Context, kubeClient kubernetes.Interface, availableNodes []v1.Node, pods *PodWatcher, resultsCh chan<- *Result)
 	// ExpectedResults is an array of Result objects that a plugin should
 	// expect to submit.
 	ExpectedResults(nodes []v1.Node) []ExpectedResult
@@ -51,6 +67,15 @@ type Interface interface {
 	// sonobuoy session (for instance, for labeling resources created by
 	// this plugin.)
 	GetSessionID() string
+	// GetTimeout returns how long to wait for this plugin's results, or 0
+	// to use the aggregation server's default timeout.
+	GetTimeout() time.Duration
+	// GetDependsOn returns the names of the plugins that must finish before
+	// this one is run.
+	GetDependsOn() []string
+	// GetPhase returns the phase this plugin runs in. Plugins are only run
+	// once every plugin in an earlier phase has finished.
+	GetPhase() int
 }
 
 // Definition defines a plugin's features, method of launch, and other
@@ -60,10 +85,71 @@ type Definition struct {
 	Name       string                 `json:"name"`
 	ResultType string                 `json:"resultType"`
 	RawPodSpec map[string]interface{} `json:"spec"`
+	// TimeoutSeconds is how long to wait for the plugin's results before
+	// giving up on the ones that haven't come in. If unset, the
+	// aggregation server's timeout is used.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// DependsOn are the names of plugins that must finish, successfully,
+	// before this one is run.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Phase orders plugins: every plugin in an earlier phase must finish,
+	// successfully, before this one is run.
+	Phase int `json:"phase,omitempty"`
+	// Parameters are the values the definition, as a template, takes from
+	// the config of the plugin's Selection.
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// NodeSelector limits the nodes a per-node plugin runs on, and expects
+	// results from, to those with these labels.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// TaintPolicy is how a per-node plugin treats tainted nodes, one of the
+	// TaintPolicy* constants. TaintPolicyExpect by default.
+	TaintPolicy string `json:"taintPolicy,omitempty"`
+	// Command is the command, and its arguments, the Local driver runs in
+	// the master in place of a pod.
+	Command []string `json:"command,omitempty"`
+	// Collector is the name of the Go collector the Local driver runs in
+	// place of a command, see local.RegisterCollector.
+	Collector string `json:"collector,omitempty"`
 
 	PodSpec v1.PodSpec // This is filled in by the plugin loader, since deserializing a pod spec is nontrivial
 }
 
+// Taint policies, see Definition.TaintPolicy
+const (
+	// TaintPolicyExpect expects results from every node, reporting nodes
+	// whose taints the plugin doesn't tolerate as failures.
+	TaintPolicyExpect = "expect"
+	// TaintPolicySkip skips nodes with NoSchedule or NoExecute taints the
+	// plugin doesn't tolerate.
+	TaintPolicySkip = "skip"
+	// TaintPolicyTolerate makes the plugin tolerate every taint.
+	TaintPolicyTolerate = "tolerate"
+)
+
+// Parameter types, see Parameter
+const (
+	ParameterString = "string"
+	ParameterInt    = "int"
+	ParameterBool   = "bool"
+	ParameterList   = "list"
+)
+
+// Parameter declares a value that a plugin definition takes from the config
+// of its Selection.
+type Parameter struct {
+	// Name is the name of the parameter, both in the selection's config
+	// (where it is case insensitive) and in the template
+	Name string `json:"name"`
+	// Type is one of the Parameter* types, ParameterString by default
+	Type string `json:"type,omitempty"`
+	// Default is used if the selection doesn't set the parameter. If there
+	// is no default, the zero value of Type is used.
+	Default interface{} `json:"default,omitempty"`
+	// Required parameters must be set by the selection
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
 // ExpectedResult is an expected result that a plugin will submit.  This is so
 // the aggregation server can know when it all results have been received.
 type ExpectedResult struct {
@@ -101,8 +187,24 @@ func (r *Result) Path() string {
 
 // Selection is the user specified input to load and initialize plugins
 type Selection struct {
-	Name   string                 `json:"name"`
+	Name string `json:"name"`
+	// Alias, if set, is the name and result type of this instance of the
+	// plugin, so that the same plugin can be selected more than once.
+	Alias  string                 `json:"alias,omitempty"`
 	Config map[string]interface{} `json:"config,omitempty"`
+	// NodeSelector and TaintPolicy, if set, replace those of the plugin's
+	// Definition.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	TaintPolicy  string            `json:"taintPolicy,omitempty"`
+}
+
+// InstanceName is the name the selected plugin will run under: its alias if
+// it has one, otherwise the plugin's name.
+func (s *Selection) InstanceName() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
 }
 
 // AggregationConfig are the config settings for the server that aggregates plugin results
@@ -110,13 +212,44 @@ type AggregationConfig struct {
 	BindAddress      string `json:"bindaddress"`
 	BindPort         int    `json:"bindport"`
 	AdvertiseAddress string `json:"advertiseaddress"`
-	TimeoutSeconds   int    `json:"timeoutseconds"`
+	// TimeoutSeconds is how long to wait for the results of plugins that
+	// don't set their own timeout
+	TimeoutSeconds int `json:"timeoutseconds"`
+}
+
+// CredentialsDir is where a worker's credentials are mounted, from a Secret
+// separate to its config, with a file for each of the WorkerCredentials.
+const CredentialsDir = "/var/run/secrets/sonobuoy"
+
+// The names of the files in CredentialsDir
+const (
+	CACertFile     = "ca.crt"
+	ClientCertFile = "client.crt"
+	ClientKeyFile  = "client.key"
+	TokenFile      = "token"
+)
+
+// WorkerCredentials are what a sonobuoy worker uses to authenticate itself to
+// the master (and the master to itself) when submitting results.
+type WorkerCredentials struct {
+	// CACert is the PEM encoded certificate of the authority that signed the
+	// master's and worker's certificates
+	CACert string `json:"cacert,omitempty" mapstructure:"cacert"`
+	// ClientCert and ClientKey are the PEM encoded certificate and private
+	// key the worker presents to the master
+	ClientCert string `json:"clientcert,omitempty" mapstructure:"clientcert"`
+	ClientKey  string `json:"clientkey,omitempty" mapstructure:"clientkey"`
+	// Token is the bearer token, unique to each plugin in a run, that the
+	// worker sends along with its results
+	Token string `json:"token,omitempty" mapstructure:"token"`
 }
 
 // WorkerConfig is the file given to the sonobuoy worker to configure it to phone home.
 type WorkerConfig struct {
+	WorkerCredentials `mapstructure:",squash"`
+
 	// MasterURL is the URL we talk to for submitting results
-	MasterURL string `json:"masterurl,omitempty mapstructure:"masterurl""`
+	MasterURL string `json:"masterurl,omitempty" mapstructure:"masterurl"`
 	// NodeName is the node name we should call ourselves when sending results
 	NodeName string `json:"nodename,omitempty" mapstructure:"nodename"`
 	// ResultsDir is the directory that's expected to contain the host's root filesystem
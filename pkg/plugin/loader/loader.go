@@ -23,6 +23,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -32,15 +33,17 @@ import (
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/heptio/sonobuoy/pkg/plugin/driver/daemonset"
 	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/local"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/podpernode"
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // LoadAllPlugins loads all plugins by finding plugin definitions in the given
-// directory, taking a user's plugin selections, and a sonobuoy phone home
-// address (host:port) and returning all of the active, configured plugins for
-// this sonobuoy run.
-func LoadAllPlugins(namespace string, searchPath []string, selections []plugin.Selection, masterAddress string) (ret []plugin.Interface, err error) {
-	var defns []plugin.Definition
+// directory, taking a user's plugin selections, a sonobuoy phone home
+// address (host:port) and the output directory of the run, and returning all
+// of the active, configured plugins for this sonobuoy run.
+func LoadAllPlugins(namespace string, searchPath []string, selections []plugin.Selection, masterAddress, outputDir string) (ret []plugin.Interface, err error) {
+	var files []*pluginFile
 
 	for _, dir := range searchPath {
 		wd, _ := os.Getwd()
@@ -57,13 +60,50 @@ func LoadAllPlugins(namespace string, searchPath []string, selections []plugin.S
 			return ret, err
 		}
 
-		defns = append(defns, p...)
+		files = append(files, p...)
 	}
 
+	names := make(map[string]bool, len(selections))
+	resultTypes := make(map[string]bool, len(selections))
 	for _, selection := range selections {
-		for _, pluginDef := range defns {
-			if selection.Name == pluginDef.Name {
-				p, err := loadPlugin(namespace, pluginDef, masterAddress)
+		if selection.Alias != "" && !aliasRegexp.MatchString(selection.Alias) {
+			return ret, fmt.Errorf("invalid alias %q for plugin %v: must be lower case letters, digits, '-' and '_'", selection.Alias, selection.Name)
+		}
+
+		for _, file := range files {
+			if selection.Name == file.header.Name {
+				dfn, err := file.definition(selection.Config)
+				if err != nil {
+					return ret, fmt.Errorf("could not load plugin %v from %v: %v", selection.Name, file.path, err)
+				}
+				if selection.Alias != "" {
+					dfn.Name = selection.Alias
+					dfn.ResultType = selection.Alias
+				}
+				if selection.NodeSelector != nil {
+					dfn.NodeSelector = selection.NodeSelector
+				}
+				if selection.TaintPolicy != "" {
+					dfn.TaintPolicy = selection.TaintPolicy
+				}
+				switch dfn.TaintPolicy {
+				case "", plugin.TaintPolicyExpect, plugin.TaintPolicySkip, plugin.TaintPolicyTolerate:
+				default:
+					return ret, fmt.Errorf("invalid taintPolicy %q for plugin %v", dfn.TaintPolicy, dfn.Name)
+				}
+
+				// Plugins are told apart by name, and their results by
+				// type, so neither can be shared.
+				if names[dfn.Name] {
+					return ret, fmt.Errorf("plugin %v is selected more than once, give each selection a different alias", dfn.Name)
+				}
+				if resultTypes[dfn.ResultType] {
+					return ret, fmt.Errorf("more than one plugin has result type %v, give one of them an alias", dfn.ResultType)
+				}
+				names[dfn.Name] = true
+				resultTypes[dfn.ResultType] = true
+
+				p, err := loadPlugin(namespace, *dfn, masterAddress, outputDir)
 				if err != nil {
 					return ret, err
 				}
@@ -74,29 +114,77 @@ func LoadAllPlugins(namespace string, searchPath []string, selections []plugin.S
 	return ret, nil
 }
 
+// aliasRegexp matches valid plugin aliases, which are used in the names of
+// the plugin's resources and the paths of its results.
+var aliasRegexp = regexp.MustCompile(`^[a-z0-9]([-_a-z0-9]*[a-z0-9])?$`)
+
 // loadPlugin loads an individual plugin by instantiating a plugin driver with
 // the settings from the given plugin definition and selection
-func loadPlugin(namespace string, dfn plugin.Definition, masterAddress string) (plugin.Interface, error) {
+func loadPlugin(namespace string, dfn plugin.Definition, masterAddress, outputDir string) (plugin.Interface, error) {
 	cfg := &plugin.WorkerConfig{
 		ResultType: dfn.ResultType,
 	}
 
 	switch dfn.Driver {
 	case "DaemonSet":
-		cfg.MasterURL = "http://" + masterAddress + "/api/v1/results/by-node"
+		cfg.MasterURL = "https://" + masterAddress + "/api/v1/results/by-node"
 		return daemonset.NewPlugin(namespace, dfn, cfg), nil
 	case "Job":
-		cfg.MasterURL = "http://" + masterAddress + "/api/v1/results/global"
+		cfg.MasterURL = "https://" + masterAddress + "/api/v1/results/global"
 		return job.NewPlugin(namespace, dfn, cfg), nil
+	case "PodPerNode":
+		cfg.MasterURL = "https://" + masterAddress + "/api/v1/results/by-node"
+		return podpernode.NewPlugin(namespace, dfn, cfg), nil
+	case "Local":
+		p, err := local.NewPlugin(dfn, cfg, outputDir)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
 	default:
 		return nil, fmt.Errorf("Unknown driver %v", dfn.Driver)
 	}
 }
 
+// pluginFile is a plugin definition file, which is a template to be rendered
+// with the parameters of each selection of the plugin.
+type pluginFile struct {
+	path   string
+	raw    []byte
+	loader loader
+	// header is the definition rendered without any parameters, which is
+	// only good for its name and parameter declarations.
+	header *plugin.Definition
+}
+
+// definition renders the plugin definition with the given selection config,
+// and loads it.
+func (f *pluginFile) definition(config map[string]interface{}) (*plugin.Definition, error) {
+	values, err := parameterValues(f.header.Parameters, config)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := renderDefinition(f.path, f.raw, values, true)
+	if err != nil {
+		return nil, err
+	}
+
+	dfn, err := f.loader(rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = loadPluginDefinition(dfn); err != nil {
+		return nil, err
+	}
+	return dfn, nil
+}
+
 // scanPlugins looks for Plugin Definition files in the given directory,
-// and returns an array of PluginDefinition structs.
-func scanPlugins(dir string) ([]plugin.Definition, error) {
-	var plugins []plugin.Definition
+// and returns an array of pluginFile structs.
+func scanPlugins(dir string) ([]*pluginFile, error) {
+	var plugins []*pluginFile
 
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -104,13 +192,7 @@ func scanPlugins(dir string) ([]plugin.Definition, error) {
 	}
 
 	for _, file := range files {
-		var loaderFn loader
-		switch filepath.Ext(file.Name()) {
-		case ".yaml":
-			loaderFn = loadYAML
-		case ".json":
-			loaderFn = loadJSON
-		default:
+		if loaderFor(file.Name()) == nil {
 			continue
 		}
 
@@ -121,27 +203,71 @@ func scanPlugins(dir string) ([]plugin.Definition, error) {
 			return plugins, err
 		}
 
-		pluginDef, err := loaderFn(y)
-		if err != nil {
-			glog.Warningf("Error unmarshalling bytes at %v: %v", fullPath, err)
-			continue
-		}
-
-		// Load it into a proper PluginDefinition.  If we can't, just
-		// warn.  If they've selected this plugin in their config,
-		// they'll get an error then.
-		err = loadPluginDefinition(pluginDef)
+		// If we can't make sense of it, just warn.  If they've selected
+		// this plugin in their config, they'll get an error when it isn't
+		// found.
+		p, err := newPluginFile(fullPath, y)
 		if err != nil {
 			glog.Warningf("Error loading plugin at %v: %v", fullPath, err)
 			continue
 		}
-
-		plugins = append(plugins, *pluginDef)
+		plugins = append(plugins, p)
 	}
 
 	return plugins, err
 }
 
+// LoadDefinition loads the contents of a plugin definition file the way
+// LoadAllPlugins would for a selection of it with the given config. This lets
+// definitions be checked before they're handed to the master.
+func LoadDefinition(file string, raw []byte, config map[string]interface{}) (*plugin.Definition, error) {
+	p, err := newPluginFile(file, raw)
+	if err != nil {
+		return nil, err
+	}
+	return p.definition(config)
+}
+
+// newPluginFile reads the header of a plugin definition file by rendering it
+// without parameters, just to find out its name and what parameters it takes.
+func newPluginFile(file string, raw []byte) (*pluginFile, error) {
+	loaderFn := loaderFor(file)
+	if loaderFn == nil {
+		return nil, fmt.Errorf("unknown plugin file type %v", filepath.Ext(file))
+	}
+
+	rendered, err := renderDefinition(file, raw, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering plugin template: %v", err)
+	}
+	header, err := loaderFn(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling plugin: %v", err)
+	}
+	if header.Name == "" {
+		return nil, fmt.Errorf("no name specified in plugin file")
+	}
+
+	return &pluginFile{
+		path:   file,
+		raw:    raw,
+		loader: loaderFn,
+		header: header,
+	}, nil
+}
+
+// loaderFor returns the loader for plugin definition files with the given
+// name, or nil if it isn't a plugin definition.
+func loaderFor(file string) loader {
+	switch filepath.Ext(file) {
+	case ".yaml":
+		return loadYAML
+	case ".json":
+		return loadJSON
+	}
+	return nil
+}
+
 type loader func([]byte) (*plugin.Definition, error)
 
 func loadYAML(yamlBytes []byte) (*plugin.Definition, error) {
@@ -168,7 +294,14 @@ func loadPluginDefinition(ret *plugin.Definition) error {
 	if ret.Name == "" {
 		return fmt.Errorf("No name specified in plugin file")
 	}
+	if ret.TimeoutSeconds < 0 {
+		return fmt.Errorf("Invalid timeoutSeconds %v in plugin file", ret.TimeoutSeconds)
+	}
 	if ret.RawPodSpec == nil {
+		// Local plugins run in the master, not in a pod
+		if ret.Driver == "Local" {
+			return nil
+		}
 		return fmt.Errorf("No pod spec specified in plugin file")
 	}
 
@@ -193,7 +326,7 @@ func loadPluginDefinition(ret *plugin.Definition) error {
 	// Decode *that* yaml into a Pod
 	var placeholderPod v1.Pod
 	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), placeholderPodYaml, &placeholderPod); err != nil {
-		glog.Fatalf("Could not decode pod spec: %v", err)
+		return fmt.Errorf("Could not decode pod spec: %v", err)
 	}
 	ret.PodSpec = placeholderPod.Spec
 
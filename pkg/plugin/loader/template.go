@@ -0,0 +1,166 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+// templateFuncs are the functions available to plugin definition templates.
+// Both produce JSON, which is also valid YAML.
+var templateFuncs = template.FuncMap{
+	// quote quotes a value as a string
+	"quote": func(v interface{}) (string, error) {
+		b, err := json.Marshal(fmt.Sprint(v))
+		return string(b), err
+	},
+	// toJson writes out a value, for instance a list, in full
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// renderDefinition renders a plugin definition template with the given
+// parameter values. If strict is set, references to values that weren't
+// given are an error, otherwise they render as empty.
+func renderDefinition(name string, text []byte, values map[string]interface{}, strict bool) ([]byte, error) {
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	tmpl, err := template.New(name).Option(missingKey).Funcs(templateFuncs).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err = tmpl.Execute(&b, values); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// parameterValues works out the value of each of the given parameters from a
+// selection's config, failing if the config sets a parameter that doesn't
+// exist, to a value of the wrong type, or leaves out a required parameter.
+func parameterValues(params []plugin.Parameter, config map[string]interface{}) (map[string]interface{}, error) {
+	var errs []string
+	values := make(map[string]interface{}, len(params))
+	used := make(map[string]bool, len(config))
+
+	for _, param := range params {
+		value := param.Default
+		set := false
+		for key, v := range config {
+			if strings.EqualFold(key, param.Name) {
+				value, set = v, true
+				used[key] = true
+			}
+		}
+
+		if !set && param.Required {
+			errs = append(errs, fmt.Sprintf("parameter %v is required", param.Name))
+			continue
+		}
+
+		v, err := convertParameter(param.Type, value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("parameter %v %v", param.Name, err))
+			continue
+		}
+		values[param.Name] = v
+	}
+
+	var unknown []string
+	for key := range config {
+		if !used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Sprintf("unknown parameter %v", key))
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid plugin config: %v", strings.Join(errs, ", "))
+	}
+	return values, nil
+}
+
+// convertParameter checks that value is of the given parameter type, and
+// converts it to the Go type templates see. A nil value is the type's zero
+// value.
+func convertParameter(paramType string, value interface{}) (interface{}, error) {
+	switch paramType {
+	case "", plugin.ParameterString:
+		switch v := value.(type) {
+		case nil:
+			return "", nil
+		case string:
+			return v, nil
+		}
+	case plugin.ParameterInt:
+		switch v := value.(type) {
+		case nil:
+			return 0, nil
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			// Numbers from JSON (and so YAML) are all floats
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		}
+	case plugin.ParameterBool:
+		switch v := value.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return v, nil
+		}
+	case plugin.ParameterList:
+		switch v := value.(type) {
+		case nil:
+			return []interface{}{}, nil
+		case []interface{}:
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("has unknown type %v", paramType)
+	}
+
+	if paramType == "" {
+		paramType = plugin.ParameterString
+	}
+	return nil, fmt.Errorf("must be a %v, got %v", paramType, value)
+}
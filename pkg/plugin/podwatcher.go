@@ -0,0 +1,177 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SessionLabel is the label every resource created by a plugin carries, set
+// to the plugin's session ID.
+const SessionLabel = "sonobuoy-run"
+
+// sessionIndex is the name of the informer index of pods by session ID.
+const sessionIndex = "session"
+
+// PodWatcher keeps a cache of every pod created by plugins, from a single
+// informer shared by all the plugins in a run, and notifies the plugins
+// monitoring them when their pods change.
+type PodWatcher struct {
+	informer cache.SharedIndexInformer
+
+	mutex       sync.Mutex
+	synced      bool
+	subscribers map[*podSubscriber]bool
+}
+
+type podSubscriber struct {
+	sessionID string
+	ch        chan struct{}
+}
+
+// NewPodWatcher returns a PodWatcher for plugin pods in the given namespace.
+// It does nothing until Run is called.
+func NewPodWatcher(client kubernetes.Interface, namespace string) *PodWatcher {
+	// Only pods carrying a session label are of interest, so the rest are
+	// never sent by the API server.
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = SessionLabel
+			return client.CoreV1().Pods(namespace).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = SessionLabel
+			return client.CoreV1().Pods(namespace).Watch(options)
+		},
+	}
+
+	w := &PodWatcher{
+		informer: cache.NewSharedIndexInformer(lw, &v1.Pod{}, 0, cache.Indexers{
+			sessionIndex: indexBySession,
+		}),
+		subscribers: make(map[*podSubscriber]bool),
+	}
+	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.notify,
+		UpdateFunc: func(_, obj interface{}) { w.notify(obj) },
+		DeleteFunc: w.notify,
+	})
+	return w
+}
+
+// Run runs the informer, keeping the cache up to date, until stopCh is
+// closed. Subscribers are notified once the cache is first populated.
+func (w *PodWatcher) Run(stopCh <-chan struct{}) {
+	go w.informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, w.informer.HasSynced) {
+		return
+	}
+
+	w.mutex.Lock()
+	w.synced = true
+	for sub := range w.subscribers {
+		sub.notify()
+	}
+	w.mutex.Unlock()
+
+	<-stopCh
+}
+
+// Subscribe returns a channel that receives a value whenever the pods with
+// the given session ID may have changed, including once as soon as the
+// cache is populated. Changes are coalesced, so subscribers should read the
+// current state with Pods rather than count notifications. The returned
+// function unsubscribes.
+func (w *PodWatcher) Subscribe(sessionID string) (<-chan struct{}, func()) {
+	sub := &podSubscriber{sessionID: sessionID, ch: make(chan struct{}, 1)}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.subscribers[sub] = true
+	if w.synced {
+		sub.notify()
+	}
+
+	return sub.ch, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		delete(w.subscribers, sub)
+	}
+}
+
+// Pods returns the cached pods with the given session ID.
+func (w *PodWatcher) Pods(sessionID string) []v1.Pod {
+	objs, err := w.informer.GetIndexer().ByIndex(sessionIndex, sessionID)
+	if err != nil {
+		glog.Errorf("Could not look up pods of session %v: %v", sessionID, err)
+		return nil
+	}
+
+	pods := make([]v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		pods = append(pods, *obj.(*v1.Pod))
+	}
+	return pods
+}
+
+// notify notifies the subscribers for the session of the pod that changed.
+func (w *PodWatcher) notify(obj interface{}) {
+	// Pods deleted while the watch was down are only known by their last
+	// state.
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		glog.Warningf("Unexpected object in pod informer: %T", obj)
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for sub := range w.subscribers {
+		if sub.sessionID == pod.Labels[SessionLabel] {
+			sub.notify()
+		}
+	}
+}
+
+// notify sends a notification without blocking, dropping it if one is
+// already pending.
+func (s *podSubscriber) notify() {
+	select {
+	case s.ch <- struct{}{}:
+	default:
+	}
+}
+
+// indexBySession indexes pods by their session ID.
+func indexBySession(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	return []string{pod.Labels[SessionLabel]}, nil
+}
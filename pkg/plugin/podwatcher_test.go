@@ -0,0 +1,134 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func sessionPod(namespace, name, sessionID string) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	if sessionID != "" {
+		pod.Labels = map[string]string{SessionLabel: sessionID}
+	}
+	return pod
+}
+
+// expectNotified fails the test unless a notification arrives on ch soon.
+func expectNotified(t *testing.T, ch <-chan struct{}, what string) {
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a notification %v", what)
+	}
+}
+
+// settle drains ch of notifications until none have arrived for a while.
+func settle(ch <-chan struct{}) {
+	for {
+		select {
+		case <-ch:
+		case <-time.After(100 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// expectQuiet fails the test if there's a notification pending on ch.
+func expectQuiet(t *testing.T, ch <-chan struct{}, what string) {
+	select {
+	case <-ch:
+		t.Errorf("Expected no notification %v", what)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPodWatcher(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		sessionPod("plugins", "a-1", "a"),
+		sessionPod("plugins", "b-1", "b"),
+		sessionPod("other", "a-other", "a"),
+		sessionPod("plugins", "unlabelled", ""),
+	)
+	podWatch := watch.NewFake()
+	watched := make(chan k8stesting.WatchAction, 1)
+	kubeClient.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		watched <- action.(k8stesting.WatchAction)
+		return true, podWatch, nil
+	})
+
+	pods := NewPodWatcher(kubeClient, "plugins")
+	changedA, unsubscribeA := pods.Subscribe("a")
+	defer unsubscribeA()
+	changedB, unsubscribeB := pods.Subscribe("b")
+	defer unsubscribeB()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go pods.Run(stopCh)
+
+	expectNotified(t, changedA, "once the cache is populated")
+	expectNotified(t, changedB, "once the cache is populated")
+	if a := pods.Pods("a"); len(a) != 1 || a[0].Name != "a-1" {
+		t.Errorf("Expected only pod a-1 in session a, got %v", a)
+	}
+	if b := pods.Pods("b"); len(b) != 1 || b[0].Name != "b-1" {
+		t.Errorf("Expected only pod b-1 in session b, got %v", b)
+	}
+	if others := pods.Pods(""); len(others) != 0 {
+		t.Errorf("Expected unlabelled pods to be left out, got %v", others)
+	}
+
+	select {
+	case action := <-watched:
+		labels := action.GetWatchRestrictions().Labels
+		if action.GetNamespace() != "plugins" || labels.String() != SessionLabel {
+			t.Errorf("Expected pods with label %v in namespace plugins to be watched, got %q in %q", SessionLabel, labels, action.GetNamespace())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the pods to be watched")
+	}
+	// The pods first listed may still be being handed to the subscribers
+	settle(changedA)
+	settle(changedB)
+
+	late := sessionPod("plugins", "a-2", "a")
+	podWatch.Add(late)
+	expectNotified(t, changedA, "when a pod is added")
+	expectQuiet(t, changedB, "for another session's pod")
+	if a := pods.Pods("a"); len(a) != 2 {
+		t.Errorf("Expected 2 pods in session a, got %v", a)
+	}
+
+	late = late.DeepCopy()
+	late.Status.Phase = v1.PodRunning
+	podWatch.Modify(late)
+	expectNotified(t, changedA, "when a pod is updated")
+
+	podWatch.Delete(late)
+	expectNotified(t, changedA, "when a pod is deleted")
+	if a := pods.Pods("a"); len(a) != 1 || a[0].Name != "a-1" {
+		t.Errorf("Expected only pod a-1 left in session a, got %v", a)
+	}
+}
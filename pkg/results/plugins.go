@@ -0,0 +1,225 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+// pluginsLocation is the place under which plugin results are stored
+const pluginsLocation = "plugins"
+
+// PluginResult is a result a plugin was expected to submit.
+type PluginResult struct {
+	ResultType string
+	// NodeName is the node the result is for, or empty for a global result
+	NodeName string
+	// Status is one of aggregation.ResultStatusComplete,
+	// aggregation.ResultStatusFailed or aggregation.ResultStatusPending
+	Status string
+	// Error is the reason a failed result failed, if it was recorded
+	Error string
+	// Path is the result's file, or its directory if it was submitted as a
+	// tarball. For failed results, it's the file describing the failure,
+	// as JSON. It's empty if there's no such file, eg. for pending results.
+	Path string
+}
+
+// Plugins returns the result types of the plugins the run has results for,
+// sorted.
+func (r *Reader) Plugins() ([]string, error) {
+	return r.dirs(pluginsLocation)
+}
+
+// Status returns the final status of the plugins' results, or nil if it
+// wasn't recorded, as in results from before it was.
+func (r *Reader) Status() (*aggregation.Status, error) {
+	status := &aggregation.Status{}
+	if err := r.readJSON(status, pluginsLocation, aggregation.StatusFile); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// PluginResults returns the results the plugin with the given result type
+// was expected to submit, sorted by node. If the run didn't record which
+// results were expected (see Status), they're worked out from the files
+// present instead, so pending results are missing, and a global result
+// submitted as a tarball can only be told apart from per-node results if
+// the run collected the cluster's nodes.
+func (r *Reader) PluginResults(resultType string) ([]PluginResult, error) {
+	status, err := r.Status()
+	if err != nil {
+		return nil, err
+	}
+	var pluginStatus *aggregation.PluginStatus
+	if status != nil {
+		pluginStatus = status.PluginStatus(resultType)
+	}
+	if pluginStatus == nil {
+		return r.scanPluginResults(resultType)
+	}
+
+	results := make([]PluginResult, 0, len(pluginStatus.Results))
+	for _, rs := range pluginStatus.Results {
+		result := PluginResult{
+			ResultType: resultType,
+			NodeName:   rs.NodeName,
+			Status:     rs.Status,
+			Error:      rs.Error,
+		}
+		switch rs.Status {
+		case aggregation.ResultStatusComplete:
+			result.Path, err = r.findPluginResult(resultType, "results", rs.NodeName)
+		case aggregation.ResultStatusFailed:
+			result.Path, err = r.findPluginResult(resultType, "errors", rs.NodeName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// findPluginResult returns the path of the given plugin's result for the
+// given node, or its global result if node is empty, out of its "results" or
+// "errors". It returns "" if there's no such result.
+func (r *Reader) findPluginResult(resultType, kind, node string) (string, error) {
+	dir := r.path(pluginsLocation, resultType)
+	name := kind
+	if node != "" {
+		dir = path.Join(dir, kind)
+		name = node
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	for _, info := range infos {
+		if entryName(info) == name {
+			return path.Join(dir, info.Name()), nil
+		}
+	}
+	return "", nil
+}
+
+// scanPluginResults works out the given plugin's results from the files
+// present, for results that don't record their status.
+func (r *Reader) scanPluginResults(resultType string) ([]PluginResult, error) {
+	dir := r.path(pluginsLocation, resultType)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []PluginResult
+	for _, info := range infos {
+		status := aggregation.ResultStatusComplete
+		switch entryName(info) {
+		case "results":
+		case "errors":
+			status = aggregation.ResultStatusFailed
+		default:
+			continue
+		}
+
+		entryPath := path.Join(dir, info.Name())
+		global := PluginResult{ResultType: resultType, Status: status, Path: entryPath}
+		if !info.IsDir() {
+			results = append(results, global)
+			continue
+		}
+
+		nodeInfos, err := ioutil.ReadDir(entryPath)
+		if err != nil {
+			return nil, err
+		}
+		// Global errors are always files, but a global result submitted as
+		// a tarball is a directory, like that of per-node results.
+		if status == aggregation.ResultStatusComplete {
+			perNode, err := r.namesNodes(nodeInfos)
+			if err != nil {
+				return nil, err
+			}
+			if !perNode {
+				results = append(results, global)
+				continue
+			}
+		}
+		for _, nodeInfo := range nodeInfos {
+			results = append(results, PluginResult{
+				ResultType: resultType,
+				NodeName:   entryName(nodeInfo),
+				Status:     status,
+				Path:       path.Join(entryPath, nodeInfo.Name()),
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].NodeName < results[j].NodeName
+	})
+	return results, nil
+}
+
+// namesNodes returns whether any of the given entries is named after one of
+// the cluster's nodes, as far as the results know them.
+func (r *Reader) namesNodes(infos []os.FileInfo) (bool, error) {
+	known := make(map[string]bool)
+	hosts, err := r.Hosts()
+	if err != nil {
+		return false, err
+	}
+	for _, host := range hosts {
+		known[host] = true
+	}
+	nodes, err := r.Nodes()
+	if err != nil {
+		return false, err
+	}
+	for _, node := range nodes {
+		known[node.Name] = true
+	}
+
+	for _, info := range infos {
+		if known[entryName(info)] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// entryName returns the name of a result file or directory, without the
+// file's extension.
+func entryName(info os.FileInfo) string {
+	if info.IsDir() {
+		return info.Name()
+	}
+	return strings.TrimSuffix(info.Name(), path.Ext(info.Name()))
+}
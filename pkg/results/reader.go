@@ -0,0 +1,137 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package results reads the results of a sonobuoy run, as laid out by
+// discovery.Run, so that tools consuming them don't each have to know where
+// everything is kept.
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/viniciuschiele/tarx"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// Reader reads the results of a sonobuoy run, from either a results tarball
+// or a directory it was extracted into.
+type Reader struct {
+	// Dir is the directory the results are read from. A tarball is
+	// extracted into a temporary directory, which Close removes.
+	Dir string
+
+	tmpDir string
+}
+
+// Open opens the results tarball, or extracted results directory, with the
+// given name. The Reader must be closed once it's no longer needed.
+func Open(name string) (*Reader, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &Reader{Dir: resultsRoot(name)}, nil
+	}
+
+	tmpDir, err := ioutil.TempDir("", "sonobuoy-results-")
+	if err != nil {
+		return nil, err
+	}
+	if err = tarx.Extract(name, tmpDir, &tarx.ExtractOptions{}); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("could not extract results tarball %v: %v", name, err)
+	}
+	return &Reader{Dir: resultsRoot(tmpDir), tmpDir: tmpDir}, nil
+}
+
+// resultsRoot returns the directory the results are in: dir itself, unless
+// they were archived or copied along with the directory they were written
+// to, and it's the only thing in dir.
+func resultsRoot(dir string) string {
+	if _, err := os.Stat(path.Join(dir, discovery.ConfigFile)); err == nil {
+		return dir
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil || len(infos) != 1 || !infos[0].IsDir() {
+		return dir
+	}
+	return path.Join(dir, infos[0].Name())
+}
+
+// Close removes the directory a tarball was extracted into. Paths returned by
+// the Reader are invalid afterwards.
+func (r *Reader) Close() error {
+	if r.tmpDir == "" {
+		return nil
+	}
+	return os.RemoveAll(r.tmpDir)
+}
+
+// path returns the path of the given element of the results.
+func (r *Reader) path(elem ...string) string {
+	return path.Join(append([]string{r.Dir}, elem...)...)
+}
+
+// readJSON decodes the given file of the results into v.
+func (r *Reader) readJSON(v interface{}, elem ...string) error {
+	blob, err := ioutil.ReadFile(r.path(elem...))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(blob, v); err != nil {
+		return fmt.Errorf("could not decode %v: %v", path.Join(elem...), err)
+	}
+	return nil
+}
+
+// Config returns the config the run was made with. Plugins are only recorded
+// as they were selected, so its LoadedPlugins are empty.
+func (r *Reader) Config() (*config.Config, error) {
+	cfg := &config.Config{}
+	if err := r.readJSON(cfg, discovery.ConfigFile); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Incomplete returns whether the run was interrupted, and so its results are
+// incomplete, along with the reason it gave.
+func (r *Reader) Incomplete() (reason string, incomplete bool, err error) {
+	blob, err := ioutil.ReadFile(r.path(discovery.IncompleteFile))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return string(blob), true, nil
+}
+
+// ServerVersion returns the version of the cluster's API server, if it was
+// collected.
+func (r *Reader) ServerVersion() (*version.Info, error) {
+	info := &version.Info{}
+	if err := r.readJSON(info, discovery.ServerVersionLocation, "serverversion.json"); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
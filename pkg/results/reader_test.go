@@ -0,0 +1,165 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/viniciuschiele/tarx"
+	v1 "k8s.io/api/core/v1"
+)
+
+// writeResults lays out the results of a run with a global e2e plugin,
+// submitted as a tarball, and a systemd_logs plugin that failed on one of
+// its two nodes.
+func writeResults(t *testing.T, dir string, withStatus bool) {
+	files := map[string]string{
+		"config.json":                                    `{"UUID":"run-uuid","Resources":["Pods","Nodes"]}`,
+		"serverversion/serverversion.json":               `{"major":"1","minor":"8","gitVersion":"v1.8.0"}`,
+		"resources/non-ns/Nodes.json":                    `[{"metadata":{"name":"node1"}},{"metadata":{"name":"node2"}}]`,
+		"resources/non-ns/results.json":                  `[{"queryobj":"Nodes","time":"1.5s"},{}]`,
+		"resources/ns/default/Pods.json":                 `[{"metadata":{"name":"nginx","namespace":"default"}}]`,
+		"resources/ns/default/results.json":              `[{"queryobj":"Pods","time":"20ms"},{"queryobj":"Secrets","time":"5ms","error":{}},{}]`,
+		"resources/ns/default/pods/nginx/logs/nginx.txt": "started\n",
+		"resources/ns/kube-system/results.json":          `[{}]`,
+		"hosts/node1/configz.json":                       `{"kubeletconfig":{"maxPods":110}}`,
+		"hosts/node1/healthz.json":                       `{"status":200}`,
+		"plugins/e2e/results/e2e.log":                    "ok\n",
+		"plugins/e2e/results/junit_01.xml":               "<testsuite/>",
+		"plugins/systemd_logs/results/node1.json":        `{}`,
+		"plugins/systemd_logs/errors/node2.json":         `{"error":"timed out"}`,
+	}
+	if withStatus {
+		files["plugins/status.json"] = `{"plugins":[` +
+			`{"resultType":"e2e","results":[{"status":"complete"}]},` +
+			`{"resultType":"systemd_logs","results":[{"node":"node1","status":"complete"},{"node":"node2","status":"failed","error":"timed out"}]}]}`
+	}
+
+	for name, content := range files {
+		name = path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	for _, withStatus := range []bool{true, false} {
+		dir, err := ioutil.TempDir("", "sonobuoy-results-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		writeResults(t, path.Join(dir, "results"), withStatus)
+		tarball := path.Join(dir, "results.tar.gz")
+		if err = tarx.Compress(tarball, path.Join(dir, "results"), &tarx.CompressOptions{Compression: tarx.Gzip}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{path.Join(dir, "results"), tarball} {
+			r, err := Open(name)
+			if err != nil {
+				t.Fatalf("could not open %v: %v", name, err)
+			}
+			checkReader(t, r, withStatus)
+			if err = r.Close(); err != nil {
+				t.Errorf("could not close %v: %v", name, err)
+			}
+		}
+	}
+}
+
+func checkReader(t *testing.T, r *Reader, withStatus bool) {
+	cfg, err := r.Config()
+	if err != nil || cfg.UUID != "run-uuid" {
+		t.Errorf("expected the run's config, got %v, %v", cfg, err)
+	}
+	if _, incomplete, err := r.Incomplete(); incomplete || err != nil {
+		t.Errorf("expected a complete run, got %v, %v", incomplete, err)
+	}
+	if info, err := r.ServerVersion(); err != nil || info.GitVersion != "v1.8.0" {
+		t.Errorf("expected server version v1.8.0, got %v, %v", info, err)
+	}
+
+	if nss, err := r.Namespaces(); err != nil || !reflect.DeepEqual(nss, []string{"default", "kube-system"}) {
+		t.Errorf("expected namespaces default and kube-system, got %v, %v", nss, err)
+	}
+	if resources, err := r.NamespacedResources("default"); err != nil || !reflect.DeepEqual(resources, []string{"Pods"}) {
+		t.Errorf("expected Pods in default, got %v, %v", resources, err)
+	}
+	var pods []v1.Pod
+	if err = r.Namespaced("default", "Pods", &pods); err != nil || len(pods) != 1 || pods[0].Name != "nginx" {
+		t.Errorf("expected the nginx pod, got %v, %v", pods, err)
+	}
+	var secrets []v1.Secret
+	if err = r.Namespaced("default", "Secrets", &secrets); err != nil || len(secrets) != 0 {
+		t.Errorf("expected no secrets, got %v, %v", secrets, err)
+	}
+	if log, err := r.PodLog("default", "nginx", "nginx"); err != nil || string(log) != "started\n" {
+		t.Errorf("expected the nginx log, got %q, %v", log, err)
+	}
+	if nodes, err := r.Nodes(); err != nil || len(nodes) != 2 {
+		t.Errorf("expected 2 nodes, got %v, %v", nodes, err)
+	}
+
+	timings, err := r.QueryTimings("default")
+	if err != nil || len(timings) != 2 || timings[0].Name != "Pods" || timings[0].Failed || !timings[1].Failed {
+		t.Errorf("expected a successful Pods query and a failed Secrets one, got %v, %v", timings, err)
+	}
+	if timings, err = r.QueryTimings(""); err != nil || len(timings) != 1 || timings[0].Duration.Seconds() != 1.5 {
+		t.Errorf("expected a 1.5s Nodes query, got %v, %v", timings, err)
+	}
+
+	if hosts, err := r.Hosts(); err != nil || !reflect.DeepEqual(hosts, []string{"node1"}) {
+		t.Errorf("expected host node1, got %v, %v", hosts, err)
+	}
+	if configz, err := r.Configz("node1"); err != nil || configz["kubeletconfig"] == nil {
+		t.Errorf("expected node1's configz, got %v, %v", configz, err)
+	}
+	if healthz, err := r.Healthz("node1"); err != nil || healthz != 200 {
+		t.Errorf("expected node1 to be healthy, got %v, %v", healthz, err)
+	}
+
+	if plugins, err := r.Plugins(); err != nil || !reflect.DeepEqual(plugins, []string{"e2e", "systemd_logs"}) {
+		t.Errorf("expected plugins e2e and systemd_logs, got %v, %v", plugins, err)
+	}
+
+	e2e, err := r.PluginResults("e2e")
+	if err != nil || len(e2e) != 1 || e2e[0].NodeName != "" || e2e[0].Status != aggregation.ResultStatusComplete || e2e[0].Path != r.path("plugins/e2e/results") {
+		t.Errorf("expected a global e2e result, got %v, %v", e2e, err)
+	}
+
+	logs, err := r.PluginResults("systemd_logs")
+	expected := []PluginResult{
+		{ResultType: "systemd_logs", NodeName: "node1", Status: aggregation.ResultStatusComplete, Path: r.path("plugins/systemd_logs/results/node1.json")},
+		{ResultType: "systemd_logs", NodeName: "node2", Status: aggregation.ResultStatusFailed, Path: r.path("plugins/systemd_logs/errors/node2.json")},
+	}
+	if withStatus {
+		expected[1].Error = "timed out"
+	}
+	if err != nil || !reflect.DeepEqual(logs, expected) {
+		t.Errorf("expected systemd_logs results %v, got %v, %v", expected, logs, err)
+	}
+}
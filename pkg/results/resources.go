@@ -0,0 +1,199 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	v1 "k8s.io/api/core/v1"
+)
+
+// queryResultsFile is the file in each directory of resources recording how
+// its queries went.
+const queryResultsFile = "results.json"
+
+// QueryTiming is how a query made by the run went.
+type QueryTiming struct {
+	// Name is the name of the resource queried, eg. "Pods", or of the data
+	// gathered, eg. "podlogs" or "nodedata"
+	Name     string
+	Duration time.Duration
+	// Failed is whether the query failed. The error itself isn't recorded.
+	Failed bool
+}
+
+// Namespaces returns the namespaces resources were collected from, sorted.
+func (r *Reader) Namespaces() ([]string, error) {
+	return r.dirs(discovery.NSResourceLocation)
+}
+
+// NamespacedResources returns the names of the resources collected from the
+// given namespace, sorted, eg. "Pods" or "Deployments". Resources that
+// had no objects in it aren't included.
+func (r *Reader) NamespacedResources(ns string) ([]string, error) {
+	return r.resources(discovery.NSResourceLocation, ns)
+}
+
+// ClusterResources returns the names of the cluster-scoped resources
+// collected, sorted, eg. "Nodes". Resources that had no objects aren't
+// included.
+func (r *Reader) ClusterResources() ([]string, error) {
+	return r.resources(discovery.NonNSResourceLocation)
+}
+
+// Namespaced decodes the objects of the named resource collected from the
+// given namespace into v, which should be a pointer to a slice of the
+// resource's type, eg. *[]v1.Pod. Resources with no objects aren't written,
+// so if there are none, v is left as it is.
+func (r *Reader) Namespaced(ns, resource string, v interface{}) error {
+	return r.readResource(v, discovery.NSResourceLocation, ns, resource+".json")
+}
+
+// Cluster decodes the objects of the named cluster-scoped resource into v,
+// which should be a pointer to a slice of the resource's type, eg.
+// *[]v1.Node. If there are none, v is left as it is.
+func (r *Reader) Cluster(resource string, v interface{}) error {
+	return r.readResource(v, discovery.NonNSResourceLocation, resource+".json")
+}
+
+// Nodes returns the nodes of the cluster, if they were collected.
+func (r *Reader) Nodes() ([]v1.Node, error) {
+	var nodes []v1.Node
+	err := r.Cluster("Nodes", &nodes)
+	return nodes, err
+}
+
+// PodLog returns the log of the given container, if it was collected.
+func (r *Reader) PodLog(ns, pod, container string) ([]byte, error) {
+	return ioutil.ReadFile(r.path(discovery.NSResourceLocation, ns, discovery.PodsLocation, pod, "logs", container+".txt"))
+}
+
+// QueryTimings returns how each query for the given namespace went, or for
+// the cluster-scoped resources if ns is empty, in the order they're recorded.
+func (r *Reader) QueryTimings(ns string) ([]QueryTiming, error) {
+	elem := []string{discovery.NonNSResourceLocation, queryResultsFile}
+	if ns != "" {
+		elem = []string{discovery.NSResourceLocation, ns, queryResultsFile}
+	}
+
+	var recorded []struct {
+		QueryObj    string          `json:"queryobj"`
+		ElapsedTime string          `json:"time"`
+		Error       json.RawMessage `json:"error"`
+	}
+	if err := r.readJSON(&recorded, elem...); err != nil {
+		return nil, err
+	}
+
+	timings := make([]QueryTiming, 0, len(recorded))
+	for _, q := range recorded {
+		// The list is terminated by an empty object
+		if q.QueryObj == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(q.ElapsedTime)
+		if err != nil {
+			return nil, err
+		}
+		timings = append(timings, QueryTiming{
+			Name:     q.QueryObj,
+			Duration: duration,
+			Failed:   len(q.Error) > 0 && string(q.Error) != "null",
+		})
+	}
+	return timings, nil
+}
+
+// Hosts returns the nodes whose configz and healthz were collected, sorted.
+func (r *Reader) Hosts() ([]string, error) {
+	return r.dirs(discovery.HostsLocation)
+}
+
+// Configz returns the configz of the given node, which is empty if the node
+// didn't serve it.
+func (r *Reader) Configz(node string) (map[string]interface{}, error) {
+	var configz map[string]interface{}
+	if err := r.readJSON(&configz, discovery.HostsLocation, node, "configz.json"); err != nil {
+		return nil, err
+	}
+	return configz, nil
+}
+
+// Healthz returns the status code of the given node's healthz, or 0 if it
+// couldn't be reached.
+func (r *Reader) Healthz(node string) (int, error) {
+	var healthz struct {
+		Status int `json:"status"`
+	}
+	if err := r.readJSON(&healthz, discovery.HostsLocation, node, "healthz.json"); err != nil {
+		return 0, err
+	}
+	return healthz.Status, nil
+}
+
+// readResource decodes the given resource file into v, leaving v as it is
+// if the file doesn't exist.
+func (r *Reader) readResource(v interface{}, elem ...string) error {
+	if err := r.readJSON(v, elem...); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// resources returns the names of the resource files in the given directory
+// of the results, sorted. A missing directory has none.
+func (r *Reader) resources(elem ...string) ([]string, error) {
+	infos, err := ioutil.ReadDir(r.path(elem...))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() || info.Name() == queryResultsFile || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(info.Name(), ".json"))
+	}
+	return names, nil
+}
+
+// dirs returns the names of the directories in the given directory of the
+// results, sorted. A missing directory has none.
+func (r *Reader) dirs(elem ...string) ([]string, error) {
+	infos, err := ioutil.ReadDir(r.path(elem...))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+// NewHTTPClient returns the HTTP client a worker should use to submit results
+// to the master. If the worker was handed credentials, the client trusts only
+// the run's certificate authority and presents its own client certificate;
+// otherwise it is a default client.
+func NewHTTPClient(cfg *plugin.WorkerConfig) (*http.Client, error) {
+	creds := cfg.WorkerCredentials
+	if creds.CACert == "" && creds.ClientCert == "" && creds.ClientKey == "" {
+		return &http.Client{}, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if creds.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(creds.CACert)) {
+			return nil, errors.New("could not parse CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if creds.ClientCert != "" || creds.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(creds.ClientCert), []byte(creds.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
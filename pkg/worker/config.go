@@ -17,7 +17,9 @@ limitations under the License.
 package worker
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/spf13/viper"
@@ -28,7 +30,8 @@ func setConfigDefaults(ac *plugin.WorkerConfig) {
 }
 
 // LoadConfig loads the configuration for the sonobuoy worker from environment
-// variables, returning a plugin.WorkerConfig struct with defaults applied
+// variables, and its credentials from plugin.CredentialsDir, returning a
+// plugin.WorkerConfig struct with defaults applied
 func LoadConfig() (*plugin.WorkerConfig, error) {
 	config := &plugin.WorkerConfig{}
 	var err error
@@ -57,5 +60,31 @@ func LoadConfig() (*plugin.WorkerConfig, error) {
 		return nil, err
 	}
 
+	if err = loadCredentials(plugin.CredentialsDir, &config.WorkerCredentials); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
+
+// loadCredentials reads the worker credentials mounted in dir, overriding
+// any given in the config. Workers run outside of sonobuoy's plugin drivers
+// won't have any, so missing files are skipped.
+func loadCredentials(dir string, creds *plugin.WorkerCredentials) error {
+	for file, value := range map[string]*string{
+		plugin.CACertFile:     &creds.CACert,
+		plugin.ClientCertFile: &creds.ClientCert,
+		plugin.ClientKeyFile:  &creds.ClientKey,
+		plugin.TokenFile:      &creds.Token,
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		*value = string(data)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2017 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	withTempDir(t, func(tmpdir string) {
+		ioutil.WriteFile(filepath.Join(tmpdir, plugin.CACertFile), []byte("ca"), 0400)
+		ioutil.WriteFile(filepath.Join(tmpdir, plugin.TokenFile), []byte("token"), 0400)
+
+		creds := plugin.WorkerCredentials{ClientCert: "cert", Token: "stale"}
+		if err := loadCredentials(tmpdir, &creds); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := plugin.WorkerCredentials{CACert: "ca", ClientCert: "cert", Token: "token"}
+		if creds != expected {
+			t.Errorf("Expected credentials %+v, got %+v", expected, creds)
+		}
+	})
+}
@@ -31,8 +31,11 @@ import (
 // the results, with error handling, and falls back on uploading JSON with the
 // error message if the callback fails. (This way, problems gathering data
 // don't result in the server waiting forever for results that will never
-// come.)
-func DoRequest(url string, callback func() (io.Reader, error)) error {
+// come.) Requests are retried, and sent with the given client and, if it's
+// set, the plugin's bearer token.
+func DoRequest(url string, client *http.Client, token string, callback func() (io.Reader, error)) error {
+	pc := pester.NewExtendedClient(client)
+
 	input, err := callback()
 	if err != nil {
 		glog.Errorf("Error gathering host data: %v", err)
@@ -50,9 +53,10 @@ func DoRequest(url string, callback func() (io.Reader, error)) error {
 		if err != nil {
 			return err
 		}
+		setToken(req, token)
 
 		// And if we can't even do that, log it.
-		resp, err := pester.Do(req)
+		resp, err := pc.Do(req)
 		if err != nil || resp.StatusCode != http.StatusOK {
 			glog.Errorf("Could not send error message to master URL (%v): %v", url, err)
 		}
@@ -64,8 +68,9 @@ func DoRequest(url string, callback func() (io.Reader, error)) error {
 	if err != nil {
 		glog.Errorf("Error constructing master request to %v: %v", url, err)
 	}
+	setToken(req, token)
 
-	resp, err := pester.Do(req)
+	resp, err := pc.Do(req)
 	if err != nil {
 		return fmt.Errorf("Error dialing master to %v: %v", url, err)
 	}
@@ -76,3 +81,10 @@ func DoRequest(url string, callback func() (io.Reader, error)) error {
 
 	return nil
 }
+
+// setToken authenticates req with the given bearer token, if there is one.
+func setToken(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
@@ -19,6 +19,7 @@ package worker
 import (
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -32,7 +33,10 @@ import (
 // 1. Output data will be placed into an agreed upon results directory.
 // 2. The Job will wait for a done file
 // 3. The done file contains a single string of the results to be sent to the master
-func GatherResults(waitfile string, url string) error {
+//
+// Results are submitted with the given client (see NewHTTPClient) and bearer
+// token.
+func GatherResults(waitfile string, url string, client *http.Client, token string) error {
 	var inputFileName []byte
 	var err error
 
@@ -60,7 +64,7 @@ func GatherResults(waitfile string, url string) error {
 	}
 
 	// transmit back the results file.
-	return DoRequest(url, func() (io.Reader, error) {
+	return DoRequest(url, client, token, func() (io.Reader, error) {
 		outfile, err := os.Open(s)
 		if err != nil {
 			glog.Errorf("Failed to open file (%s)", s)
@@ -17,6 +17,7 @@ limitations under the License.
 package worker
 
 import (
+	"crypto/tls"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -25,6 +26,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/heptio/sonobuoy/pkg/ca"
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
 )
@@ -48,7 +50,7 @@ func TestRun(t *testing.T) {
 			withTempDir(t, func(tmpdir string) {
 				ioutil.WriteFile(tmpdir+"/systemd_logs", []byte("{}"), 0755)
 				ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs"), 0755)
-				err := GatherResults(tmpdir+"/done", url)
+				err := GatherResults(tmpdir+"/done", url, http.DefaultClient, "")
 				if err != nil {
 					t.Fatalf("Got error running agent: %v", err)
 				}
@@ -71,7 +73,7 @@ func TestRunGlobal(t *testing.T) {
 		withTempDir(t, func(tmpdir string) {
 			ioutil.WriteFile(tmpdir+"/systemd_logs.json", []byte("{}"), 0755)
 			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs.json"), 0755)
-			err := GatherResults(tmpdir+"/done", url)
+			err := GatherResults(tmpdir+"/done", url, http.DefaultClient, "")
 			if err != nil {
 				t.Fatalf("Got error running agent: %v", err)
 			}
@@ -93,7 +95,7 @@ func TestRunGlobal_noExtension(t *testing.T) {
 		withTempDir(t, func(tmpdir string) {
 			ioutil.WriteFile(tmpdir+"/systemd_logs", []byte("{}"), 0755)
 			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs"), 0755)
-			err := GatherResults(tmpdir+"/done", url)
+			err := GatherResults(tmpdir+"/done", url, http.DefaultClient, "")
 			if err != nil {
 				t.Fatalf("Got error running agent: %v", err)
 			}
@@ -103,6 +105,114 @@ func TestRunGlobal_noExtension(t *testing.T) {
 	})
 }
 
+func TestRun_tls(t *testing.T) {
+	authority, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("Could not create authority: %v", err)
+	}
+	serverCert, err := authority.ServerCertificate("127.0.0.1")
+	if err != nil {
+		t.Fatalf("Could not create server certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{*serverCert},
+		ClientCAs:    authority.CertPool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+
+	newClient := func(commonName string) *http.Client {
+		certPEM, keyPEM, err := authority.ClientCertificate(commonName)
+		if err != nil {
+			t.Fatalf("Could not create client certificate: %v", err)
+		}
+		client, err := NewHTTPClient(&plugin.WorkerConfig{
+			WorkerCredentials: plugin.WorkerCredentials{
+				CACert:     string(authority.CACertPEM()),
+				ClientCert: string(certPEM),
+				ClientKey:  string(keyPEM),
+			},
+		})
+		if err != nil {
+			t.Fatalf("Could not create HTTP client: %v", err)
+		}
+		return client
+	}
+
+	url := "https://127.0.0.1:" + strconv.Itoa(aggregatorPort) + "/api/v1/results/global/systemd_logs"
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "systemd_logs"},
+	}
+
+	configure := func(srv *aggregation.Server) {
+		srv.TLSConfig = tlsConfig
+	}
+	withConfiguredAggregator(t, expectedResults, configure, func(aggr *aggregation.Aggregator) {
+		withTempDir(t, func(tmpdir string) {
+			ioutil.WriteFile(tmpdir+"/systemd_logs.json", []byte("{}"), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs.json"), 0755)
+
+			// Without a client certificate
+			anonymous, err := NewHTTPClient(&plugin.WorkerConfig{
+				WorkerCredentials: plugin.WorkerCredentials{CACert: string(authority.CACertPEM())},
+			})
+			if err != nil {
+				t.Fatalf("Could not create HTTP client: %v", err)
+			}
+			if err = GatherResults(tmpdir+"/done", url, anonymous, ""); err == nil {
+				t.Error("Expected results without a client certificate to be rejected")
+			}
+
+			// With a certificate for another plugin
+			if err = GatherResults(tmpdir+"/done", url, newClient("e2e"), ""); err == nil {
+				t.Error("Expected results with another plugin's certificate to be rejected")
+			}
+
+			if _, err = os.Stat(path.Join(aggr.OutputDir, "systemd_logs")); err == nil {
+				t.Fatal("Rejected results were saved")
+			}
+
+			if err = GatherResults(tmpdir+"/done", url, newClient("systemd_logs"), ""); err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+			ensureExists(t, path.Join(aggr.OutputDir, "systemd_logs", "results.json"))
+		})
+	})
+}
+
+func TestRun_token(t *testing.T) {
+	url := "http://:" + strconv.Itoa(aggregatorPort) + "/api/v1/results/global/systemd_logs"
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "systemd_logs"},
+	}
+
+	configure := func(srv *aggregation.Server) {
+		srv.Tokens = map[string]string{
+			"systemd_logs": "systemd-logs-token",
+			"e2e":          "e2e-token",
+		}
+	}
+	withConfiguredAggregator(t, expectedResults, configure, func(aggr *aggregation.Aggregator) {
+		withTempDir(t, func(tmpdir string) {
+			ioutil.WriteFile(tmpdir+"/systemd_logs.json", []byte("{}"), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs.json"), 0755)
+
+			for _, token := range []string{"", "e2e-token", "wrong"} {
+				if err := GatherResults(tmpdir+"/done", url, http.DefaultClient, token); err == nil {
+					t.Errorf("Expected results with token %q to be rejected", token)
+				}
+			}
+			if _, err := os.Stat(path.Join(aggr.OutputDir, "systemd_logs")); err == nil {
+				t.Fatal("Rejected results were saved")
+			}
+
+			if err := GatherResults(tmpdir+"/done", url, http.DefaultClient, "systemd-logs-token"); err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+			ensureExists(t, path.Join(aggr.OutputDir, "systemd_logs", "results.json"))
+		})
+	})
+}
+
 const aggregatorPort = 8090
 
 func ensureExists(t *testing.T, filepath string) {
@@ -126,6 +236,12 @@ func withTempDir(t *testing.T, callback func(tmpdir string)) {
 }
 
 func withAggregator(t *testing.T, expectedResults []plugin.ExpectedResult, callback func(*aggregation.Aggregator)) {
+	withConfiguredAggregator(t, expectedResults, nil, callback)
+}
+
+// withConfiguredAggregator is withAggregator, calling configure (if set) on
+// the server before it starts.
+func withConfiguredAggregator(t *testing.T, expectedResults []plugin.ExpectedResult, configure func(*aggregation.Server), callback func(*aggregation.Aggregator)) {
 	withTempDir(t, func(tmpdir string) {
 		// Reset the default transport to clear any connection pooling
 		http.DefaultTransport = &http.Transport{}
@@ -133,6 +249,9 @@ func withAggregator(t *testing.T, expectedResults []plugin.ExpectedResult, callb
 		// Configure the aggregator
 		aggr := aggregation.NewAggregator(tmpdir, expectedResults)
 		srv := aggregation.NewServer(":"+strconv.Itoa(aggregatorPort), aggr.HandleHTTPResult)
+		if configure != nil {
+			configure(srv)
+		}
 
 		// Run the aggregation server
 		done := make(chan error)